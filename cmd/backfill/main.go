@@ -0,0 +1,139 @@
+// Command backfill loads the swaps, mints and burns of pairs over a date
+// range. The range is split into one shard per pair, entity and window, run by
+// a pool of workers sharing one rate limit.
+//
+//	backfill -sqlite uniswap.db -pairs 0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc \
+//		-start 2020-05-01T00:00:00Z -end 2023-05-01T00:00:00Z -window 168h \
+//		-workers 8 -rate 10 -progress backfill.json
+//
+// Progress is kept in the -progress file: stop it with Ctrl-C and run the same
+// command again to resume without refetching completed shards.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/ethrpc"
+	"github.com/gelhteag/onchainaggregator/pkg/ingest"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+func main() {
+	sqlitePath := flag.String("sqlite", "", "SQLite database file (default: InfluxDB)")
+	url := flag.String("url", "http://localhost:8086", "InfluxDB URL")
+	token := flag.String("token", os.Getenv("INFLUX_TOKEN"), "InfluxDB token (default $INFLUX_TOKEN)")
+	org := flag.String("org", "", "InfluxDB organization")
+	bucket := flag.String("bucket", "", "InfluxDB bucket")
+	pairs := flag.String("pairs", "", "comma-separated pair addresses")
+	entities := flag.String("entities", "swaps,mints,burns", "comma-separated entities")
+	start := flag.String("start", "", "start of the range, RFC3339")
+	end := flag.String("end", "", "end of the range, RFC3339 (default now)")
+	window := flag.Duration("window", 24*time.Hour, "time span of a shard")
+	workers := flag.Int("workers", 4, "shards run concurrently")
+	rate := flag.Float64("rate", 5, "subgraph queries per second across all workers (0 for no limit)")
+	endpoints := flag.String("endpoint", uniswap.DefaultEndpoint, "comma-separated subgraph endpoints, in order of preference")
+	crossCheck := flag.Bool("cross-check", false, "run every query on two endpoints and fail when they differ")
+	progressPath := flag.String("progress", "backfill.json", "progress file")
+	pageSize := flag.Int("page-size", 1000, "records per subgraph query")
+	maxLag := flag.Duration("max-lag", 0, "pause while the subgraph is further behind than this (0 disables the check)")
+	rpcURL := flag.String("rpc", "", "Ethereum JSON-RPC URL to measure the lag against (default the clock)")
+	confirmations := flag.Int64("confirmations", 0, "blocks after which records are final; recent records are checked for reorgs (0 disables)")
+	flag.Parse()
+
+	if *pairs == "" || *start == "" {
+		log.Fatal("-pairs and -start are required")
+	}
+	from, err := time.Parse(time.RFC3339, *start)
+	if err != nil {
+		log.Fatalf("Invalid -start: %v", err)
+	}
+	to := time.Now().UTC()
+	if *end != "" {
+		if to, err = time.Parse(time.RFC3339, *end); err != nil {
+			log.Fatalf("Invalid -end: %v", err)
+		}
+	}
+	var kinds []ingest.Entity
+	for _, entity := range strings.Split(*entities, ",") {
+		kinds = append(kinds, ingest.Entity(strings.TrimSpace(entity)))
+	}
+
+	var store db.Store
+	if *sqlitePath != "" {
+		store, err = db.NewSQLiteStore(*sqlitePath)
+		if err != nil {
+			log.Fatalf("Error opening SQLite store: %v", err)
+		}
+	} else {
+		client, err := db.NewBatchClient(*url, *token, *org, *bucket, db.DefaultBatchOptions())
+		if err != nil {
+			log.Fatalf("Error creating InfluxDB client: %v", err)
+		}
+		go func() {
+			for batchErr := range client.Errors() {
+				log.Printf("Write failed: %v", batchErr)
+			}
+		}()
+		store = db.NewInfluxStore(client)
+	}
+	defer store.Close()
+
+	progress, err := ingest.OpenProgress(*progressPath)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", *progressPath, err)
+	}
+
+	limiter := uniswap.NewLimiter(*rate, *workers)
+	if urls := strings.Split(*endpoints, ","); len(urls) > 1 {
+		failover := uniswap.NewFailoverClient(limiter, urls...)
+		failover.CrossCheck = *crossCheck
+		uniswap.SetRunner(failover)
+	} else {
+		uniswap.SetRunner(uniswap.NewClient(urls[0], limiter))
+	}
+	syncer := ingest.NewSyncer(store)
+	syncer.PageSize = *pageSize
+	syncer.Confirmations = *confirmations
+	if *maxLag > 0 {
+		var reference ingest.Reference = ingest.ClockReference{}
+		if *rpcURL != "" {
+			reference = ingest.RPCReference{Client: ethrpc.NewClient(*rpcURL)}
+		}
+		syncer.Health = ingest.NewHealthChecker(reference)
+		syncer.Health.MaxLag = *maxLag
+	}
+	backfill := ingest.NewBackfill(syncer, *workers, progress)
+	backfill.Report = func(result ingest.ShardResult) {
+		switch {
+		case result.Err != nil:
+			log.Printf("%s failed: %v", result.Job.CheckpointKey(), result.Err)
+		case !result.Skipped:
+			log.Printf("%s: %d records", result.Job.CheckpointKey(), result.Records)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	shards := ingest.Shards(strings.Split(*pairs, ","), kinds, from, to, *window)
+	summary, err := backfill.Run(ctx, shards)
+	if summary != nil {
+		fmt.Printf("%d shards: %d done, %d already done, %d failed, %d records\n",
+			summary.Shards, summary.Done, summary.Skipped, summary.Failed, summary.Records)
+	}
+	if err != nil {
+		store.Close()
+		log.Fatalf("Backfill stopped: %v", err)
+	}
+	if summary.Failed > 0 {
+		store.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+// Command export writes swaps, token day data or pair day data from the
+// subgraph to partitioned Parquet or CSV files.
+//
+//	export -dataset swaps -format parquet -out data \
+//		-pair 0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc \
+//		-start 2023-04-01T00:00:00Z -end 2023-05-01T00:00:00Z
+//
+// writes data/swaps/pair=0xb4e1.../date=2023-04-01/part-00000.parquet and so on.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/export"
+)
+
+func main() {
+	dataset := flag.String("dataset", "swaps", "swaps, token_days or pair_days")
+	format := flag.String("format", "parquet", "parquet or csv")
+	out := flag.String("out", "export", "output directory")
+	period := flag.String("period", "", "time partition: day, month or none (default day for swaps, month for day data)")
+	byKey := flag.Bool("by-key", true, "partition by pair, or token for token_days")
+	pair := flag.String("pair", "", "only export this pair (swaps, pair_days)")
+	token := flag.String("token", "", "only export this token (token_days)")
+	start := flag.String("start", "", "start of the range, RFC3339")
+	end := flag.String("end", "", "end of the range, RFC3339 (default latest)")
+	pageSize := flag.Int("page-size", export.DefaultPageSize, "records per subgraph query")
+	flag.Parse()
+
+	var r export.Range
+	var err error
+	if r.Start, err = parseTime(*start); err != nil {
+		log.Fatalf("Invalid -start: %v", err)
+	}
+	if r.End, err = parseTime(*end); err != nil {
+		log.Fatalf("Invalid -end: %v", err)
+	}
+
+	where := map[string]interface{}{}
+	var source export.Source
+	defaultPeriod := export.PeriodMonth
+	switch *dataset {
+	case export.SwapSchema.Name:
+		if *pair != "" {
+			where["pair"] = strings.ToLower(*pair)
+		}
+		source = export.Swaps(nil, where, r, *pageSize)
+		defaultPeriod = export.PeriodDay
+	case export.TokenDaySchema.Name:
+		if *token != "" {
+			where["token"] = strings.ToLower(*token)
+		}
+		source = export.TokenDays(nil, where, r, *pageSize)
+	case export.PairDaySchema.Name:
+		if *pair != "" {
+			where["pairAddress"] = strings.ToLower(*pair)
+		}
+		source = export.PairDays(nil, where, r, *pageSize)
+	default:
+		log.Fatalf("Unknown dataset %q", *dataset)
+	}
+
+	exporter := &export.Exporter{Dir: *out, Format: export.Format(*format), Period: defaultPeriod, ByKey: *byKey}
+	switch *period {
+	case "":
+	case "day":
+		exporter.Period = export.PeriodDay
+	case "month":
+		exporter.Period = export.PeriodMonth
+	case "none":
+		exporter.Period = export.PeriodNone
+	default:
+		log.Fatalf("Unknown period %q", *period)
+	}
+
+	partitions, err := exporter.Export(source)
+	if err != nil {
+		log.Fatalf("Error exporting %s: %v", *dataset, err)
+	}
+	rows := 0
+	for _, p := range partitions {
+		rows += p.Rows
+	}
+	fmt.Printf("Wrote %d rows to %d files under %s\n", rows, len(partitions), *out)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,68 @@
+// Command verify scans stored events for duplicate keys and for gaps in time.
+//
+//	verify -url http://localhost:8086 -token $INFLUX_TOKEN -org org -bucket uniswap \
+//		-measurement swap -pair 0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc \
+//		-start 2023-04-01T00:00:00Z -end 2023-04-02T00:00:00Z -max-gap 1h
+//
+// It exits with status 1 when anything is found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8086", "InfluxDB URL")
+	token := flag.String("token", os.Getenv("INFLUX_TOKEN"), "InfluxDB token (default $INFLUX_TOKEN)")
+	org := flag.String("org", "", "InfluxDB organization")
+	bucket := flag.String("bucket", "", "InfluxDB bucket")
+	measurement := flag.String("measurement", "swap", "measurement to scan")
+	pair := flag.String("pair", "", "only scan this pair")
+	start := flag.String("start", "", "start of the range, RFC3339")
+	end := flag.String("end", "", "end of the range, RFC3339 (default now)")
+	maxGap := flag.Duration("max-gap", 0, "report stretches longer than this without points (0 disables)")
+	flag.Parse()
+
+	query := db.SeriesQuery{Measurement: *measurement}
+	if *pair != "" {
+		query.Tags = map[string]string{"pair": strings.ToLower(*pair)}
+	}
+	var err error
+	if query.Start, err = parseTime(*start); err != nil {
+		log.Fatalf("Invalid -start: %v", err)
+	}
+	if query.End, err = parseTime(*end); err != nil {
+		log.Fatalf("Invalid -end: %v", err)
+	}
+
+	client, err := db.NewClient(*url, *token, *org, *bucket)
+	if err != nil {
+		log.Fatalf("Error creating InfluxDB client: %v", err)
+	}
+	store := db.NewInfluxStore(client)
+	defer store.Close()
+
+	verification, err := db.Verify(store, query, *maxGap)
+	if err != nil {
+		log.Fatalf("Error verifying %s: %v", *measurement, err)
+	}
+	fmt.Println(verification)
+	if !verification.OK() {
+		store.Close()
+		os.Exit(1)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,194 @@
+package arbitrage
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gelhteag/onchainaggregator/pkg/router"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// DefaultMaxLength is the number of pools in a triangular cycle.
+const DefaultMaxLength = 3
+
+const feeFactor = float64(uniswap.FeeNumerator) / float64(uniswap.FeeDenominator)
+
+// Cycle is a closed swap path that starts and ends in the same token.
+type Cycle struct {
+	Tokens []string // token addresses, the first token is repeated at the end
+	Pairs  []string // pair IDs traversed in order
+	// RateProduct is the product of the spot exchange rates after the 0.3% fee.
+	// A cycle is profitable for small inputs when it is above 1.
+	RateProduct float64
+	// OptimalIn is the input amount, in units of the start token, that
+	// maximises profit once price impact is taken into account.
+	OptimalIn float64
+	AmountOut float64
+	Profit    float64
+	// Block is the block the reserves were read at, 0 for the latest state.
+	Block int
+}
+
+// Detector scans a pair graph for profitable cycles.
+type Detector struct {
+	Graph     *router.Graph
+	MaxLength int
+	// MinProfit filters out cycles whose profit, in start token units, is below it.
+	MinProfit float64
+	// StartTokens restricts the scan to cycles starting at these tokens (e.g. WETH).
+	// When empty every cycle is reported once, starting at its smallest token address.
+	StartTokens []string
+}
+
+func NewDetector(graph *router.Graph) *Detector {
+	return &Detector{Graph: graph, MaxLength: DefaultMaxLength}
+}
+
+// Detect returns the profitable cycles in the graph, most profitable first.
+func (d *Detector) Detect() []Cycle {
+	maxLength := d.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLength
+	}
+
+	starts := d.StartTokens
+	canonical := len(starts) == 0
+	if canonical {
+		seen := make(map[string]bool)
+		for _, pool := range d.Graph.Pools() {
+			for _, token := range []string{pool.Token0, pool.Token1} {
+				if !seen[token] {
+					seen[token] = true
+					starts = append(starts, token)
+				}
+			}
+		}
+		sort.Strings(starts)
+	}
+
+	var cycles []Cycle
+	for _, start := range starts {
+		start = strings.ToLower(start)
+		var hops []hop
+		visitedTokens := map[string]bool{start: true}
+		usedPools := make(map[string]bool)
+
+		var search func(token string)
+		search = func(token string) {
+			for _, pool := range d.Graph.PoolsForToken(token) {
+				if usedPools[pool.ID] {
+					continue
+				}
+				reserveIn, reserveOut, next := pool.Reserves(token)
+				if canonical && next < start {
+					continue
+				}
+				h := hop{pairID: pool.ID, tokenOut: next, reserveIn: reserveIn, reserveOut: reserveOut}
+				if next == start {
+					if len(hops) >= 2 {
+						if cycle, ok := evaluate(start, append(hops, h)); ok && cycle.Profit >= d.MinProfit {
+							cycles = append(cycles, cycle)
+						}
+					}
+					continue
+				}
+				if visitedTokens[next] || len(hops)+1 >= maxLength {
+					continue
+				}
+				visitedTokens[next] = true
+				usedPools[pool.ID] = true
+				hops = append(hops, h)
+				search(next)
+				hops = hops[:len(hops)-1]
+				delete(usedPools, pool.ID)
+				visitedTokens[next] = false
+			}
+		}
+		search(start)
+	}
+
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i].Profit > cycles[j].Profit })
+	return cycles
+}
+
+type hop struct {
+	pairID     string
+	tokenOut   string
+	reserveIn  float64
+	reserveOut float64
+}
+
+// evaluate collapses the cycle into a single virtual constant-product pool,
+// which gives the profit-maximising input in closed form, then simulates
+// that input hop by hop to get the exact output.
+func evaluate(start string, hops []hop) (Cycle, bool) {
+	rateProduct := 1.0
+	for _, h := range hops {
+		if h.reserveIn <= 0 || h.reserveOut <= 0 {
+			return Cycle{}, false
+		}
+		rateProduct *= feeFactor * h.reserveOut / h.reserveIn
+	}
+	if rateProduct <= 1 {
+		return Cycle{}, false
+	}
+
+	virtualIn, virtualOut := hops[0].reserveIn, hops[0].reserveOut
+	for _, h := range hops[1:] {
+		denominator := h.reserveIn + feeFactor*virtualOut
+		virtualIn = virtualIn * h.reserveIn / denominator
+		virtualOut = feeFactor * virtualOut * h.reserveOut / denominator
+	}
+	optimalIn := (math.Sqrt(virtualIn*virtualOut*feeFactor) - virtualIn) / feeFactor
+	if optimalIn <= 0 {
+		return Cycle{}, false
+	}
+
+	cycle := Cycle{
+		Tokens:      []string{start},
+		RateProduct: rateProduct,
+		OptimalIn:   optimalIn,
+	}
+	amount := optimalIn
+	for _, h := range hops {
+		out, err := uniswap.GetAmountOut(amount, h.reserveIn, h.reserveOut)
+		if err != nil {
+			return Cycle{}, false
+		}
+		amount = out
+		cycle.Tokens = append(cycle.Tokens, h.tokenOut)
+		cycle.Pairs = append(cycle.Pairs, h.pairID)
+	}
+	cycle.AmountOut = amount
+	cycle.Profit = amount - optimalIn
+	return cycle, cycle.Profit > 0
+}
+
+// DetectAtBlock loads the limit most liquid pairs as they were at block and
+// scans them for cycles. It is meant for backtesting against past reserves.
+func DetectAtBlock(source router.PairSource, block int, limit int, template Detector) ([]Cycle, error) {
+	graph := router.NewGraph()
+	if err := graph.Load(source, limit, uniswap.AtBlock(nil, block)); err != nil {
+		return nil, err
+	}
+	template.Graph = graph
+	cycles := template.Detect()
+	for i := range cycles {
+		cycles[i].Block = block
+	}
+	return cycles, nil
+}
+
+// Backtest runs DetectAtBlock for every block and returns the cycles found per block.
+func Backtest(source router.PairSource, blocks []int, limit int, template Detector) (map[int][]Cycle, error) {
+	results := make(map[int][]Cycle, len(blocks))
+	for _, block := range blocks {
+		cycles, err := DetectAtBlock(source, block, limit, template)
+		if err != nil {
+			return nil, err
+		}
+		results[block] = cycles
+	}
+	return results, nil
+}
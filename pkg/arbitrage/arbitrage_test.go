@@ -0,0 +1,93 @@
+package arbitrage
+
+import (
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/router"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswaptest"
+)
+
+const (
+	weth = "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+	usdc = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	dai  = "0x6b175474e89094c44da98b954eedeac495271d0f"
+)
+
+// In this snapshot DAI trades at 1.05 USDC, so WETH -> DAI -> USDC -> WETH is profitable.
+func mispricedPairs() []uniswap.PairData {
+	return []uniswap.PairData{
+		uniswaptest.Pair("0xweth-usdc", usdc, weth, "2000000", "1000"),
+		uniswaptest.Pair("0xusdc-dai", usdc, dai, "1050000", "1000000"),
+		uniswaptest.Pair("0xweth-dai", dai, weth, "2000000", "1000"),
+	}
+}
+
+func TestDetectFindsProfitableTriangle(t *testing.T) {
+	graph := router.NewGraph()
+	if err := graph.Upsert(mispricedPairs()); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	detector := NewDetector(graph)
+	detector.StartTokens = []string{weth}
+
+	cycles := detector.Detect()
+	if len(cycles) != 1 {
+		t.Fatalf("Expected one profitable cycle, got %d", len(cycles))
+	}
+	cycle := cycles[0]
+	expectedPairs := []string{"0xweth-dai", "0xusdc-dai", "0xweth-usdc"}
+	for i := range expectedPairs {
+		if cycle.Pairs[i] != expectedPairs[i] {
+			t.Fatalf("Unexpected cycle %v", cycle.Pairs)
+		}
+	}
+	if cycle.RateProduct <= 1 || cycle.Profit <= 0 {
+		t.Errorf("Expected a profitable cycle, got %+v", cycle)
+	}
+
+	// The closed-form optimum must beat nearby input sizes.
+	for _, factor := range []float64{0.8, 1.2} {
+		route, err := router.NewRouter(graph, 3).Quote(weth, cycle.Pairs, cycle.OptimalIn*factor)
+		if err != nil {
+			t.Fatalf("Quote failed: %v", err)
+		}
+		if profit := route.AmountOut - route.AmountIn; profit > cycle.Profit {
+			t.Errorf("Input %f yields %f, more than the optimum %f", route.AmountIn, profit, cycle.Profit)
+		}
+	}
+}
+
+func TestDetectReportsEachCycleOnce(t *testing.T) {
+	graph := router.NewGraph()
+	if err := graph.Upsert(mispricedPairs()); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if cycles := NewDetector(graph).Detect(); len(cycles) != 1 {
+		t.Errorf("Expected one canonical cycle, got %d", len(cycles))
+	}
+}
+
+func TestDetectAtBlockPinsQueries(t *testing.T) {
+	var blocks []int
+	source := func(args map[string]interface{}) (*[]uniswap.PairData, error) {
+		block := args["block"].(map[string]interface{})["number"].(int)
+		blocks = append(blocks, block)
+		pairs := mispricedPairs()
+		if block == 100 {
+			pairs = pairs[:2]
+		}
+		return &pairs, nil
+	}
+
+	results, err := Backtest(source, []int{100, 200}, 10, Detector{MaxLength: 3})
+	if err != nil {
+		t.Fatalf("Backtest failed: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0] != 100 || blocks[1] != 200 {
+		t.Errorf("Expected one query per block, got %v", blocks)
+	}
+	if len(results[100]) != 0 || len(results[200]) != 1 || results[200][0].Block != 200 {
+		t.Errorf("Unexpected backtest results: %+v", results)
+	}
+}
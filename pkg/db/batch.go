@@ -0,0 +1,206 @@
+package db
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	influxdbV2 "github.com/influxdata/influxdb-client-go/v2"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+)
+
+// BatchOptions configures the non-blocking write path of a Client.
+type BatchOptions struct {
+	// BatchSize is the number of points sent in one request.
+	BatchSize uint
+	// FlushInterval is the longest a point waits in the buffer before it is sent.
+	FlushInterval time.Duration
+	// MaxRetries is how many times a failed batch is retried before it is
+	// reported as dropped.
+	MaxRetries uint
+	// ErrorBuffer is the capacity of the Errors channel.
+	ErrorBuffer int
+}
+
+// DefaultBatchOptions suits backfills: large batches, flushed every second.
+func DefaultBatchOptions() BatchOptions {
+	return BatchOptions{
+		BatchSize:     5000,
+		FlushInterval: time.Second,
+		MaxRetries:    5,
+		ErrorBuffer:   100,
+	}
+}
+
+// BatchError reports a failed write of one batch. Batch holds the points in
+// line protocol so the caller can log or replay them. Dropped is set once
+// the batch will not be retried any more.
+type BatchError struct {
+	Batch         string
+	Err           error
+	RetryAttempts uint
+	Dropped       bool
+}
+
+func (e BatchError) Error() string {
+	if e.Dropped {
+		return fmt.Sprintf("batch dropped after %d retries: %v", e.RetryAttempts, e.Err)
+	}
+	return "batch write failed: " + e.Err.Error()
+}
+
+// BatchStats counts batch failures since the client was created.
+type BatchStats struct {
+	Failed  uint64
+	Dropped uint64
+	// Unreported counts failures that could not be sent to Errors because
+	// its buffer was full.
+	Unreported uint64
+}
+
+// batchState is the part of a Client only used by the non-blocking write path.
+type batchState struct {
+	options BatchOptions
+	errors  chan BatchError
+
+	mu    sync.Mutex
+	stats BatchStats
+}
+
+// NewBatchClient returns a Client whose WriteDataAsync and WritePointsAsync
+// buffer points and send them in batches from a background goroutine. The
+// blocking WriteData path stays available. Failed batches are reported on
+// Errors; Close flushes whatever is still buffered.
+func NewBatchClient(baseURL, token, org, bucket string, options BatchOptions) (*Client, error) {
+	defaults := DefaultBatchOptions()
+	if options.BatchSize == 0 {
+		options.BatchSize = defaults.BatchSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = defaults.FlushInterval
+	}
+	if options.ErrorBuffer <= 0 {
+		options.ErrorBuffer = defaults.ErrorBuffer
+	}
+
+	influxOptions := influxdbV2.DefaultOptions().
+		SetBatchSize(options.BatchSize).
+		SetFlushInterval(uint(options.FlushInterval / time.Millisecond)).
+		SetMaxRetries(options.MaxRetries)
+	client := influxdbV2.NewClientWithOptions(baseURL, token, influxOptions)
+
+	c := &Client{
+		Client:   client,
+		WriteAPI: client.WriteAPIBlocking(org, bucket),
+		QueryAPI: client.QueryAPI(org),
+		Org:      org,
+		Bucket:   bucket,
+		batch: &batchState{
+			options: options,
+			errors:  make(chan BatchError, options.ErrorBuffer),
+		},
+	}
+	c.BatchAPI = client.WriteAPI(org, bucket)
+	c.BatchAPI.SetWriteFailedCallback(c.batch.writeFailed)
+	go c.batch.watch(c.BatchAPI.Errors())
+	return c, nil
+}
+
+// WriteDataAsync queues one point. It returns immediately; failures are
+// reported on Errors. Clients created with NewClient have no batched path and
+// write the point synchronously, returning the error instead.
+func (c *Client) WriteDataAsync(measurement string, tags map[string]string, fields map[string]interface{}, time time.Time) error {
+	if c.BatchAPI == nil {
+		return c.WriteData(measurement, tags, fields, time)
+	}
+	c.BatchAPI.WritePoint(influxdbV2.NewPoint(measurement, tags, fields, time))
+	return nil
+}
+
+// WritePointsAsync queues points on the batched write path. Like
+// WriteDataAsync it only returns an error for clients created with NewClient,
+// stopping at the first point that fails.
+func (c *Client) WritePointsAsync(points []Point) error {
+	for _, point := range points {
+		if err := c.WriteDataAsync(point.Measurement, point.Tags, point.fieldsWithKey(), point.Time); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush sends the buffered points and waits until they are written or have
+// failed. It does nothing for clients created with NewClient.
+func (c *Client) Flush() {
+	if c.BatchAPI != nil {
+		c.BatchAPI.Flush()
+	}
+}
+
+// Errors returns the channel failed batches are reported on. It is nil for
+// clients created with NewClient. The channel is never closed.
+func (c *Client) Errors() <-chan BatchError {
+	if c.batch == nil {
+		return nil
+	}
+	return c.batch.errors
+}
+
+// BatchStats returns the failure counters of the batched write path.
+func (c *Client) BatchStats() BatchStats {
+	if c.batch == nil {
+		return BatchStats{}
+	}
+	c.batch.mu.Lock()
+	defer c.batch.mu.Unlock()
+	return c.batch.stats
+}
+
+// writeFailed is called by the influx client when a batch fails with a
+// retryable error (a network error, 429 or 5xx). It reports the failure and
+// lets the batch be retried until MaxRetries is reached.
+func (b *batchState) writeFailed(batch string, err http2.Error, retryAttempts uint) bool {
+	retry := retryAttempts < b.options.MaxRetries
+	b.report(BatchError{
+		Batch:         batch,
+		Err:           &err,
+		RetryAttempts: retryAttempts,
+		Dropped:       !retry,
+	})
+	return retry
+}
+
+// watch reads the errors returned by the influx client. Retryable failures
+// were already reported by writeFailed; anything else, such as a 400 for a
+// malformed point, means the batch was discarded without a retry. The influx
+// client does not hand those batches back, so Batch is empty.
+func (b *batchState) watch(errors <-chan error) {
+	for err := range errors {
+		var httpErr *http2.Error
+		if stderrors.As(err, &httpErr) && retryable(httpErr.StatusCode) && b.options.MaxRetries > 0 {
+			continue
+		}
+		b.report(BatchError{Err: err, Dropped: true})
+	}
+}
+
+func (b *batchState) report(failure BatchError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Failed++
+	if failure.Dropped {
+		b.stats.Dropped++
+	}
+	select {
+	case b.errors <- failure:
+	default:
+		b.stats.Unreported++
+	}
+}
+
+// retryable mirrors the influx client's own rule for which failures it retries.
+func retryable(status int) bool {
+	return status == 0 || status >= http.StatusTooManyRequests
+}
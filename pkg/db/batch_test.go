@@ -0,0 +1,98 @@
+package db
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchClientWritesBatches(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := NewBatchClient(server.URL, "token", "org", "bucket", BatchOptions{BatchSize: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewBatchClient failed: %v", err)
+	}
+	base := time.Unix(1680000000, 0)
+	for i := 0; i < 3; i++ {
+		client.WriteDataAsync("swap", map[string]string{"pair": "0xa"}, map[string]interface{}{"amount_usd": float64(i)}, base.Add(time.Duration(i)*time.Second))
+	}
+	client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	lines := 0
+	for _, body := range requests {
+		lines += len(strings.Split(strings.TrimSpace(body), "\n"))
+	}
+	if lines != 3 {
+		t.Errorf("Unexpected number of lines written: got %d, want 3 (requests %q)", lines, requests)
+	}
+	if stats := client.BatchStats(); stats.Failed != 0 {
+		t.Errorf("Unexpected failures: %+v", stats)
+	}
+}
+
+func TestBatchClientReportsDroppedBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"code":"invalid","message":"invalid field type"}`)
+	}))
+	defer server.Close()
+
+	client, err := NewBatchClient(server.URL, "token", "org", "bucket", BatchOptions{BatchSize: 10, FlushInterval: time.Hour, MaxRetries: 3})
+	if err != nil {
+		t.Fatalf("NewBatchClient failed: %v", err)
+	}
+	defer client.Close()
+	client.WriteDataAsync("swap", map[string]string{"pair": "0xa"}, map[string]interface{}{"amount_usd": 1.0}, time.Unix(1680000000, 0))
+	client.Flush()
+
+	select {
+	case failure := <-client.Errors():
+		if !failure.Dropped {
+			t.Errorf("Unexpected retry of a 400 response: %+v", failure)
+		}
+		if !strings.Contains(failure.Error(), "invalid field type") {
+			t.Errorf("Unexpected error: %v", failure)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No batch error reported")
+	}
+	if stats := client.BatchStats(); stats.Dropped != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestWriteDataAsyncReturnsErrorsWithoutBatching(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"code":"invalid","message":"invalid field type"}`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "token", "org", "bucket")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close()
+	err = client.WriteDataAsync("swap", map[string]string{"pair": "0xa"}, map[string]interface{}{"amount_usd": 1.0}, time.Unix(1680000000, 0))
+	if err == nil || !strings.Contains(err.Error(), "invalid field type") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+// Aggregate functions accepted by AggregateWindow.
+const (
+	AggregateMean  = "mean"
+	AggregateSum   = "sum"
+	AggregateLast  = "last"
+	AggregateFirst = "first"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateCount = "count"
+)
+
+// FluxQuery builds the Flux queries we run most often: a time range over one
+// bucket, filtered by measurement, tags and fields, optionally windowed and
+// pivoted so each row holds every field of one point. Values are quoted, so
+// tag values coming from the subgraph are safe to pass in.
+//
+//	flux := db.NewFluxQuery("uniswap").
+//		Range(start, end).
+//		Measurement("swap").
+//		Tag("pair", pairID).
+//		Fields("amount_usd").
+//		AggregateWindow(time.Hour, db.AggregateSum, false).
+//		String()
+type FluxQuery struct {
+	bucket  string
+	start   time.Time
+	stop    time.Time
+	filters []string
+	window  string
+	pivot   bool
+	sortBy  []string
+	desc    bool
+	limit   int
+}
+
+func NewFluxQuery(bucket string) *FluxQuery {
+	return &FluxQuery{bucket: bucket}
+}
+
+// FluxQuery starts a query on the client's bucket.
+func (c *Client) FluxQuery() *FluxQuery {
+	return NewFluxQuery(c.Bucket)
+}
+
+// Range sets start <= _time < stop. A zero start means the epoch and a zero
+// stop means now().
+func (q *FluxQuery) Range(start, stop time.Time) *FluxQuery {
+	q.start, q.stop = start, stop
+	return q
+}
+
+func (q *FluxQuery) Measurement(measurement string) *FluxQuery {
+	return q.filter("_measurement", measurement)
+}
+
+func (q *FluxQuery) Tag(key, value string) *FluxQuery {
+	return q.filter(key, value)
+}
+
+// Tags adds one filter per entry, in key order so the query text is stable.
+func (q *FluxQuery) Tags(tags map[string]string) *FluxQuery {
+	for _, k := range sortedKeys(tags) {
+		q.filter(k, tags[k])
+	}
+	return q
+}
+
+// Fields keeps only the given fields.
+func (q *FluxQuery) Fields(fields ...string) *FluxQuery {
+	if len(fields) == 0 {
+		return q
+	}
+	conditions := make([]string, len(fields))
+	for i, field := range fields {
+		conditions[i] = fmt.Sprintf(`r._field == %s`, strconv.Quote(field))
+	}
+	q.filters = append(q.filters, fmt.Sprintf(`filter(fn: (r) => %s)`, strings.Join(conditions, " or ")))
+	return q
+}
+
+// AggregateWindow aggregates each series into windows of every with fn, one
+// of the Aggregate constants. With createEmpty, windows without data are
+// kept with a null value.
+func (q *FluxQuery) AggregateWindow(every time.Duration, fn string, createEmpty bool) *FluxQuery {
+	q.window = fmt.Sprintf(`aggregateWindow(every: %s, fn: %s, createEmpty: %t)`, fluxDuration(every), fn, createEmpty)
+	return q
+}
+
+// Pivot turns the field rows InfluxDB returns into one row per series and
+// timestamp, with a column per field.
+func (q *FluxQuery) Pivot() *FluxQuery {
+	q.pivot = true
+	return q
+}
+
+// Sort orders the rows by the given columns.
+func (q *FluxQuery) Sort(desc bool, columns ...string) *FluxQuery {
+	q.sortBy, q.desc = columns, desc
+	return q
+}
+
+// Limit keeps at most n rows per table.
+func (q *FluxQuery) Limit(n int) *FluxQuery {
+	q.limit = n
+	return q
+}
+
+func (q *FluxQuery) filter(key, value string) *FluxQuery {
+	q.filters = append(q.filters, fmt.Sprintf(`filter(fn: (r) => r[%s] == %s)`, strconv.Quote(key), strconv.Quote(value)))
+	return q
+}
+
+// String returns the Flux text.
+func (q *FluxQuery) String() string {
+	stages := []string{
+		fmt.Sprintf(`from(bucket: %s)`, strconv.Quote(q.bucket)),
+		fmt.Sprintf(`range(start: %s, stop: %s)`, fluxTime(q.start), fluxStop(q.stop)),
+	}
+	stages = append(stages, q.filters...)
+	if q.window != "" {
+		stages = append(stages, q.window)
+	}
+	if q.pivot {
+		stages = append(stages, `pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")`)
+	}
+	if len(q.sortBy) > 0 {
+		columns := make([]string, len(q.sortBy))
+		for i, column := range q.sortBy {
+			columns[i] = strconv.Quote(column)
+		}
+		stages = append(stages, fmt.Sprintf(`sort(columns: [%s], desc: %t)`, strings.Join(columns, ", "), q.desc))
+	}
+	if q.limit > 0 {
+		stages = append(stages, fmt.Sprintf(`limit(n: %d)`, q.limit))
+	}
+	return strings.Join(stages, " |> ")
+}
+
+func fluxTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func fluxStop(t time.Time) string {
+	if t.IsZero() {
+		return "now()"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// fluxDuration writes d as a Flux duration literal, which has no fractions.
+func fluxDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	return strconv.FormatInt(int64(d), 10) + "ns"
+}
+
+// Records is the part of api.QueryTableResult the decoders use.
+type Records interface {
+	Next() bool
+	Record() *query.FluxRecord
+	Err() error
+}
+
+// Sample is one value of a series, as returned by an aggregateWindow query.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// DecodeRows returns the column values of every row.
+func DecodeRows(records Records) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	for records.Next() {
+		rows = append(rows, records.Record().Values())
+	}
+	return rows, records.Err()
+}
+
+// DecodeSamples returns the _time and _value of every row, in result order. Rows with a null
+// value, from windows created empty, are skipped.
+func DecodeSamples(records Records) ([]Sample, error) {
+	var samples []Sample
+	for records.Next() {
+		record := records.Record()
+		if record.Value() == nil {
+			continue
+		}
+		value, err := toFloat(record.Value())
+		if err != nil {
+			return nil, fmt.Errorf("_value: %v", err)
+		}
+		t, _ := record.ValueByKey("_time").(time.Time)
+		samples = append(samples, Sample{Time: t, Value: value})
+	}
+	if records.Err() != nil {
+		return nil, records.Err()
+	}
+	return samples, nil
+}
+
+// Decode appends one struct per row to the slice out points to. Columns are
+// matched to exported fields by their `flux:"column"` tag, or by name,
+// ignoring case. Numbers are converted between int, uint and float kinds;
+// null values leave the field at its zero value. Use it on pivoted queries:
+//
+//	type swapRow struct {
+//		Time      time.Time `flux:"_time"`
+//		Pair      string    `flux:"pair"`
+//		AmountUSD float64   `flux:"amount_usd"`
+//	}
+//	var rows []swapRow
+//	err := db.Decode(result, &rows)
+func Decode(records Records, out interface{}) error {
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("decode: expected a pointer to a slice, got %T", out)
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	pointer := elemType.Kind() == reflect.Ptr
+	if pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("decode: expected a slice of structs, got %T", out)
+	}
+	columns := structColumns(elemType)
+
+	for records.Next() {
+		item := reflect.New(elemType).Elem()
+		for column, value := range records.Record().Values() {
+			index, ok := columns[strings.ToLower(column)]
+			if !ok || value == nil {
+				continue
+			}
+			if err := setField(item.Field(index), value); err != nil {
+				return fmt.Errorf("decode column %s: %v", column, err)
+			}
+		}
+		if pointer {
+			item = item.Addr()
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+	return records.Err()
+}
+
+// QueryInto runs q and decodes the rows into out, see Decode.
+func (c *Client) QueryInto(q *FluxQuery, out interface{}) error {
+	result, err := c.QueryData(q.String())
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	return Decode(result, out)
+}
+
+// QuerySamples runs q and decodes it with DecodeSamples.
+func (c *Client) QuerySamples(q *FluxQuery) ([]Sample, error) {
+	result, err := c.QueryData(q.String())
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	return DecodeSamples(result)
+}
+
+// structColumns maps lowercased column names to field indexes.
+func structColumns(t reflect.Type) map[string]int {
+	columns := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("flux"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		columns[strings.ToLower(name)] = i
+	}
+	return columns
+}
+
+func setField(field reflect.Value, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(field.Type()) {
+		field.Set(v)
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(value)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := value.(type) {
+		case int64:
+			field.SetInt(n)
+		case uint64:
+			field.SetInt(int64(n))
+		default:
+			return fmt.Errorf("cannot assign %T to %s", value, field.Type())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch n := value.(type) {
+		case uint64:
+			field.SetUint(n)
+		case int64:
+			if n < 0 {
+				return fmt.Errorf("cannot assign %d to %s", n, field.Type())
+			}
+			field.SetUint(uint64(n))
+		default:
+			return fmt.Errorf("cannot assign %T to %s", value, field.Type())
+		}
+	case reflect.String:
+		field.SetString(fmt.Sprint(value))
+	default:
+		return fmt.Errorf("cannot assign %T to %s", value, field.Type())
+	}
+	return nil
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch n := value.(type) {
+	case float64:
+		return n, nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to float64", value)
+	}
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+func TestFluxQueryString(t *testing.T) {
+	start := time.Unix(1680000000, 0)
+	flux := NewFluxQuery("uniswap").
+		Range(start, start.Add(24*time.Hour)).
+		Measurement("swap").
+		Tags(map[string]string{"token1": "0xb", "pair": `0x"a`}).
+		Fields("amount_usd", "amount0_in").
+		AggregateWindow(time.Hour, AggregateSum, false).
+		Pivot().
+		Sort(true, "_time").
+		Limit(10).
+		String()
+
+	expected := `from(bucket: "uniswap")` +
+		` |> range(start: 2023-03-28T10:40:00Z, stop: 2023-03-29T10:40:00Z)` +
+		` |> filter(fn: (r) => r["_measurement"] == "swap")` +
+		` |> filter(fn: (r) => r["pair"] == "0x\"a")` +
+		` |> filter(fn: (r) => r["token1"] == "0xb")` +
+		` |> filter(fn: (r) => r._field == "amount_usd" or r._field == "amount0_in")` +
+		` |> aggregateWindow(every: 3600s, fn: sum, createEmpty: false)` +
+		` |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")` +
+		` |> sort(columns: ["_time"], desc: true)` +
+		` |> limit(n: 10)`
+	if flux != expected {
+		t.Errorf("Unexpected query:\n got: %s\nwant: %s", flux, expected)
+	}
+
+	if flux := NewFluxQuery("uniswap").String(); flux != `from(bucket: "uniswap") |> range(start: 0, stop: now())` {
+		t.Errorf("Unexpected default range: %s", flux)
+	}
+}
+
+// fakeRecords replays records as if they came from a query result.
+type fakeRecords struct {
+	records []*query.FluxRecord
+	i       int
+}
+
+func (f *fakeRecords) Next() bool {
+	f.i++
+	return f.i <= len(f.records)
+}
+
+func (f *fakeRecords) Record() *query.FluxRecord { return f.records[f.i-1] }
+
+func (f *fakeRecords) Err() error { return nil }
+
+func TestDecode(t *testing.T) {
+	base := time.Unix(1680000000, 0).UTC()
+	records := &fakeRecords{records: []*query.FluxRecord{
+		query.NewFluxRecord(0, map[string]interface{}{"_time": base, "pair": "0xa", "amount_usd": 12.5, "log_index": int64(3), "block": int64(17000000)}),
+		query.NewFluxRecord(0, map[string]interface{}{"_time": base.Add(time.Hour), "pair": "0xa", "amount_usd": int64(7), "log_index": nil, "result": "_result"}),
+	}}
+	type swapRow struct {
+		Time      time.Time `flux:"_time"`
+		Pair      string
+		AmountUSD float64 `flux:"amount_usd"`
+		LogIndex  int     `flux:"log_index"`
+		Block     uint64  `flux:"block"`
+		Ignored   string  `flux:"-"`
+	}
+	var rows []swapRow
+	if err := Decode(records, &rows); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Unexpected number of rows: %d", len(rows))
+	}
+	if rows[0].Pair != "0xa" || rows[0].AmountUSD != 12.5 || rows[0].LogIndex != 3 || rows[0].Block != 17000000 || !rows[0].Time.Equal(base) {
+		t.Errorf("Unexpected first row: %+v", rows[0])
+	}
+	if rows[1].AmountUSD != 7 || rows[1].LogIndex != 0 {
+		t.Errorf("Unexpected second row: %+v", rows[1])
+	}
+
+	var wrong []int
+	if err := Decode(&fakeRecords{}, &wrong); err == nil {
+		t.Errorf("Expected an error decoding into []int")
+	}
+}
+
+func TestDecodeSamples(t *testing.T) {
+	base := time.Unix(1680000000, 0).UTC()
+	records := &fakeRecords{records: []*query.FluxRecord{
+		query.NewFluxRecord(0, map[string]interface{}{"_time": base, "_value": 1.5}),
+		query.NewFluxRecord(0, map[string]interface{}{"_time": base.Add(time.Hour), "_value": nil}),
+		query.NewFluxRecord(0, map[string]interface{}{"_time": base.Add(2 * time.Hour), "_value": int64(4)}),
+	}}
+	samples, err := DecodeSamples(records)
+	if err != nil {
+		t.Fatalf("DecodeSamples failed: %v", err)
+	}
+	expected := []Sample{{Time: base, Value: 1.5}, {Time: base.Add(2 * time.Hour), Value: 4}}
+	if len(samples) != len(expected) {
+		t.Fatalf("Unexpected samples: %+v", samples)
+	}
+	for i := range expected {
+		if !samples[i].Time.Equal(expected[i].Time) || samples[i].Value != expected[i].Value {
+			t.Errorf("Unexpected sample %d: %+v", i, samples[i])
+		}
+	}
+}
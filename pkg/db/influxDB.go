@@ -12,6 +12,12 @@ type Client struct {
 	Client   influxdbV2.Client
 	WriteAPI api.WriteAPIBlocking
 	QueryAPI api.QueryAPI
+	Org      string
+	Bucket   string
+	// BatchAPI is the non-blocking write API, set by NewBatchClient.
+	BatchAPI api.WriteAPI
+
+	batch *batchState
 }
 
 func NewClient(baseURL, token, org, bucket string) (*Client, error) {
@@ -23,6 +29,8 @@ func NewClient(baseURL, token, org, bucket string) (*Client, error) {
 		Client:   client,
 		WriteAPI: writeAPI,
 		QueryAPI: queryAPI,
+		Org:      org,
+		Bucket:   bucket,
 	}, nil
 }
 
@@ -39,6 +47,8 @@ func (c *Client) QueryData(query string) (*api.QueryTableResult, error) {
 	return c.QueryAPI.Query(context.Background(), query)
 }
 
+// Close flushes any buffered points before closing the connection.
 func (c *Client) Close() {
+	c.Flush()
 	c.Client.Close()
 }
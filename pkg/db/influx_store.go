@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	influxdbV2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// checkpointMeasurement holds ingestion checkpoints alongside the data.
+const checkpointMeasurement = "checkpoint"
+
+var _ Store = (*InfluxStore)(nil)
+
+// InfluxStore is the InfluxDB implementation of Store.
+type InfluxStore struct {
+	Client *Client
+}
+
+func NewInfluxStore(client *Client) *InfluxStore {
+	return &InfluxStore{Client: client}
+}
+
+// WritePoints writes points with the blocking API, or queues them when the
+// client was created with NewBatchClient. Queued points fail asynchronously,
+// on the client's Errors channel.
+func (s *InfluxStore) WritePoints(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if s.Client.BatchAPI != nil {
+		s.Client.WritePointsAsync(points)
+		return nil
+	}
+	return s.writeBlocking(points)
+}
+
+func (s *InfluxStore) writeBlocking(points []Point) error {
+	influxPoints := make([]*write.Point, 0, len(points))
+	for _, point := range points {
+		influxPoints = append(influxPoints, influxdbV2.NewPoint(point.Measurement, point.Tags, point.fieldsWithKey(), point.Time))
+	}
+	return s.Client.WriteAPI.WritePoint(context.Background(), influxPoints...)
+}
+
+// ReadSeries queries the raw rows of the measurement and regroups the
+// field rows InfluxDB returns into one Point per series and timestamp.
+func (s *InfluxStore) ReadSeries(query SeriesQuery) ([]Point, error) {
+	flux := s.Client.FluxQuery().
+		Range(query.Start, query.End).
+		Measurement(query.Measurement).
+		Tags(query.Tags)
+
+	result, err := s.Client.QueryData(flux.String())
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var points []Point
+	index := make(map[string]int)
+	for result.Next() {
+		record := result.Record()
+		tags := make(map[string]string)
+		for k, v := range record.Values() {
+			if isSystemColumn(k) {
+				continue
+			}
+			if tag, ok := v.(string); ok {
+				tags[k] = tag
+			}
+		}
+		key := seriesKey(record.Time(), tags)
+		i, ok := index[key]
+		if !ok {
+			i = len(points)
+			index[key] = i
+			points = append(points, Point{
+				Measurement: record.Measurement(),
+				Tags:        tags,
+				Fields:      make(map[string]interface{}),
+				Time:        record.Time(),
+			})
+		}
+		points[i].Fields[record.Field()] = record.Value()
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	for i := range points {
+		if key, ok := points[i].Fields[KeyField].(string); ok {
+			points[i].Key = key
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// predicateEscaper escapes the values quoted in a delete predicate.
+var predicateEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// DeleteSeries deletes through the delete API, which selects by measurement
+// and tags only, so Start and End bound the deletion and an unset End means
+// up to now.
+func (s *InfluxStore) DeleteSeries(query SeriesQuery) error {
+	s.Client.Flush()
+	predicate := fmt.Sprintf(`_measurement="%s"`, predicateEscaper.Replace(query.Measurement))
+	for _, k := range sortedKeys(query.Tags) {
+		predicate += fmt.Sprintf(` AND %s="%s"`, k, predicateEscaper.Replace(query.Tags[k]))
+	}
+	start, end := query.Start, query.End
+	if start.IsZero() {
+		start = time.Unix(0, 0)
+	}
+	if end.IsZero() {
+		end = time.Now().Add(time.Minute)
+	}
+	// The delete API's stop is inclusive, ReadSeries' End is not.
+	end = end.Add(-time.Nanosecond)
+	return s.Client.Client.DeleteAPI().DeleteWithName(context.Background(), s.Client.Org, s.Client.Bucket, start, end, predicate)
+}
+
+func (s *InfluxStore) GetCheckpoint(key string) (*Checkpoint, error) {
+	points, err := s.ReadSeries(SeriesQuery{
+		Measurement: checkpointMeasurement,
+		Tags:        map[string]string{"key": key},
+		Start:       time.Unix(0, 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, ErrNotFound
+	}
+	latest := points[len(points)-1]
+	checkpoint := &Checkpoint{Key: key, UpdatedAt: latest.Time}
+	if v, ok := latest.Fields["timestamp"].(int64); ok {
+		checkpoint.Timestamp = v
+	}
+	if v, ok := latest.Fields["last_id"].(string); ok {
+		checkpoint.LastID = v
+	}
+	if v, ok := latest.Fields["block"].(int64); ok {
+		checkpoint.Block = v
+	}
+	if v, ok := latest.Fields["block_hash"].(string); ok {
+		checkpoint.BlockHash = v
+	}
+	if v, ok := latest.Fields["confirmed"].(int64); ok {
+		checkpoint.Confirmed = v
+	}
+	return checkpoint, nil
+}
+
+// SetCheckpoint flushes queued points first so a checkpoint is never stored
+// ahead of the data it covers.
+func (s *InfluxStore) SetCheckpoint(checkpoint Checkpoint) error {
+	if checkpoint.UpdatedAt.IsZero() {
+		checkpoint.UpdatedAt = time.Now()
+	}
+	s.Client.Flush()
+	return s.writeBlocking([]Point{{
+		Measurement: checkpointMeasurement,
+		Tags:        map[string]string{"key": checkpoint.Key},
+		Fields: map[string]interface{}{
+			"timestamp":  checkpoint.Timestamp,
+			"last_id":    checkpoint.LastID,
+			"block":      checkpoint.Block,
+			"block_hash": checkpoint.BlockHash,
+			"confirmed":  checkpoint.Confirmed,
+		},
+		Time: checkpoint.UpdatedAt,
+	}})
+}
+
+func (s *InfluxStore) Close() error {
+	s.Client.Close()
+	return nil
+}
+
+func isSystemColumn(name string) bool {
+	return strings.HasPrefix(name, "_") || name == "result" || name == "table"
+}
+
+func seriesKey(t time.Time, tags map[string]string) string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	for _, k := range sortedKeys(tags) {
+		b.WriteString(",")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
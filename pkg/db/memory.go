@@ -0,0 +1,112 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is an in-memory Store for tests and local experiments.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	points      map[string][]Point
+	index       map[string]map[string]int
+	checkpoints map[string]Checkpoint
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		points:      make(map[string][]Point),
+		index:       make(map[string]map[string]int),
+		checkpoints: make(map[string]Checkpoint),
+	}
+}
+
+func (m *MemoryStore) WritePoints(points []Point) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, point := range points {
+		point.Fields = point.fieldsWithKey()
+		index, ok := m.index[point.Measurement]
+		if !ok {
+			index = make(map[string]int)
+			m.index[point.Measurement] = index
+		}
+		if i, ok := index[point.identity()]; ok {
+			m.points[point.Measurement][i] = copyPoint(point)
+			continue
+		}
+		index[point.identity()] = len(m.points[point.Measurement])
+		m.points[point.Measurement] = append(m.points[point.Measurement], copyPoint(point))
+	}
+	return nil
+}
+
+func (m *MemoryStore) ReadSeries(query SeriesQuery) ([]Point, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var points []Point
+	for _, point := range m.points[query.Measurement] {
+		if query.matches(point) {
+			points = append(points, copyPoint(point))
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+func (m *MemoryStore) DeleteSeries(query SeriesQuery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.points[query.Measurement][:0]
+	index := make(map[string]int)
+	for _, point := range m.points[query.Measurement] {
+		if query.matches(point) {
+			continue
+		}
+		index[point.identity()] = len(kept)
+		kept = append(kept, point)
+	}
+	m.points[query.Measurement] = kept
+	m.index[query.Measurement] = index
+	return nil
+}
+
+func (m *MemoryStore) GetCheckpoint(key string) (*Checkpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	checkpoint, ok := m.checkpoints[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &checkpoint, nil
+}
+
+func (m *MemoryStore) SetCheckpoint(checkpoint Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if checkpoint.UpdatedAt.IsZero() {
+		checkpoint.UpdatedAt = time.Now()
+	}
+	m.checkpoints[checkpoint.Key] = checkpoint
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// copyPoint keeps callers from mutating stored points through shared maps.
+func copyPoint(point Point) Point {
+	tags := make(map[string]string, len(point.Tags))
+	for k, v := range point.Tags {
+		tags[k] = v
+	}
+	fields := make(map[string]interface{}, len(point.Fields))
+	for k, v := range point.Fields {
+		fields[k] = v
+	}
+	return Point{Measurement: point.Measurement, Tags: tags, Fields: fields, Time: point.Time, Key: point.Key}
+}
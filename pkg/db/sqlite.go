@@ -0,0 +1,736 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var _ Store = (*SQLiteStore)(nil)
+
+// SQLiteStore is a Store in a local SQLite file, for running without an
+// InfluxDB server and for integration tests (open ":memory:").
+//
+// The measurements written by pkg/ingest get typed tables (pairs, tokens,
+// swaps, mints, burns, token_days, pair_days) with a column per tag and
+// field and indexes on (pair or token, time). Tags or fields a table has no
+// column for are kept as JSON in its extra column, so every Point reads back
+// as written. Other measurements go to the generic points table.
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+// NewSQLiteStore opens or creates the database at path and applies any
+// pending migrations.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	conn, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and every connection to ":memory:"
+	// would get its own empty database.
+	conn.SetMaxOpenConns(1)
+	store := &SQLiteStore{DB: conn}
+	if err := store.migrate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// sqliteMigrations are applied in order and recorded in schema_migrations.
+// Never edit one that has shipped; append a new one instead.
+var sqliteMigrations = []string{
+	// 1: initial schema.
+	`
+	CREATE TABLE pairs (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		pair TEXT, token0 TEXT, token1 TEXT, symbol TEXT,
+		reserve0 REAL, reserve1 REAL, reserve_usd REAL, volume_usd REAL, tx_count INTEGER,
+		extra TEXT
+	);
+	CREATE INDEX pairs_pair_time ON pairs (pair, time);
+
+	CREATE TABLE tokens (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		token TEXT, symbol TEXT,
+		name TEXT, derived_eth REAL,
+		extra TEXT
+	);
+	CREATE INDEX tokens_token_time ON tokens (token, time);
+
+	CREATE TABLE swaps (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		pair TEXT, token0 TEXT, token1 TEXT, symbol TEXT,
+		"transaction" TEXT, block INTEGER, log_index INTEGER,
+		amount0_in REAL, amount0_out REAL, amount1_in REAL, amount1_out REAL, amount_usd REAL,
+		"to" TEXT, sender TEXT, "from" TEXT,
+		extra TEXT
+	);
+	CREATE INDEX swaps_pair_time ON swaps (pair, time);
+	CREATE INDEX swaps_block ON swaps (block);
+
+	CREATE TABLE mints (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		pair TEXT, token0 TEXT, token1 TEXT, symbol TEXT,
+		"transaction" TEXT, block INTEGER, log_index INTEGER,
+		liquidity REAL, amount0 REAL, amount1 REAL, amount_usd REAL, "to" TEXT,
+		extra TEXT
+	);
+	CREATE INDEX mints_pair_time ON mints (pair, time);
+
+	CREATE TABLE burns (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		pair TEXT, token0 TEXT, token1 TEXT, symbol TEXT,
+		"transaction" TEXT, block INTEGER, log_index INTEGER,
+		liquidity REAL, amount0 REAL, amount1 REAL, amount_usd REAL, "to" TEXT,
+		extra TEXT
+	);
+	CREATE INDEX burns_pair_time ON burns (pair, time);
+
+	CREATE TABLE token_days (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		token TEXT,
+		price_usd REAL, total_liquidity REAL, total_liquidity_usd REAL, total_liquidity_eth REAL,
+		daily_volume REAL, daily_volume_usd REAL, daily_volume_eth REAL,
+		extra TEXT
+	);
+	CREATE INDEX token_days_token_time ON token_days (token, time);
+
+	CREATE TABLE pair_days (
+		identity TEXT PRIMARY KEY, id TEXT, time INTEGER NOT NULL,
+		pair TEXT,
+		reserve0 REAL, reserve1 REAL, reserve_usd REAL,
+		daily_volume_token0 REAL, daily_volume_token1 REAL, daily_volume_usd REAL,
+		extra TEXT
+	);
+	CREATE INDEX pair_days_pair_time ON pair_days (pair, time);
+
+	CREATE TABLE points (
+		measurement TEXT NOT NULL, identity TEXT NOT NULL, id TEXT, time INTEGER NOT NULL,
+		tags TEXT NOT NULL, fields TEXT NOT NULL,
+		PRIMARY KEY (measurement, identity)
+	);
+	CREATE INDEX points_measurement_time ON points (measurement, time);
+
+	CREATE TABLE checkpoints (
+		key TEXT PRIMARY KEY, timestamp INTEGER NOT NULL, last_id TEXT NOT NULL, updated_at INTEGER NOT NULL
+	);
+	`,
+	// 2: block of the subgraph head in checkpoints, for reorg detection.
+	`
+	ALTER TABLE checkpoints ADD COLUMN block INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE checkpoints ADD COLUMN block_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE checkpoints ADD COLUMN confirmed INTEGER NOT NULL DEFAULT 0;
+	`,
+}
+
+type sqliteColumn struct {
+	name string
+	kind string // "REAL", "INTEGER" or "TEXT"
+}
+
+// sqliteTable describes the typed table of one measurement. It must match
+// the columns created by sqliteMigrations.
+type sqliteTable struct {
+	name   string
+	tags   []string
+	fields []sqliteColumn
+}
+
+func realColumns(names ...string) []sqliteColumn    { return columns("REAL", names) }
+func integerColumns(names ...string) []sqliteColumn { return columns("INTEGER", names) }
+func textColumns(names ...string) []sqliteColumn    { return columns("TEXT", names) }
+
+func columns(kind string, names []string) []sqliteColumn {
+	out := make([]sqliteColumn, len(names))
+	for i, name := range names {
+		out[i] = sqliteColumn{name: name, kind: kind}
+	}
+	return out
+}
+
+func concat(groups ...[]sqliteColumn) []sqliteColumn {
+	var out []sqliteColumn
+	for _, group := range groups {
+		out = append(out, group...)
+	}
+	return out
+}
+
+// sqliteTables is keyed by the measurement names used in pkg/ingest.
+var sqliteTables = map[string]sqliteTable{
+	"pair": {
+		name:   "pairs",
+		tags:   []string{"pair", "token0", "token1", "symbol"},
+		fields: concat(realColumns("reserve0", "reserve1", "reserve_usd", "volume_usd"), integerColumns("tx_count")),
+	},
+	"token": {
+		name:   "tokens",
+		tags:   []string{"token", "symbol"},
+		fields: concat(textColumns("name"), realColumns("derived_eth")),
+	},
+	"swap": {
+		name: "swaps",
+		tags: []string{"pair", "token0", "token1", "symbol"},
+		fields: concat(textColumns("transaction"), integerColumns("block", "log_index"),
+			realColumns("amount0_in", "amount0_out", "amount1_in", "amount1_out", "amount_usd"),
+			textColumns("to", "sender", "from")),
+	},
+	"mint": {
+		name: "mints",
+		tags: []string{"pair", "token0", "token1", "symbol"},
+		fields: concat(textColumns("transaction"), integerColumns("block", "log_index"),
+			realColumns("liquidity", "amount0", "amount1", "amount_usd"), textColumns("to")),
+	},
+	"burn": {
+		name: "burns",
+		tags: []string{"pair", "token0", "token1", "symbol"},
+		fields: concat(textColumns("transaction"), integerColumns("block", "log_index"),
+			realColumns("liquidity", "amount0", "amount1", "amount_usd"), textColumns("to")),
+	},
+	"token_day": {
+		name: "token_days",
+		tags: []string{"token"},
+		fields: realColumns("price_usd", "total_liquidity", "total_liquidity_usd", "total_liquidity_eth",
+			"daily_volume", "daily_volume_usd", "daily_volume_eth"),
+	},
+	"pair_day": {
+		name: "pair_days",
+		tags: []string{"pair"},
+		fields: realColumns("reserve0", "reserve1", "reserve_usd",
+			"daily_volume_token0", "daily_volume_token1", "daily_volume_usd"),
+	},
+}
+
+func (s *SQLiteStore) migrate() error {
+	if _, err := s.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.DB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the number of migrations applied.
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// WritePoints writes all points in one transaction, replacing points with the
+// same identity.
+func (s *SQLiteStore) WritePoints(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	statements := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range statements {
+			stmt.Close()
+		}
+	}()
+	for _, point := range points {
+		table, typed := sqliteTables[point.Measurement]
+		name := "points"
+		if typed {
+			name = table.name
+		}
+		stmt, ok := statements[name]
+		if !ok {
+			query := `INSERT OR REPLACE INTO points (measurement, identity, id, time, tags, fields) VALUES (?, ?, ?, ?, ?, ?)`
+			if typed {
+				query = table.insertSQL()
+			}
+			if stmt, err = tx.Prepare(query); err != nil {
+				tx.Rollback()
+				return err
+			}
+			statements[name] = stmt
+		}
+		var args []interface{}
+		if typed {
+			args, err = table.insertArgs(point)
+		} else {
+			args, err = genericArgs(point)
+		}
+		if err == nil {
+			_, err = stmt.Exec(args...)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("write %s point %s: %v", point.Measurement, point.identity(), err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ReadSeries(query SeriesQuery) ([]Point, error) {
+	table, typed := sqliteTables[query.Measurement]
+	var where []string
+	var args []interface{}
+	if !query.Start.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, query.Start.UnixNano())
+	}
+	if !query.End.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, query.End.UnixNano())
+	}
+
+	var sqlQuery string
+	if typed {
+		for _, k := range sortedKeys(query.Tags) {
+			if table.hasTag(k) {
+				where = append(where, quoteIdent(k)+" = ?")
+				args = append(args, query.Tags[k])
+			}
+		}
+		sqlQuery = table.selectSQL()
+	} else {
+		where = append(where, "measurement = ?")
+		args = append(args, query.Measurement)
+		sqlQuery = `SELECT id, time, tags, fields FROM points`
+	}
+	if len(where) > 0 {
+		sqlQuery += " WHERE " + strings.Join(where, " AND ")
+	}
+	sqlQuery += " ORDER BY time"
+
+	rows, err := s.DB.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []Point
+	for rows.Next() {
+		var point Point
+		if typed {
+			point, err = table.scan(rows)
+		} else {
+			point, err = scanGeneric(rows)
+		}
+		if err != nil {
+			return nil, err
+		}
+		point.Measurement = query.Measurement
+		if point.Key != "" {
+			point.Fields[KeyField] = point.Key
+		}
+		// Tags kept in the extra column can only be filtered here.
+		if query.matches(point) {
+			points = append(points, point)
+		}
+	}
+	return points, rows.Err()
+}
+
+// DeleteSeries deletes the points ReadSeries would return for query, in one
+// transaction.
+func (s *SQLiteStore) DeleteSeries(query SeriesQuery) error {
+	points, err := s.ReadSeries(query)
+	if err != nil || len(points) == 0 {
+		return err
+	}
+	table, typed := sqliteTables[query.Measurement]
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	var stmt *sql.Stmt
+	if typed {
+		stmt, err = tx.Prepare(`DELETE FROM ` + quoteIdent(table.name) + ` WHERE identity = ?`)
+	} else {
+		stmt, err = tx.Prepare(`DELETE FROM points WHERE measurement = ? AND identity = ?`)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, point := range points {
+		if typed {
+			_, err = stmt.Exec(point.identity())
+		} else {
+			_, err = stmt.Exec(query.Measurement, point.identity())
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetCheckpoint(key string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Key: key}
+	var updatedAt int64
+	err := s.DB.QueryRow(`SELECT timestamp, last_id, block, block_hash, confirmed, updated_at FROM checkpoints WHERE key = ?`, key).
+		Scan(&checkpoint.Timestamp, &checkpoint.LastID, &checkpoint.Block, &checkpoint.BlockHash, &checkpoint.Confirmed, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.UpdatedAt = time.Unix(0, updatedAt)
+	return checkpoint, nil
+}
+
+func (s *SQLiteStore) SetCheckpoint(checkpoint Checkpoint) error {
+	if checkpoint.UpdatedAt.IsZero() {
+		checkpoint.UpdatedAt = time.Now()
+	}
+	_, err := s.DB.Exec(`INSERT OR REPLACE INTO checkpoints (key, timestamp, last_id, block, block_hash, confirmed, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		checkpoint.Key, checkpoint.Timestamp, checkpoint.LastID, checkpoint.Block, checkpoint.BlockHash, checkpoint.Confirmed, checkpoint.UpdatedAt.UnixNano())
+	return err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
+
+// columnNames returns the columns of t in insert order.
+func (t sqliteTable) columnNames() []string {
+	names := []string{"id", "time"}
+	names = append(names, t.tags...)
+	for _, field := range t.fields {
+		names = append(names, field.name)
+	}
+	return append(names, "extra")
+}
+
+func (t sqliteTable) insertSQL() string {
+	names := append([]string{"identity"}, t.columnNames()...)
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	return fmt.Sprintf(`INSERT OR REPLACE INTO %s (%s) VALUES (%s)`, t.name, strings.Join(quoted, ", "), placeholders)
+}
+
+func (t sqliteTable) selectSQL() string {
+	names := t.columnNames()
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(quoted, ", "), t.name)
+}
+
+func (t sqliteTable) hasTag(name string) bool {
+	for _, tag := range t.tags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// insertArgs splits point into the typed columns and the extra JSON, in the
+// order of insertSQL.
+func (t sqliteTable) insertArgs(point Point) ([]interface{}, error) {
+	args := []interface{}{point.identity(), nullString(point.Key), point.Time.UnixNano()}
+	extraTags := make(map[string]string)
+	for k, v := range point.Tags {
+		if !t.hasTag(k) {
+			extraTags[k] = v
+		}
+	}
+	for _, tag := range t.tags {
+		if v, ok := point.Tags[tag]; ok {
+			args = append(args, v)
+		} else {
+			args = append(args, nil)
+		}
+	}
+	extraFields := make(map[string]interface{})
+	for k, v := range point.Fields {
+		if k == KeyField && point.Key != "" {
+			continue
+		}
+		extraFields[k] = v
+	}
+	for _, column := range t.fields {
+		value, ok := extraFields[column.name]
+		if !ok {
+			args = append(args, nil)
+			continue
+		}
+		if converted, ok := convertColumn(column.kind, value); ok {
+			args = append(args, converted)
+			delete(extraFields, column.name)
+		} else {
+			// Keep values of an unexpected type in extra rather than lose them.
+			args = append(args, nil)
+		}
+	}
+	extra, err := encodeExtra(extraTags, extraFields)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, extra), nil
+}
+
+func (t sqliteTable) scan(rows *sql.Rows) (Point, error) {
+	var id, extra sql.NullString
+	var nanos int64
+	tags := make([]sql.NullString, len(t.tags))
+	fields := make([]interface{}, len(t.fields))
+	targets := []interface{}{&id, &nanos}
+	for i := range tags {
+		targets = append(targets, &tags[i])
+	}
+	for i, column := range t.fields {
+		switch column.kind {
+		case "REAL":
+			fields[i] = &sql.NullFloat64{}
+		case "INTEGER":
+			fields[i] = &sql.NullInt64{}
+		default:
+			fields[i] = &sql.NullString{}
+		}
+		targets = append(targets, fields[i])
+	}
+	targets = append(targets, &extra)
+	if err := rows.Scan(targets...); err != nil {
+		return Point{}, err
+	}
+
+	point := Point{Key: id.String, Time: time.Unix(0, nanos).UTC(), Tags: make(map[string]string), Fields: make(map[string]interface{})}
+	for i, tag := range t.tags {
+		if tags[i].Valid {
+			point.Tags[tag] = tags[i].String
+		}
+	}
+	for i, column := range t.fields {
+		switch v := fields[i].(type) {
+		case *sql.NullFloat64:
+			if v.Valid {
+				point.Fields[column.name] = v.Float64
+			}
+		case *sql.NullInt64:
+			if v.Valid {
+				point.Fields[column.name] = v.Int64
+			}
+		case *sql.NullString:
+			if v.Valid {
+				point.Fields[column.name] = v.String
+			}
+		}
+	}
+	if err := decodeExtra(extra.String, point.Tags, point.Fields); err != nil {
+		return Point{}, err
+	}
+	return point, nil
+}
+
+func genericArgs(point Point) ([]interface{}, error) {
+	tags, err := json.Marshal(point.Tags)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(point.Fields))
+	for k, v := range point.Fields {
+		if k != KeyField || point.Key == "" {
+			fields[k] = v
+		}
+	}
+	encoded, err := encodeValues(fields)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{point.Measurement, point.identity(), nullString(point.Key), point.Time.UnixNano(), string(tags), encoded}, nil
+}
+
+func scanGeneric(rows *sql.Rows) (Point, error) {
+	var id sql.NullString
+	var nanos int64
+	var tags, fields string
+	if err := rows.Scan(&id, &nanos, &tags, &fields); err != nil {
+		return Point{}, err
+	}
+	point := Point{Key: id.String, Time: time.Unix(0, nanos).UTC(), Tags: make(map[string]string), Fields: make(map[string]interface{})}
+	if err := json.Unmarshal([]byte(tags), &point.Tags); err != nil {
+		return Point{}, err
+	}
+	if err := decodeValues(fields, point.Fields); err != nil {
+		return Point{}, err
+	}
+	return point, nil
+}
+
+// convertColumn converts a field value to the type of its column.
+func convertColumn(kind string, value interface{}) (interface{}, bool) {
+	switch kind {
+	case "REAL":
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		}
+	case "INTEGER":
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case int:
+			return int64(v), true
+		}
+	case "TEXT":
+		if v, ok := value.(string); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// sqliteValue keeps the Go type of a field through JSON, which would turn
+// every number into a float64.
+type sqliteValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+func encodeValues(fields map[string]interface{}) (string, error) {
+	encoded := make(map[string]sqliteValue, len(fields))
+	for k, v := range fields {
+		var kind string
+		switch v.(type) {
+		case float64:
+			kind = "float"
+		case int64, int:
+			kind = "int"
+		case uint64:
+			kind = "uint"
+		case bool:
+			kind = "bool"
+		case string:
+			kind = "string"
+		default:
+			return "", fmt.Errorf("unsupported type %T for field %s", v, k)
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		encoded[k] = sqliteValue{Type: kind, Value: raw}
+	}
+	out, err := json.Marshal(encoded)
+	return string(out), err
+}
+
+func decodeValues(data string, fields map[string]interface{}) error {
+	var encoded map[string]sqliteValue
+	if err := json.Unmarshal([]byte(data), &encoded); err != nil {
+		return err
+	}
+	for k, v := range encoded {
+		var err error
+		switch v.Type {
+		case "float":
+			var f float64
+			err = json.Unmarshal(v.Value, &f)
+			fields[k] = f
+		case "int":
+			var n int64
+			err = json.Unmarshal(v.Value, &n)
+			fields[k] = n
+		case "uint":
+			var n uint64
+			err = json.Unmarshal(v.Value, &n)
+			fields[k] = n
+		case "bool":
+			var b bool
+			err = json.Unmarshal(v.Value, &b)
+			fields[k] = b
+		default:
+			var str string
+			err = json.Unmarshal(v.Value, &str)
+			fields[k] = str
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+type sqliteExtra struct {
+	Tags   map[string]string `json:"tags,omitempty"`
+	Fields json.RawMessage   `json:"fields,omitempty"`
+}
+
+func encodeExtra(tags map[string]string, fields map[string]interface{}) (interface{}, error) {
+	if len(tags) == 0 && len(fields) == 0 {
+		return nil, nil
+	}
+	extra := sqliteExtra{Tags: tags}
+	if len(fields) > 0 {
+		encoded, err := encodeValues(fields)
+		if err != nil {
+			return nil, err
+		}
+		extra.Fields = json.RawMessage(encoded)
+	}
+	out, err := json.Marshal(extra)
+	return string(out), err
+}
+
+func decodeExtra(data string, tags map[string]string, fields map[string]interface{}) error {
+	if data == "" {
+		return nil
+	}
+	var extra sqliteExtra
+	if err := json.Unmarshal([]byte(data), &extra); err != nil {
+		return err
+	}
+	for k, v := range extra.Tags {
+		tags[k] = v
+	}
+	if len(extra.Fields) == 0 {
+		return nil
+	}
+	return decodeValues(string(extra.Fields), fields)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStoreTypedRoundTrip(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	base := time.Unix(1680000000, 7).UTC()
+	swap := Point{
+		Measurement: "swap",
+		Tags:        map[string]string{"pair": "0xa", "symbol": "USDC-WETH", "venue": "v2"},
+		Fields: map[string]interface{}{
+			"amount_usd": 2000.0,
+			"log_index":  int64(7),
+			"to":         "0xto",
+			"note":       "kept in extra",
+			"block":      "not an int",
+		},
+		Time: base,
+		Key:  "0xtx-7",
+	}
+	other := Point{Measurement: "swap", Tags: map[string]string{"pair": "0xb"}, Fields: map[string]interface{}{"amount_usd": 1.0}, Time: base.Add(-time.Hour), Key: "0xtx-1"}
+	for i := 0; i < 2; i++ {
+		if err := store.WritePoints([]Point{swap, other}); err != nil {
+			t.Fatalf("WritePoints failed: %v", err)
+		}
+	}
+
+	points, err := store.ReadSeries(SeriesQuery{Measurement: "swap", Tags: map[string]string{"pair": "0xa", "venue": "v2"}})
+	if err != nil {
+		t.Fatalf("ReadSeries failed: %v", err)
+	}
+	if len(points) != 1 {
+		t.Fatalf("Expected one swap after writing it twice, got %d", len(points))
+	}
+	point := points[0]
+	if point.Key != "0xtx-7" || !point.Time.Equal(base) || point.Tags["symbol"] != "USDC-WETH" || point.Tags["venue"] != "v2" {
+		t.Errorf("Unexpected point %+v", point)
+	}
+	expected := map[string]interface{}{
+		"amount_usd": 2000.0,
+		"log_index":  int64(7),
+		"to":         "0xto",
+		"note":       "kept in extra",
+		"block":      "not an int",
+		KeyField:     "0xtx-7",
+	}
+	for k, v := range expected {
+		if point.Fields[k] != v {
+			t.Errorf("Unexpected field %s: got %#v, want %#v", k, point.Fields[k], v)
+		}
+	}
+
+	all, _ := store.ReadSeries(SeriesQuery{Measurement: "swap", Start: base.Add(-2 * time.Hour), End: base})
+	if len(all) != 1 || all[0].Key != "0xtx-1" {
+		t.Errorf("Expected the end of the range to be exclusive, got %+v", all)
+	}
+}
+
+func TestSQLiteStoreGenericMeasurement(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	base := time.Unix(1680000000, 0).UTC()
+	err := store.WritePoints([]Point{
+		{Measurement: "global_stats", Tags: map[string]string{}, Fields: map[string]interface{}{"tx_count": int64(3), "total_volume_usd": 1.0, "live": true}, Time: base},
+		{Measurement: "global_stats", Tags: map[string]string{}, Fields: map[string]interface{}{"tx_count": int64(4)}, Time: base},
+	})
+	if err != nil {
+		t.Fatalf("WritePoints failed: %v", err)
+	}
+	points, err := store.ReadSeries(SeriesQuery{Measurement: "global_stats"})
+	if err != nil {
+		t.Fatalf("ReadSeries failed: %v", err)
+	}
+	if len(points) != 1 || points[0].Fields["tx_count"] != int64(4) {
+		t.Errorf("Expected the second point to replace the first, got %+v", points)
+	}
+}
+
+func TestSQLiteStoreCheckpointsAndMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uniswap.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	if _, err := store.GetCheckpoint("swaps/0xa"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.SetCheckpoint(Checkpoint{Key: "swaps/0xa", Timestamp: 200, LastID: "0xtx-1", Block: 17000000, BlockHash: "0xabc", Confirmed: 150}); err != nil {
+		t.Fatalf("SetCheckpoint failed: %v", err)
+	}
+	store.Close()
+
+	// Reopening must not apply the migrations again.
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer store.Close()
+	if version, _ := store.SchemaVersion(); version != len(sqliteMigrations) {
+		t.Errorf("Unexpected schema version %d", version)
+	}
+	checkpoint, err := store.GetCheckpoint("swaps/0xa")
+	if err != nil {
+		t.Fatalf("GetCheckpoint failed: %v", err)
+	}
+	if checkpoint.Timestamp != 200 || checkpoint.LastID != "0xtx-1" || checkpoint.UpdatedAt.IsZero() ||
+		checkpoint.Block != 17000000 || checkpoint.BlockHash != "0xabc" || checkpoint.Confirmed != 150 {
+		t.Errorf("Unexpected checkpoint %+v", checkpoint)
+	}
+}
+
+func TestDeleteSeries(t *testing.T) {
+	base := time.Unix(1680000000, 0)
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "sqlite": newTestSQLiteStore(t)} {
+		var points []Point
+		for i, pair := range []string{"0xa", "0xa", "0xa", "0xb"} {
+			points = append(points, Point{
+				Measurement: "swap",
+				Tags:        map[string]string{"pair": pair},
+				Fields:      map[string]interface{}{"amount_usd": 1.0},
+				Time:        base.Add(time.Duration(i) * time.Minute),
+				Key:         "0xtx-" + strconv.Itoa(i),
+			}, Point{Measurement: "other", Tags: map[string]string{"pair": pair}, Fields: map[string]interface{}{"v": 1.0}, Time: base.Add(time.Duration(i) * time.Minute)})
+		}
+		if err := store.WritePoints(points); err != nil {
+			t.Fatalf("%s: WritePoints failed: %v", name, err)
+		}
+		for _, measurement := range []string{"swap", "other"} {
+			if err := store.DeleteSeries(SeriesQuery{Measurement: measurement, Tags: map[string]string{"pair": "0xa"}, Start: base.Add(time.Minute)}); err != nil {
+				t.Fatalf("%s: DeleteSeries failed: %v", name, err)
+			}
+			left, _ := store.ReadSeries(SeriesQuery{Measurement: measurement})
+			if len(left) != 2 || !left[0].Time.Equal(base) || left[1].Tags["pair"] != "0xb" {
+				t.Errorf("%s: unexpected %s points left %+v", name, measurement, left)
+			}
+		}
+		// Deleted keys can be written again.
+		store.WritePoints(points[2:4])
+		if left, _ := store.ReadSeries(SeriesQuery{Measurement: "swap"}); len(left) != 3 {
+			t.Errorf("%s: expected the rewritten point, got %d points", name, len(left))
+		}
+	}
+}
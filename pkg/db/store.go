@@ -0,0 +1,109 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a checkpoint does not exist.
+var ErrNotFound = errors.New("not found")
+
+// KeyField is the field a point's Key is stored in.
+const KeyField = "id"
+
+// Point is a storage-agnostic time series point: a measurement, the tags
+// identifying the series and the numeric or string fields recorded at Time.
+//
+// Key, when set, uniquely identifies the record the point was built from,
+// e.g. the subgraph id of a swap. Stores keep at most one point per
+// measurement and Key, so writing the same record twice is harmless. InfluxDB
+// can only overwrite a point with the same tags and time, so a keyed point
+// must always be written with the same tags and Time.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+	Key         string
+}
+
+// SeriesQuery selects the points of one measurement whose tags match every
+// entry of Tags, with Start <= Time < End. A zero End means no upper bound.
+type SeriesQuery struct {
+	Measurement string
+	Tags        map[string]string
+	Start       time.Time
+	End         time.Time
+}
+
+// Checkpoint records how far ingestion got for one stream of data, e.g. the
+// swaps of one pair, so a later run can resume from there.
+type Checkpoint struct {
+	Key string
+	// Timestamp is the time of the last record written, in unix seconds.
+	Timestamp int64
+	// LastID is the id of the last record written, to break timestamp ties.
+	LastID string
+	// Block and BlockHash are the subgraph's latest block when the checkpoint
+	// was written, to detect a reorganization on the next run. Confirmed is
+	// the timestamp up to which the records written were already final.
+	Block     int64
+	BlockHash string
+	Confirmed int64
+	UpdatedAt time.Time
+}
+
+// Store is the storage used by ingestion code. InfluxStore, SQLiteStore and
+// MemoryStore implement it.
+type Store interface {
+	// WritePoints persists points. Writing a point with the same measurement
+	// and Key as a stored one, or without a Key but with the same tags and
+	// Time, replaces it.
+	WritePoints(points []Point) error
+	// ReadSeries returns the points matching query ordered by time.
+	ReadSeries(query SeriesQuery) ([]Point, error)
+	// DeleteSeries deletes the points matching query.
+	DeleteSeries(query SeriesQuery) error
+	// GetCheckpoint returns the checkpoint stored under key, or ErrNotFound.
+	GetCheckpoint(key string) (*Checkpoint, error)
+	// SetCheckpoint stores checkpoint under its key, replacing any previous one.
+	SetCheckpoint(checkpoint Checkpoint) error
+	Close() error
+}
+
+// identity returns what makes point unique within its measurement.
+func (p Point) identity() string {
+	if p.Key != "" {
+		return "key:" + p.Key
+	}
+	return seriesKey(p.Time, p.Tags)
+}
+
+// fieldsWithKey returns the fields to store for point, with its Key in
+// KeyField so it survives a round trip through stores without a key column.
+func (p Point) fieldsWithKey() map[string]interface{} {
+	if p.Key == "" {
+		return p.Fields
+	}
+	fields := make(map[string]interface{}, len(p.Fields)+1)
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+	fields[KeyField] = p.Key
+	return fields
+}
+
+func (q SeriesQuery) matches(point Point) bool {
+	if point.Measurement != q.Measurement {
+		return false
+	}
+	if point.Time.Before(q.Start) || (!q.End.IsZero() && !point.Time.Before(q.End)) {
+		return false
+	}
+	for k, v := range q.Tags {
+		if point.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreReadSeries(t *testing.T) {
+	store := NewMemoryStore()
+	base := time.Unix(1680000000, 0)
+	err := store.WritePoints([]Point{
+		{Measurement: "swap", Tags: map[string]string{"pair": "0xb"}, Fields: map[string]interface{}{"amount_usd": 2.0}, Time: base.Add(time.Minute)},
+		{Measurement: "swap", Tags: map[string]string{"pair": "0xa"}, Fields: map[string]interface{}{"amount_usd": 1.0}, Time: base.Add(2 * time.Minute)},
+		{Measurement: "swap", Tags: map[string]string{"pair": "0xa"}, Fields: map[string]interface{}{"amount_usd": 3.0}, Time: base},
+		{Measurement: "mint", Tags: map[string]string{"pair": "0xa"}, Fields: map[string]interface{}{"amount_usd": 4.0}, Time: base},
+	})
+	if err != nil {
+		t.Fatalf("WritePoints failed: %v", err)
+	}
+
+	points, err := store.ReadSeries(SeriesQuery{Measurement: "swap", Tags: map[string]string{"pair": "0xa"}})
+	if err != nil {
+		t.Fatalf("ReadSeries failed: %v", err)
+	}
+	if len(points) != 2 || points[0].Fields["amount_usd"] != 3.0 || points[1].Fields["amount_usd"] != 1.0 {
+		t.Errorf("Expected pair 0xa swaps in time order, got %+v", points)
+	}
+
+	points, _ = store.ReadSeries(SeriesQuery{Measurement: "swap", Start: base.Add(time.Minute), End: base.Add(2 * time.Minute)})
+	if len(points) != 1 || points[0].Tags["pair"] != "0xb" {
+		t.Errorf("Expected the end of the range to be exclusive, got %+v", points)
+	}
+
+	points[0].Tags["pair"] = "mutated"
+	points, _ = store.ReadSeries(SeriesQuery{Measurement: "swap", Tags: map[string]string{"pair": "0xb"}})
+	if len(points) != 1 {
+		t.Error("Returned points must not alias stored ones")
+	}
+}
+
+func TestMemoryStoreCheckpoints(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.GetCheckpoint("swaps/0xa"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	for _, timestamp := range []int64{100, 200} {
+		if err := store.SetCheckpoint(Checkpoint{Key: "swaps/0xa", Timestamp: timestamp, LastID: "0xtx-1"}); err != nil {
+			t.Fatalf("SetCheckpoint failed: %v", err)
+		}
+	}
+	checkpoint, err := store.GetCheckpoint("swaps/0xa")
+	if err != nil {
+		t.Fatalf("GetCheckpoint failed: %v", err)
+	}
+	if checkpoint.Timestamp != 200 || checkpoint.LastID != "0xtx-1" || checkpoint.UpdatedAt.IsZero() {
+		t.Errorf("Unexpected checkpoint %+v", checkpoint)
+	}
+}
+
+func TestMemoryStoreIdempotentWrites(t *testing.T) {
+	store := NewMemoryStore()
+	base := time.Unix(1680000000, 7)
+	swap := Point{Measurement: "swap", Tags: map[string]string{"pair": "0xa"}, Fields: map[string]interface{}{"amount_usd": 1.0}, Time: base, Key: "0xtx-0"}
+	for i := 0; i < 2; i++ {
+		if err := store.WritePoints([]Point{swap}); err != nil {
+			t.Fatalf("WritePoints failed: %v", err)
+		}
+	}
+	unkeyed := Point{Measurement: "swap", Tags: map[string]string{"pair": "0xa"}, Fields: map[string]interface{}{"amount_usd": 2.0}, Time: base.Add(time.Second)}
+	store.WritePoints([]Point{unkeyed, unkeyed})
+
+	points, _ := store.ReadSeries(SeriesQuery{Measurement: "swap"})
+	if len(points) != 2 {
+		t.Fatalf("Expected rewrites to replace points, got %d points", len(points))
+	}
+	if points[0].Key != "0xtx-0" || points[0].Fields[KeyField] != "0xtx-0" {
+		t.Errorf("Expected the key to be kept, got %+v", points[0])
+	}
+}
+
+// staticStore returns fixed points, as an InfluxDB bucket holding data from
+// before keyed writes would.
+type staticStore struct {
+	*MemoryStore
+	points []Point
+}
+
+func (s staticStore) ReadSeries(query SeriesQuery) ([]Point, error) {
+	return s.points, nil
+}
+
+func TestVerify(t *testing.T) {
+	base := time.Unix(1680000000, 0)
+	store := staticStore{MemoryStore: NewMemoryStore(), points: []Point{
+		{Measurement: "swap", Time: base, Key: "0xtx-0"},
+		{Measurement: "swap", Time: base.Add(time.Minute), Key: "0xtx-1"},
+		{Measurement: "swap", Time: base.Add(2 * time.Minute), Key: "0xtx-1"},
+		{Measurement: "swap", Time: base.Add(3 * time.Hour), Key: "0xtx-2"},
+	}}
+
+	v, err := Verify(store, SeriesQuery{Measurement: "swap", Start: base, End: base.Add(4 * time.Hour)}, time.Hour)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if v.OK() || v.Points != 4 {
+		t.Fatalf("Unexpected verification: %s", v)
+	}
+	if len(v.Duplicates) != 1 || v.Duplicates[0].Key != "0xtx-1" || len(v.Duplicates[0].Times) != 2 {
+		t.Errorf("Unexpected duplicates: %+v", v.Duplicates)
+	}
+	if len(v.Gaps) != 1 || !v.Gaps[0].Start.Equal(base.Add(2*time.Minute)) || !v.Gaps[0].End.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("Unexpected gaps: %+v", v.Gaps)
+	}
+}
+
+func TestInfluxStoreDeleteSeriesEscapesPredicate(t *testing.T) {
+	var predicate string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Predicate string `json:"predicate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Unexpected delete request: %v", err)
+		}
+		predicate = body.Predicate
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "token", "org", "bucket")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close()
+	query := SeriesQuery{Measurement: "swap", Tags: map[string]string{"pair": `0x"a\b`, "token0": "0xc"}, End: time.Unix(1680000000, 0)}
+	if err := NewInfluxStore(client).DeleteSeries(query); err != nil {
+		t.Fatalf("DeleteSeries failed: %v", err)
+	}
+	if expected := `_measurement="swap" AND pair="0x\"a\\b" AND token0="0xc"`; predicate != expected {
+		t.Errorf("Unexpected predicate %s, expected %s", predicate, expected)
+	}
+}
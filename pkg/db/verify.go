@@ -0,0 +1,98 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Duplicate is a Key stored more than once, e.g. a swap written by an older
+// run with a different timestamp.
+type Duplicate struct {
+	Key   string
+	Times []time.Time
+}
+
+// Gap is a stretch longer than the allowed maximum with no points.
+type Gap struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// Verification is the result of Verify.
+type Verification struct {
+	Query      SeriesQuery
+	Points     int
+	Duplicates []Duplicate
+	Gaps       []Gap
+}
+
+// OK reports whether no duplicates or gaps were found.
+func (v *Verification) OK() bool {
+	return len(v.Duplicates) == 0 && len(v.Gaps) == 0
+}
+
+func (v *Verification) String() string {
+	s := fmt.Sprintf("%s %v: %d points, %d duplicates, %d gaps", v.Query.Measurement, v.Query.Tags, v.Points, len(v.Duplicates), len(v.Gaps))
+	for _, d := range v.Duplicates {
+		s += fmt.Sprintf("\n  duplicate %s at %v", d.Key, d.Times)
+	}
+	for _, g := range v.Gaps {
+		s += fmt.Sprintf("\n  gap %s to %s (%s)", g.Start.Format(time.RFC3339), g.End.Format(time.RFC3339), g.Duration())
+	}
+	return s
+}
+
+// Verify scans the points matching query for keys stored more than once and,
+// when maxGap is positive, for stretches longer than maxGap without points.
+// The edges of the query range count when Start or End is set, so an empty
+// range is one gap.
+func Verify(store Store, query SeriesQuery, maxGap time.Duration) (*Verification, error) {
+	points, err := store.ReadSeries(query)
+	if err != nil {
+		return nil, err
+	}
+	v := &Verification{Query: query, Points: len(points)}
+
+	times := make(map[string][]time.Time)
+	var keys []string
+	for _, point := range points {
+		if point.Key == "" {
+			continue
+		}
+		if _, ok := times[point.Key]; !ok {
+			keys = append(keys, point.Key)
+		}
+		times[point.Key] = append(times[point.Key], point.Time)
+	}
+	for _, key := range keys {
+		if len(times[key]) > 1 {
+			v.Duplicates = append(v.Duplicates, Duplicate{Key: key, Times: times[key]})
+		}
+	}
+
+	if maxGap <= 0 {
+		return v, nil
+	}
+	var edges []time.Time
+	if !query.Start.IsZero() {
+		edges = append(edges, query.Start)
+	}
+	for _, point := range points {
+		edges = append(edges, point.Time)
+	}
+	if !query.End.IsZero() {
+		edges = append(edges, query.End)
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].Before(edges[j]) })
+	for i := 1; i < len(edges); i++ {
+		if edges[i].Sub(edges[i-1]) > maxGap {
+			v.Gaps = append(v.Gaps, Gap{Start: edges[i-1], End: edges[i]})
+		}
+	}
+	return v, nil
+}
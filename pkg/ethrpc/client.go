@@ -0,0 +1,143 @@
+package ethrpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Client is a minimal Ethereum JSON-RPC client covering the calls this
+// package needs: chain head, blocks and read-only contract calls.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+	id   uint64
+}
+
+type Block struct {
+	Number    uint64
+	Hash      string
+	Timestamp uint64
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		URL:  url,
+		HTTP: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// RPCError is an error returned by the node.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// Call executes method with params and decodes the result into result.
+func (c *Client) Call(method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Post(c.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("json-rpc %s: unexpected status %s", method, resp.Status)
+	}
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// BlockNumber returns the number of the most recent block.
+func (c *Client) BlockNumber() (uint64, error) {
+	var result string
+	if err := c.Call("eth_blockNumber", nil, &result); err != nil {
+		return 0, err
+	}
+	return parseQuantity(result)
+}
+
+// BlockByNumber returns the header fields of a block. A number of 0 means the latest block.
+func (c *Client) BlockByNumber(number uint64) (*Block, error) {
+	var result struct {
+		Number    string `json:"number"`
+		Hash      string `json:"hash"`
+		Timestamp string `json:"timestamp"`
+	}
+	if err := c.Call("eth_getBlockByNumber", []interface{}{blockTag(number), false}, &result); err != nil {
+		return nil, err
+	}
+	if result.Hash == "" {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	blockNumber, err := parseQuantity(result.Number)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := parseQuantity(result.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return &Block{Number: blockNumber, Hash: result.Hash, Timestamp: timestamp}, nil
+}
+
+// EthCall executes a read-only call against contract to with the given
+// calldata at block (0 for latest) and returns the raw return data.
+func (c *Client) EthCall(to string, data []byte, block uint64) ([]byte, error) {
+	call := map[string]string{
+		"to":   to,
+		"data": "0x" + hex.EncodeToString(data),
+	}
+	var result string
+	if err := c.Call("eth_call", []interface{}{call, blockTag(block)}, &result); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimPrefix(result, "0x"))
+}
+
+func blockTag(number uint64) string {
+	if number == 0 {
+		return "latest"
+	}
+	return "0x" + strconv.FormatUint(number, 16)
+}
+
+func parseQuantity(quantity string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(quantity, "0x"), 16, 64)
+}
@@ -0,0 +1,185 @@
+package export
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Copy streams every row of source into w and returns the number of rows.
+// It does not close w.
+func Copy(source Source, w Writer) (int, error) {
+	count := 0
+	for {
+		rows, err := source.Next()
+		if err != nil {
+			return count, err
+		}
+		if len(rows) == 0 {
+			return count, nil
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+}
+
+// Period is the time span of one partition.
+type Period int
+
+const (
+	// PeriodNone writes a single time partition.
+	PeriodNone Period = iota
+	PeriodDay
+	PeriodMonth
+)
+
+// Exporter writes a source into a directory tree of Hive-style partitions:
+//
+//	<Dir>/<dataset>/pair=<address>/date=2023-04-01/part-00000.parquet
+//
+// with one directory level for the schema's PartitionKey when ByKey is set
+// and one for the time period. Sources return rows oldest first, so a
+// partition is closed as soon as a row of a later period arrives; a period
+// seen again gets a new part file rather than overwriting the first one.
+type Exporter struct {
+	Dir    string
+	Format Format
+	Period Period
+	ByKey  bool
+}
+
+// Partition is a file written by Export.
+type Partition struct {
+	Path string
+	Key  string
+	Date string
+	Rows int
+}
+
+type openPartition struct {
+	partition *Partition
+	file      *os.File
+	writer    Writer
+	period    string
+}
+
+// Export writes every row of source and returns the files written, sorted by path.
+func (e *Exporter) Export(source Source) ([]Partition, error) {
+	schema := source.Schema()
+	open := make(map[string]*openPartition)
+	parts := make(map[string]int)
+	var written []*Partition
+
+	closeAll := func(keep func(*openPartition) bool) error {
+		var firstErr error
+		for dir, p := range open {
+			if keep != nil && keep(p) {
+				continue
+			}
+			if err := p.writer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err := p.file.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			delete(open, dir)
+		}
+		return firstErr
+	}
+
+	for {
+		rows, err := source.Next()
+		if err != nil {
+			closeAll(nil)
+			return nil, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			period := e.period(row.Time)
+			dir := e.partitionDir(schema, row.Key, period)
+			p, ok := open[dir]
+			if !ok {
+				// Rows are in time order: partitions of earlier periods are done.
+				if err := closeAll(func(o *openPartition) bool { return o.period >= period }); err != nil {
+					return nil, err
+				}
+				p, err = e.create(schema, dir, parts[dir])
+				if err != nil {
+					closeAll(nil)
+					return nil, err
+				}
+				p.period = period
+				p.partition.Key, p.partition.Date = row.Key, period
+				parts[dir]++
+				open[dir] = p
+				written = append(written, p.partition)
+			}
+			if err := p.writer.Write(row); err != nil {
+				closeAll(nil)
+				return nil, err
+			}
+			p.partition.Rows++
+		}
+	}
+	if err := closeAll(nil); err != nil {
+		return nil, err
+	}
+
+	partitions := make([]Partition, len(written))
+	for i, p := range written {
+		partitions[i] = *p
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Path < partitions[j].Path })
+	return partitions, nil
+}
+
+func (e *Exporter) create(schema *Schema, dir string, part int) (*openPartition, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("part-%05d.%s", part, e.Format))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(e.Format, file, schema)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &openPartition{partition: &Partition{Path: path}, file: file, writer: w}, nil
+}
+
+func (e *Exporter) period(t time.Time) string {
+	switch e.Period {
+	case PeriodDay:
+		return t.UTC().Format("2006-01-02")
+	case PeriodMonth:
+		return t.UTC().Format("2006-01")
+	default:
+		return ""
+	}
+}
+
+func (e *Exporter) partitionDir(schema *Schema, key, period string) string {
+	dir := filepath.Join(e.Dir, schema.Name)
+	if e.ByKey && schema.PartitionKey != "" {
+		if key == "" {
+			key = "unknown"
+		}
+		dir = filepath.Join(dir, schema.PartitionKey+"="+url.PathEscape(key))
+	}
+	if period != "" {
+		dir = filepath.Join(dir, "date="+period)
+	}
+	return dir
+}
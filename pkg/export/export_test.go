@@ -0,0 +1,206 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// fakeSwaps serves swaps the way the subgraph does: filtered by
+// timestamp_gte, ordered by timestamp then id, with first and skip.
+func fakeSwaps(swaps []uniswap.Swap, calls *int) SwapFetcher {
+	return func(args map[string]interface{}) (*[]uniswap.Swap, error) {
+		*calls++
+		where := args["where"].(map[string]interface{})
+		gte := where["timestamp_gte"].(int64)
+		skip, _ := args["skip"].(int)
+		var page []uniswap.Swap
+		for _, swap := range swaps {
+			ts, _ := strconv.ParseInt(swap.Transaction.Timestamp, 10, 64)
+			if ts < gte {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(page) == args["first"].(int) {
+				break
+			}
+			page = append(page, swap)
+		}
+		return &page, nil
+	}
+}
+
+func testSwap(id, pair string, timestamp int64, amountUSD string) uniswap.Swap {
+	return uniswap.Swap{
+		ID:          id,
+		Transaction: &uniswap.Transaction{ID: id[:6], BlockNumber: "17000000", Timestamp: strconv.FormatInt(timestamp, 10)},
+		Pair:        &uniswap.Pairs{ID: pair},
+		Amount0In:   "1000.5",
+		Amount0Out:  "0",
+		Amount1In:   "0",
+		Amount1Out:  "0.000000000000000001",
+		AmountUSD:   amountUSD,
+		Sender:      "0xRouter",
+		To:          "0xTo",
+		LogIndex:    "3",
+	}
+}
+
+var day = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+func testSwaps() []uniswap.Swap {
+	return []uniswap.Swap{
+		testSwap("0xaaaa01-0", "0xPAIRA", day+10, "1000.5"),
+		testSwap("0xaaaa02-0", "0xPAIRA", day+20, "2"),
+		// Three swaps in the same second straddle a page boundary.
+		testSwap("0xaaaa03-0", "0xPAIRB", day+20, "3"),
+		testSwap("0xaaaa04-0", "0xPAIRA", day+20, "4"),
+		testSwap("0xaaaa05-0", "0xPAIRA", day+86400+5, "5"),
+		testSwap("0xaaaa06-0", "0xPAIRA", day+2*86400, "6"),
+	}
+}
+
+func TestSwapsSourcePages(t *testing.T) {
+	calls := 0
+	source := Swaps(fakeSwaps(testSwaps(), &calls), nil, Range{End: time.Unix(day+2*86400, 0)}, 2)
+	var ids []string
+	for {
+		rows, err := source.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			ids = append(ids, row.Values[0])
+		}
+	}
+	expected := "0xaaaa01-0 0xaaaa02-0 0xaaaa03-0 0xaaaa04-0 0xaaaa05-0"
+	if strings.Join(ids, " ") != expected {
+		t.Errorf("Unexpected swaps %v, want %s", ids, expected)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 pages, got %d", calls)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	calls := 0
+	w, _ := NewCSVWriter(&buf, SwapSchema)
+	n, err := Copy(Swaps(fakeSwaps(testSwaps()[:1], &calls), nil, Range{}, 10), w)
+	if err != nil || n != 1 {
+		t.Fatalf("Copy failed: %d rows, %v", n, err)
+	}
+	w.Close()
+	expected := "id,timestamp,block,transaction,log_index,pair,sender,from,to,amount0_in,amount0_out,amount1_in,amount1_out,amount_usd\n" +
+		"0xaaaa01-0,2023-04-01T00:00:10Z,17000000,0xaaaa,3,0xpaira,0xrouter,,0xto,1000.5,0,0,0.000000000000000001,1000.5\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
+
+func TestExporterPartitionsParquet(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	exporter := &Exporter{Dir: dir, Format: FormatParquet, Period: PeriodDay, ByKey: true}
+	partitions, err := exporter.Export(Swaps(fakeSwaps(testSwaps(), &calls), nil, Range{}, 2))
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	var got []string
+	for _, p := range partitions {
+		rel, _ := filepath.Rel(dir, p.Path)
+		got = append(got, rel+":"+strconv.Itoa(p.Rows))
+	}
+	expected := []string{
+		"swaps/pair=0xpaira/date=2023-04-01/part-00000.parquet:3",
+		"swaps/pair=0xpaira/date=2023-04-02/part-00000.parquet:1",
+		"swaps/pair=0xpaira/date=2023-04-03/part-00000.parquet:1",
+		"swaps/pair=0xpairb/date=2023-04-01/part-00000.parquet:1",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Unexpected partitions:\n%s", strings.Join(got, "\n"))
+	}
+
+	file, err := local.NewLocalFileReader(partitions[0].Path)
+	if err != nil {
+		t.Fatalf("Opening parquet failed: %v", err)
+	}
+	defer file.Close()
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		t.Fatalf("Reading parquet failed: %v", err)
+	}
+	defer pr.ReadStop()
+	if pr.GetNumRows() != 3 {
+		t.Errorf("Expected 3 rows, got %d", pr.GetNumRows())
+	}
+	values, _, _, err := pr.ReadColumnByIndex(13, 3)
+	if err != nil {
+		t.Fatalf("Reading amount_usd failed: %v", err)
+	}
+	if decoded := types.DECIMAL_BYTE_ARRAY_ToString([]byte(values[0].(string)), DecimalPrecision, DecimalScale); decoded != "1000.500000000000000000" {
+		t.Errorf("Unexpected decimal %s", decoded)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "swaps", "pair=0xpaira")); err != nil {
+		t.Errorf("Expected a pair directory: %v", err)
+	}
+}
+
+func TestScaledDecimal(t *testing.T) {
+	for value, expected := range map[string]string{
+		"1":                      "1000000000000000000",
+		"-0.5":                   "-500000000000000000",
+		"0.0000000000000000019":  "1",
+		"123456.000000000000001": "123456000000000000001000",
+	} {
+		if got, err := scaledDecimal(value); err != nil || got != expected {
+			t.Errorf("scaledDecimal(%s) = %s, %v; want %s", value, got, err, expected)
+		}
+	}
+	if _, err := scaledDecimal("1e5"); err == nil {
+		t.Error("Expected an error for exponent notation")
+	}
+	if _, err := scaledDecimal(strings.Repeat("9", 21)); err == nil {
+		t.Error("Expected an error above the decimal precision")
+	}
+}
+
+type failingRunner struct{}
+
+func (failingRunner) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	return nil, errors.New("subgraph unavailable")
+}
+
+func TestExportReturnsQueryErrors(t *testing.T) {
+	previous := uniswap.DefaultRunner()
+	uniswap.SetRunner(failingRunner{})
+	defer uniswap.SetRunner(previous)
+	for _, source := range []Source{
+		Swaps(nil, nil, Range{}, 10),
+		TokenDays(nil, nil, Range{}, 10),
+		PairDays(nil, nil, Range{}, 10),
+	} {
+		exporter := &Exporter{Dir: t.TempDir(), Format: FormatCSV}
+		if _, err := exporter.Export(source); err == nil || err.Error() != "subgraph unavailable" {
+			t.Errorf("Expected the query error exporting %s, got %v", source.Schema().Name, err)
+		}
+	}
+}
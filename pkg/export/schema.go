@@ -0,0 +1,151 @@
+package export
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the logical type of a column. Values are carried as the
+// strings the subgraph returns and converted by each writer.
+type ColumnType int
+
+const (
+	// String is free text, or a hash such as a transaction id.
+	String ColumnType = iota
+	// Address is a lowercase 0x-prefixed address.
+	Address
+	// Integer is a whole number, e.g. a block number or log index.
+	Integer
+	// Decimal is a BigDecimal from the subgraph, written exactly with
+	// DecimalScale digits after the point.
+	Decimal
+	// Timestamp is a unix time in seconds.
+	Timestamp
+	// Date is the unix time in seconds of midnight UTC, as in day data.
+	Date
+)
+
+// Decimal columns are written with this precision and scale, which fits
+// token amounts with 18 decimals up to 10^20.
+const (
+	DecimalPrecision = 38
+	DecimalScale     = 18
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Schema is the ordered list of columns of a dataset.
+type Schema struct {
+	Name    string
+	Columns []Column
+	// PartitionKey is the column, if any, files are partitioned by besides time.
+	PartitionKey string
+}
+
+// Row is one record. Values follow the schema's columns; an empty string is
+// a null. Time and Key place the row in its partition.
+type Row struct {
+	Time   time.Time
+	Key    string
+	Values []string
+}
+
+var SwapSchema = &Schema{
+	Name:         "swaps",
+	PartitionKey: "pair",
+	Columns: []Column{
+		{"id", String},
+		{"timestamp", Timestamp},
+		{"block", Integer},
+		{"transaction", String},
+		{"log_index", Integer},
+		{"pair", Address},
+		{"sender", Address},
+		{"from", Address},
+		{"to", Address},
+		{"amount0_in", Decimal},
+		{"amount0_out", Decimal},
+		{"amount1_in", Decimal},
+		{"amount1_out", Decimal},
+		{"amount_usd", Decimal},
+	},
+}
+
+var TokenDaySchema = &Schema{
+	Name:         "token_days",
+	PartitionKey: "token",
+	Columns: []Column{
+		{"id", String},
+		{"date", Date},
+		{"token", Address},
+		{"price_usd", Decimal},
+		{"total_liquidity", Decimal},
+		{"total_liquidity_usd", Decimal},
+		{"total_liquidity_eth", Decimal},
+		{"daily_volume", Decimal},
+		{"daily_volume_usd", Decimal},
+		{"daily_volume_eth", Decimal},
+	},
+}
+
+var PairDaySchema = &Schema{
+	Name:         "pair_days",
+	PartitionKey: "pair",
+	Columns: []Column{
+		{"date", Date},
+		{"pair", Address},
+		{"reserve0", Decimal},
+		{"reserve1", Decimal},
+		{"reserve_usd", Decimal},
+		{"daily_volume_token0", Decimal},
+		{"daily_volume_token1", Decimal},
+		{"daily_volume_usd", Decimal},
+	},
+}
+
+// Schemas lists the datasets by name.
+var Schemas = map[string]*Schema{
+	SwapSchema.Name:     SwapSchema,
+	TokenDaySchema.Name: TokenDaySchema,
+	PairDaySchema.Name:  PairDaySchema,
+}
+
+// scaledDecimal returns value * 10^DecimalScale as an integer string, without
+// going through floating point. Digits beyond the scale are truncated.
+func scaledDecimal(value string) (string, error) {
+	negative := strings.HasPrefix(value, "-")
+	digits := strings.TrimPrefix(value, "-")
+	whole, fraction := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		whole, fraction = digits[:i], digits[i+1:]
+	}
+	if len(fraction) > DecimalScale {
+		fraction = fraction[:DecimalScale]
+	}
+	fraction += strings.Repeat("0", DecimalScale-len(fraction))
+	n, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid decimal %q", value)
+	}
+	if len(strings.TrimLeft(n.String(), "0")) > DecimalPrecision {
+		return "", fmt.Errorf("decimal %q exceeds %d digits", value, DecimalPrecision)
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return n.String(), nil
+}
+
+func parseUnix(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
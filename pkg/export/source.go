@@ -0,0 +1,196 @@
+package export
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// DefaultPageSize is the largest page the subgraph returns.
+const DefaultPageSize = 1000
+
+// Source streams the rows of one dataset page by page, oldest first.
+type Source interface {
+	Schema() *Schema
+	// Next returns the next page of rows, or no rows once the source is done.
+	Next() ([]Row, error)
+}
+
+// Fetch functions have the signature of the matching uniswap.Query function,
+// which is used when nil; tests pass fixtures instead.
+type (
+	SwapFetcher     func(args map[string]interface{}) (*[]uniswap.Swap, error)
+	TokenDayFetcher func(args map[string]interface{}) (*[]uniswap.TokenDayData, error)
+	PairDayFetcher  func(args map[string]interface{}) (*[]uniswap.PairDailyAggregated, error)
+)
+
+// Range restricts a source to Start <= time < End. A zero End means up to the
+// latest record.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// pagedSource runs a Cursor over one collection. fetch returns the rows of a
+// page along with the cursor value of each.
+type pagedSource struct {
+	schema   *Schema
+	cursor   *uniswap.Cursor
+	where    map[string]interface{}
+	end      int64
+	pageSize int
+	done     bool
+	fetch    func(args map[string]interface{}) ([]Row, []int64, error)
+}
+
+func newPagedSource(schema *Schema, field string, where map[string]interface{}, r Range, pageSize int, fetch func(map[string]interface{}) ([]Row, []int64, error)) *pagedSource {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	var start int64
+	if !r.Start.IsZero() {
+		start = r.Start.Unix()
+	}
+	s := &pagedSource{
+		schema:   schema,
+		cursor:   uniswap.NewCursor(field, start),
+		where:    where,
+		pageSize: pageSize,
+		fetch:    fetch,
+	}
+	if !r.End.IsZero() {
+		s.end = r.End.Unix()
+	}
+	return s
+}
+
+func (s *pagedSource) Schema() *Schema {
+	return s.schema
+}
+
+func (s *pagedSource) Next() ([]Row, error) {
+	if s.done {
+		return nil, nil
+	}
+	rows, values, err := s.fetch(s.cursor.Args(s.where, s.pageSize))
+	if err != nil {
+		return nil, err
+	}
+	s.cursor.Advance(values)
+	if len(rows) < s.pageSize {
+		s.done = true
+	}
+	if s.end > 0 {
+		for i, value := range values {
+			if value >= s.end {
+				rows, s.done = rows[:i], true
+				break
+			}
+		}
+	}
+	return rows, nil
+}
+
+// Swaps streams the swaps matching where, e.g. {"pair": pairID}, in r.
+func Swaps(fetch SwapFetcher, where map[string]interface{}, r Range, pageSize int) Source {
+	if fetch == nil {
+		fetch = uniswap.QuerySwaps
+	}
+	return newPagedSource(SwapSchema, "timestamp", where, r, pageSize, func(args map[string]interface{}) ([]Row, []int64, error) {
+		swaps, err := fetch(args)
+		if err != nil || swaps == nil {
+			return nil, nil, err
+		}
+		rows := make([]Row, 0, len(*swaps))
+		values := make([]int64, 0, len(*swaps))
+		for _, swap := range *swaps {
+			var transaction, block, timestamp, pair string
+			if swap.Transaction != nil {
+				transaction, block, timestamp = swap.Transaction.ID, swap.Transaction.BlockNumber, swap.Transaction.Timestamp
+			}
+			if swap.Pair != nil {
+				pair = strings.ToLower(swap.Pair.ID)
+			}
+			t, err := parseUnix(timestamp)
+			if err != nil {
+				return nil, nil, err
+			}
+			rows = append(rows, Row{
+				Time: t,
+				Key:  pair,
+				Values: []string{
+					swap.ID, timestamp, block, transaction, swap.LogIndex, pair,
+					strings.ToLower(swap.Sender), strings.ToLower(swap.From), strings.ToLower(swap.To),
+					swap.Amount0In, swap.Amount0Out, swap.Amount1In, swap.Amount1Out, swap.AmountUSD,
+				},
+			})
+			values = append(values, t.Unix())
+		}
+		return rows, values, nil
+	})
+}
+
+// TokenDays streams TokenDayData matching where, e.g. {"token": tokenID}, in r.
+func TokenDays(fetch TokenDayFetcher, where map[string]interface{}, r Range, pageSize int) Source {
+	if fetch == nil {
+		fetch = uniswap.QueryTokenDailyData
+	}
+	return newPagedSource(TokenDaySchema, "date", where, r, pageSize, func(args map[string]interface{}) ([]Row, []int64, error) {
+		days, err := fetch(args)
+		if err != nil || days == nil {
+			return nil, nil, err
+		}
+		rows := make([]Row, 0, len(*days))
+		values := make([]int64, 0, len(*days))
+		for _, day := range *days {
+			// TokenDayData ids are "<token address>-<day number>".
+			token := day.ID
+			if i := strings.LastIndex(token, "-"); i > 0 {
+				token = token[:i]
+			}
+			token = strings.ToLower(token)
+			rows = append(rows, Row{
+				Time: time.Unix(int64(day.Date), 0).UTC(),
+				Key:  token,
+				Values: []string{
+					day.ID, strconv.Itoa(day.Date), token,
+					day.PriceUSD, day.TotalLiquidity, day.TotalLiquidityUSD, day.TotalLiquidityETH,
+					day.DailyVolume, day.DailyVolumeUSD, day.DailyVolumeETH,
+				},
+			})
+			values = append(values, int64(day.Date))
+		}
+		return rows, values, nil
+	})
+}
+
+// PairDays streams PairDailyAggregated matching where, e.g. {"pairAddress": pairID}, in r.
+func PairDays(fetch PairDayFetcher, where map[string]interface{}, r Range, pageSize int) Source {
+	if fetch == nil {
+		fetch = uniswap.QueryPairDailyAggregated
+	}
+	return newPagedSource(PairDaySchema, "date", where, r, pageSize, func(args map[string]interface{}) ([]Row, []int64, error) {
+		days, err := fetch(args)
+		if err != nil || days == nil {
+			return nil, nil, err
+		}
+		rows := make([]Row, 0, len(*days))
+		values := make([]int64, 0, len(*days))
+		for _, day := range *days {
+			pair := strings.ToLower(day.PairAddress)
+			rows = append(rows, Row{
+				Time: time.Unix(int64(day.Date), 0).UTC(),
+				Key:  pair,
+				Values: []string{
+					strconv.Itoa(day.Date), pair,
+					day.Reserve0, day.Reserve1, day.ReserveUSD,
+					day.DailyVolumeToken0, day.DailyVolumeToken1, day.DailyVolumeUSD,
+				},
+			})
+			values = append(values, int64(day.Date))
+		}
+		return rows, values, nil
+	})
+}
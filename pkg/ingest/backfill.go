@@ -0,0 +1,286 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Shards splits [start, end) into windows of window for every pair and
+// entity. Shards are ordered oldest window first.
+func Shards(pairs []string, entities []Entity, start, end time.Time, window time.Duration) []Job {
+	if window <= 0 {
+		window = end.Sub(start)
+	}
+	var shards []Job
+	for from := start; from.Before(end); from = from.Add(window) {
+		to := from.Add(window)
+		if to.After(end) {
+			to = end
+		}
+		for _, job := range Jobs(pairs, entities...) {
+			job.Start, job.End = from, to
+			shards = append(shards, job)
+		}
+	}
+	return shards
+}
+
+// ShardStatus is the state of a shard in a Progress file.
+type ShardStatus string
+
+const (
+	ShardPending ShardStatus = "pending"
+	ShardRunning ShardStatus = "running"
+	ShardDone    ShardStatus = "done"
+	ShardFailed  ShardStatus = "failed"
+)
+
+type ShardProgress struct {
+	Key       string      `json:"key"`
+	Status    ShardStatus `json:"status"`
+	Records   int         `json:"records"`
+	Error     string      `json:"error,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Progress records the status of each shard of a backfill in a JSON file,
+// rewritten after every change, so a stopped backfill can tell which shards
+// it has completed. A shard left running by a crash is simply run again.
+type Progress struct {
+	path   string
+	mu     sync.Mutex
+	shards map[string]*ShardProgress
+}
+
+// OpenProgress loads the progress file at path, or starts an empty one if it
+// does not exist yet.
+func OpenProgress(path string) (*Progress, error) {
+	p := &Progress{path: path, shards: make(map[string]*ShardProgress)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var shards []ShardProgress
+	if err := json.Unmarshal(data, &shards); err != nil {
+		return nil, err
+	}
+	for i := range shards {
+		p.shards[shards[i].Key] = &shards[i]
+	}
+	return p, nil
+}
+
+// Get returns the progress of the shard with the given checkpoint key.
+func (p *Progress) Get(key string) (ShardProgress, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if shard, ok := p.shards[key]; ok {
+		return *shard, true
+	}
+	return ShardProgress{}, false
+}
+
+// Shards returns the progress of every shard, sorted by key.
+func (p *Progress) Shards() []ShardProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sorted()
+}
+
+func (p *Progress) set(shard ShardProgress) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	shard.UpdatedAt = time.Now().UTC()
+	p.shards[shard.Key] = &shard
+	data, err := json.MarshalIndent(p.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename, so a crash never leaves a truncated file.
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
+
+func (p *Progress) sorted() []ShardProgress {
+	shards := make([]ShardProgress, 0, len(p.shards))
+	for _, shard := range p.shards {
+		shards = append(shards, *shard)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].Key < shards[j].Key })
+	return shards
+}
+
+// ShardResult reports one shard of a backfill.
+type ShardResult struct {
+	Job     Job
+	Records int
+	// Skipped is set for shards the Progress file already marks done.
+	Skipped bool
+	// Done is false for a window too recent to be complete yet.
+	Done bool
+	Err  error
+}
+
+// BackfillSummary totals the shards of a Run.
+type BackfillSummary struct {
+	Shards  int
+	Done    int
+	Skipped int
+	Failed  int
+	Records int
+}
+
+// Backfill runs the shards of a date range through a pool of Workers sharing
+// one Syncer. Queries go through the uniswap runner, so a Limiter on it
+// bounds the rate of the whole pool. Each shard is a bounded Job with its own
+// checkpoint: a shard interrupted halfway resumes after its last page.
+type Backfill struct {
+	Syncer  *Syncer
+	Workers int
+	// Progress, when set, is updated as shards run and lets a later Run skip
+	// completed shards without touching the store.
+	Progress *Progress
+	// Report, when set, is called after every shard, from the worker
+	// goroutines.
+	Report func(ShardResult)
+}
+
+func NewBackfill(syncer *Syncer, workers int, progress *Progress) *Backfill {
+	return &Backfill{Syncer: syncer, Workers: workers, Progress: progress}
+}
+
+// Run syncs the shards and returns once all have run or ctx is done. A
+// failed shard is recorded and counted but does not stop the others; run the
+// backfill again to retry it. Run returns an error only when ctx is done or
+// the Progress file cannot be written.
+func (b *Backfill) Run(ctx context.Context, shards []Job) (*BackfillSummary, error) {
+	workers := b.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan Job)
+	results := make(chan ShardResult)
+	var fatal error
+	var fatalOnce sync.Once
+	stop := func(err error) {
+		fatalOnce.Do(func() { fatal = err })
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result, err := b.runShard(ctx, job)
+				if err != nil {
+					stop(err)
+					continue
+				}
+				if b.Report != nil {
+					b.Report(result)
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, job := range shards {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	summary := &BackfillSummary{}
+	for result := range results {
+		summary.Shards++
+		summary.Records += result.Records
+		switch {
+		case result.Skipped:
+			summary.Skipped++
+		case result.Err != nil:
+			summary.Failed++
+		case result.Done:
+			summary.Done++
+		}
+	}
+	if fatal != nil {
+		return summary, fatal
+	}
+	return summary, ctx.Err()
+}
+
+// runShard syncs one shard. It returns an error only when the backfill must
+// stop; a shard failure is reported in the result.
+func (b *Backfill) runShard(ctx context.Context, job Job) (ShardResult, error) {
+	key := job.CheckpointKey()
+	if b.Progress != nil {
+		if shard, ok := b.Progress.Get(key); ok && shard.Status == ShardDone {
+			return ShardResult{Job: job, Skipped: true, Done: true}, nil
+		}
+		if err := b.Progress.set(ShardProgress{Key: key, Status: ShardRunning}); err != nil {
+			return ShardResult{}, err
+		}
+	}
+
+	result := ShardResult{Job: job}
+	synced, err := b.Syncer.SyncContext(ctx, job)
+	if synced != nil {
+		result.Records, result.Done = synced.Records, synced.Done
+	}
+	shard := ShardProgress{Key: key, Status: ShardPending, Records: result.Records}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Stopped: leave the shard pending, its checkpoint holds the rest.
+		if b.Progress != nil {
+			if err := b.Progress.set(shard); err != nil {
+				return result, err
+			}
+		}
+		return result, ctx.Err()
+	case err != nil:
+		result.Err = err
+		shard.Status, shard.Error = ShardFailed, err.Error()
+	case result.Done:
+		shard.Status = ShardDone
+	}
+	if b.Progress != nil {
+		if err := b.Progress.set(shard); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
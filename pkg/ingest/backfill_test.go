@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+)
+
+func TestShards(t *testing.T) {
+	start := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	shards := Shards([]string{"0xA", "0xB"}, []Entity{EntitySwaps}, start, start.Add(60*time.Hour), 24*time.Hour)
+	if len(shards) != 6 {
+		t.Fatalf("Expected 6 shards, got %d", len(shards))
+	}
+	last := shards[5]
+	if last.Pair != "0xb" || !last.Start.Equal(start.Add(48*time.Hour)) || !last.End.Equal(start.Add(60*time.Hour)) {
+		t.Errorf("Unexpected last shard %+v", last)
+	}
+}
+
+func TestBackfillResumes(t *testing.T) {
+	store := db.NewMemoryStore()
+	subgraph := &fakeSubgraph{failAfter: 3}
+	subgraph.add(swapsAt(10, 20, 100, 110, 120, 250)...)
+	syncer := testSyncer(store, subgraph)
+	path := filepath.Join(t.TempDir(), "progress.json")
+	progress, err := OpenProgress(path)
+	if err != nil {
+		t.Fatalf("OpenProgress failed: %v", err)
+	}
+	shards := Shards([]string{"0xpair"}, []Entity{EntitySwaps}, time.Unix(0, 0), time.Unix(300, 0), 100*time.Second)
+
+	// The subgraph fails after three pages: some shards fail, none stop the run.
+	summary, err := NewBackfill(syncer, 1, progress).Run(context.Background(), shards)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Shards != 3 || summary.Failed == 0 {
+		t.Errorf("Expected failed shards, got %+v", summary)
+	}
+
+	// A second run from the saved progress only runs what is left.
+	subgraph.failAfter = 0
+	progress, err = OpenProgress(path)
+	if err != nil {
+		t.Fatalf("OpenProgress failed: %v", err)
+	}
+	summary, err = NewBackfill(syncer, 3, progress).Run(context.Background(), shards)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if summary.Done+summary.Skipped != 3 || summary.Skipped == 0 || summary.Failed != 0 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	for _, shard := range progress.Shards() {
+		if shard.Status != ShardDone {
+			t.Errorf("Expected %s done, got %s", shard.Key, shard.Status)
+		}
+	}
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	if len(points) != 6 {
+		t.Errorf("Expected 6 swaps, got %d", len(points))
+	}
+
+	calls := subgraph.calls
+	if summary, _ = NewBackfill(syncer, 2, progress).Run(context.Background(), shards); summary.Skipped != 3 || subgraph.calls != calls {
+		t.Errorf("Expected every shard to be skipped, got %+v", summary)
+	}
+}
+
+func TestBackfillStops(t *testing.T) {
+	subgraph := &fakeSubgraph{}
+	subgraph.add(swapsAt(10, 20)...)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	shards := Shards([]string{"0xpair"}, nil, time.Unix(0, 0), time.Unix(100, 0), 0)
+	if _, err := NewBackfill(testSyncer(db.NewMemoryStore(), subgraph), 2, nil).Run(ctx, shards); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if subgraph.calls != 0 {
+		t.Errorf("Expected no queries after cancel, got %d", subgraph.calls)
+	}
+}
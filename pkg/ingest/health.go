@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/ethrpc"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// Reference is what the subgraph's latest block is compared to. Block is 0
+// when the reference does not know block numbers.
+type Reference interface {
+	Head() (block int64, timestamp time.Time, err error)
+}
+
+// RPCReference uses the head of an Ethereum node.
+type RPCReference struct {
+	Client *ethrpc.Client
+}
+
+func (r RPCReference) Head() (int64, time.Time, error) {
+	block, err := r.Client.BlockByNumber(0)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int64(block.Number), time.Unix(int64(block.Timestamp), 0).UTC(), nil
+}
+
+// BlockTime returns the timestamp of block, for subgraphs whose _meta has no
+// block timestamp.
+func (r RPCReference) BlockTime(block int64) (time.Time, error) {
+	b, err := r.Client.BlockByNumber(uint64(block))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(b.Timestamp), 0).UTC(), nil
+}
+
+// ClockReference uses the wall clock: a subgraph is as far behind as its
+// latest block is old.
+type ClockReference struct{}
+
+func (ClockReference) Head() (int64, time.Time, error) {
+	return 0, time.Now().UTC(), nil
+}
+
+// Health is the result of a HealthChecker.Check.
+type Health struct {
+	Meta      uniswap.Meta
+	HeadBlock int64
+	HeadTime  time.Time
+	// IndexedAt is the time of the subgraph's latest block, zero if unknown.
+	IndexedAt    time.Time
+	CheckedAt    time.Time
+	BlocksBehind int64
+	// Lag is how far the subgraph's latest block is behind the reference,
+	// or 0 when the block has no timestamp.
+	Lag time.Duration
+	// Stale is set with the reasons when the subgraph is too far behind or
+	// has indexing errors.
+	Stale   bool
+	Reasons []string
+}
+
+func (h *Health) String() string {
+	s := fmt.Sprintf("block %d, %s behind", h.Meta.Block.Number, h.Lag.Round(time.Second))
+	if h.HeadBlock > 0 {
+		s += fmt.Sprintf(" (%d blocks)", h.BlocksBehind)
+	}
+	if h.Stale {
+		s += ": stale, " + strings.Join(h.Reasons, ", ")
+	}
+	return s
+}
+
+// HealthChecker compares the subgraph's _meta with a Reference. Checks are
+// cached for CacheFor, so the Syncer can check before every job.
+type HealthChecker struct {
+	Reference Reference
+	// MaxLag and MaxBlocksBehind are the limits past which the subgraph is
+	// stale; 0 disables a limit.
+	MaxLag          time.Duration
+	MaxBlocksBehind int64
+	// IndexingErrors marks a subgraph with indexing errors stale.
+	IndexingErrors bool
+	CacheFor       time.Duration
+	Meta           func() (*uniswap.Meta, error)
+
+	mu   sync.Mutex
+	last *Health
+}
+
+func NewHealthChecker(reference Reference) *HealthChecker {
+	return &HealthChecker{
+		Reference:      reference,
+		MaxLag:         5 * time.Minute,
+		IndexingErrors: true,
+		CacheFor:       15 * time.Second,
+		Meta:           uniswap.QueryMeta,
+	}
+}
+
+// Check returns the subgraph's health, from the cache when recent enough.
+func (h *HealthChecker) Check() (*Health, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last != nil && time.Since(h.last.CheckedAt) < h.CacheFor {
+		return h.last, nil
+	}
+	meta, err := h.Meta()
+	if err != nil {
+		return nil, fmt.Errorf("subgraph _meta: %v", err)
+	}
+	headBlock, headTime, err := h.Reference.Head()
+	if err != nil {
+		return nil, fmt.Errorf("reference head: %v", err)
+	}
+
+	health := &Health{Meta: *meta, HeadBlock: headBlock, HeadTime: headTime, CheckedAt: time.Now()}
+	if headBlock > 0 && headBlock > meta.Block.Number {
+		health.BlocksBehind = headBlock - meta.Block.Number
+	}
+	indexed := meta.Block.Time()
+	if rpc, ok := h.Reference.(RPCReference); ok && indexed.IsZero() && meta.Block.Number > 0 {
+		if indexed, err = rpc.BlockTime(meta.Block.Number); err != nil {
+			return nil, fmt.Errorf("reference block %d: %v", meta.Block.Number, err)
+		}
+	}
+	health.IndexedAt = indexed
+	if !indexed.IsZero() && headTime.After(indexed) {
+		health.Lag = headTime.Sub(indexed)
+	}
+
+	if h.IndexingErrors && meta.HasIndexingErrors {
+		health.Reasons = append(health.Reasons, "indexing errors")
+	}
+	if h.MaxLag > 0 && health.Lag > h.MaxLag {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("lag %s over %s", health.Lag.Round(time.Second), h.MaxLag))
+	}
+	if h.MaxBlocksBehind > 0 && health.BlocksBehind > h.MaxBlocksBehind {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("%d blocks behind, over %d", health.BlocksBehind, h.MaxBlocksBehind))
+	}
+	health.Stale = len(health.Reasons) > 0
+	h.last = health
+	return health, nil
+}
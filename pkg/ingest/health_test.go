@@ -0,0 +1,102 @@
+package ingest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+type fixedReference struct {
+	block int64
+	time  time.Time
+}
+
+func (r fixedReference) Head() (int64, time.Time, error) {
+	return r.block, r.time, nil
+}
+
+func testHealthChecker(meta uniswap.Meta, head fixedReference, calls *int) *HealthChecker {
+	checker := NewHealthChecker(head)
+	checker.MaxBlocksBehind = 50
+	checker.Meta = func() (*uniswap.Meta, error) {
+		*calls++
+		return &meta, nil
+	}
+	return checker
+}
+
+func TestHealthChecker(t *testing.T) {
+	now := time.Unix(1680000000, 0).UTC()
+	calls := 0
+	meta := uniswap.Meta{Block: uniswap.MetaBlock{Number: 1000, Timestamp: now.Add(-time.Minute).Unix()}}
+	checker := testHealthChecker(meta, fixedReference{1005, now}, &calls)
+	health, err := checker.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if health.Stale || health.BlocksBehind != 5 || health.Lag != time.Minute {
+		t.Errorf("Expected a healthy subgraph, got %s", health)
+	}
+	if _, err := checker.Check(); err != nil || calls != 1 {
+		t.Errorf("Expected the cached check, got %d calls", calls)
+	}
+
+	meta.HasIndexingErrors = true
+	meta.Block.Timestamp = now.Add(-time.Hour).Unix()
+	checker = testHealthChecker(meta, fixedReference{1100, now}, &calls)
+	health, _ = checker.Check()
+	if !health.Stale || len(health.Reasons) != 3 {
+		t.Errorf("Expected 3 reasons, got %s", health)
+	}
+	if !strings.Contains(health.String(), "lag 1h0m0s over 5m0s") {
+		t.Errorf("Unexpected string %s", health)
+	}
+}
+
+func TestSyncerStaleSubgraph(t *testing.T) {
+	calls := 0
+	meta := uniswap.Meta{Block: uniswap.MetaBlock{Number: 1000, Timestamp: 200}}
+	checker := testHealthChecker(meta, fixedReference{0, time.Unix(200+3600, 0)}, &calls)
+
+	subgraph := &fakeSubgraph{}
+	subgraph.add(swapsAt(100, 150)...)
+	store := db.NewMemoryStore()
+	syncer := testSyncer(store, subgraph)
+	syncer.Health = checker
+	syncer.PauseInterval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	job := Job{Entity: EntitySwaps, Pair: "0xpair"}
+	if _, err := syncer.SyncContext(ctx, job); err != context.DeadlineExceeded {
+		t.Errorf("Expected the sync to pause until the deadline, got %v", err)
+	}
+	if subgraph.calls != 0 {
+		t.Errorf("Expected no queries while paused, got %d", subgraph.calls)
+	}
+
+	syncer.OnStale = StaleFlag
+	result, err := syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !result.Stale || result.Records != 2 {
+		t.Errorf("Expected 2 flagged records, got %+v", result)
+	}
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	for _, point := range points {
+		if point.Fields[StaleField] != true {
+			t.Errorf("Expected %s to be flagged", point.Key)
+		}
+	}
+
+	// A window the subgraph has not indexed past is not done, however old.
+	window := Job{Entity: EntitySwaps, Pair: "0xpair", Start: time.Unix(100, 0), End: time.Unix(190, 0)}
+	if result, _ = syncer.Sync(window); result.Done {
+		t.Errorf("Expected the window to wait for the subgraph, got %+v", result)
+	}
+}
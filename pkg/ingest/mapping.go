@@ -0,0 +1,367 @@
+package ingest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// Measurements written for each entity type.
+const (
+	MeasurementPair     = "pair"
+	MeasurementToken    = "token"
+	MeasurementSwap     = "swap"
+	MeasurementMint     = "mint"
+	MeasurementBurn     = "burn"
+	MeasurementTokenDay = "token_day"
+	MeasurementPairDay  = "pair_day"
+	MeasurementGlobal   = "global_stats"
+)
+
+// Mapper converts subgraph entities into storage points. Every measurement
+// has an explicit schema below: tags identify the pair or token, fields hold
+// the numeric values parsed from the subgraph's decimal strings, and the
+// point time comes from the entity itself. Entities that carry no timestamp
+// (PairData, Token, GlobalStats) are stamped with SnapshotTime, or the current time.
+//
+// Event entities only reference their pair by id, their only tag. Pairs
+// registered with Register add token0, token1 and symbol fields to their
+// events; as fields they leave the series of an event the same whether or
+// not its pair was known when it was written.
+type Mapper struct {
+	SnapshotTime time.Time
+
+	mu    sync.RWMutex
+	pairs map[string]uniswap.PairData
+}
+
+func NewMapper() *Mapper {
+	return &Mapper{pairs: make(map[string]uniswap.PairData)}
+}
+
+// Register records pair metadata added to the events on those pairs.
+func (m *Mapper) Register(pairs ...uniswap.PairData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, pair := range pairs {
+		m.pairs[strings.ToLower(pair.ID)] = pair
+	}
+}
+
+func (m *Mapper) known(pair string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.pairs[strings.ToLower(pair)]
+	return ok
+}
+
+// Points converts one entity, a pointer to one, or a slice (or pointer to a
+// slice, as returned by the Query functions) of supported entities.
+func (m *Mapper) Points(entities interface{}) ([]db.Point, error) {
+	value := reflect.ValueOf(entities)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice {
+		point, err := m.point(value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return []db.Point{point}, nil
+	}
+	points := make([]db.Point, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		item := value.Index(i)
+		if item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				continue
+			}
+			item = item.Elem()
+		}
+		point, err := m.point(item.Interface())
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func (m *Mapper) point(entity interface{}) (db.Point, error) {
+	switch e := entity.(type) {
+	case uniswap.PairData:
+		return m.pairPoint(e)
+	case uniswap.Token:
+		return m.tokenPoint(e)
+	case uniswap.Swap:
+		return m.swapPoint(e)
+	case uniswap.Mint:
+		return m.liquidityPoint(MeasurementMint, e.ID, e.Transaction, e.Pair, e.To, e.LogIndex, e.Liquidity, e.Amount0, e.Amount1, e.AmountUSD)
+	case uniswap.Burn:
+		return m.liquidityPoint(MeasurementBurn, e.ID, e.Transaction, e.Pair, e.To, e.LogIndex, e.Liquidity, e.Amount0, e.Amount1, e.AmountUSD)
+	case uniswap.TokenDayData:
+		return tokenDayPoint(e)
+	case uniswap.PairDailyAggregated:
+		return pairDayPoint(e)
+	case uniswap.GlobalStats:
+		return m.globalPoint(e)
+	default:
+		return db.Point{}, fmt.Errorf("no storage mapping for %T", entity)
+	}
+}
+
+func (m *Mapper) pairPoint(pair uniswap.PairData) (db.Point, error) {
+	tags := map[string]string{"pair": strings.ToLower(pair.ID)}
+	if pair.Token0 != nil && pair.Token1 != nil {
+		tags["token0"] = strings.ToLower(pair.Token0.ID)
+		tags["token1"] = strings.ToLower(pair.Token1.ID)
+		tags["symbol"] = pair.Token0.Symbol + "-" + pair.Token1.Symbol
+	}
+	fields, err := decimalFields(map[string]string{
+		"reserve0":    pair.Reserve0,
+		"reserve1":    pair.Reserve1,
+		"reserve_usd": pair.ReserveUSD,
+		"volume_usd":  pair.VolumeUSD,
+	})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("pair %s: %v", pair.ID, err)
+	}
+	if err := integerFields(fields, map[string]string{"tx_count": pair.TxCount}); err != nil {
+		return db.Point{}, fmt.Errorf("pair %s: %v", pair.ID, err)
+	}
+	return db.Point{Measurement: MeasurementPair, Tags: tags, Fields: fields, Time: m.snapshotTime()}, nil
+}
+
+func (m *Mapper) tokenPoint(token uniswap.Token) (db.Point, error) {
+	fields, err := decimalFields(map[string]string{"derived_eth": token.DerivedETH})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("token %s: %v", token.ID, err)
+	}
+	stringFields(fields, map[string]string{"name": token.Name})
+	tags := map[string]string{"token": strings.ToLower(token.ID)}
+	if token.Symbol != "" {
+		tags["symbol"] = token.Symbol
+	}
+	return db.Point{Measurement: MeasurementToken, Tags: tags, Fields: fields, Time: m.snapshotTime()}, nil
+}
+
+func (m *Mapper) swapPoint(swap uniswap.Swap) (db.Point, error) {
+	fields, err := decimalFields(map[string]string{
+		"amount0_in":  swap.Amount0In,
+		"amount0_out": swap.Amount0Out,
+		"amount1_in":  swap.Amount1In,
+		"amount1_out": swap.Amount1Out,
+		"amount_usd":  swap.AmountUSD,
+	})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("swap %s: %v", swap.ID, err)
+	}
+	stringFields(fields, map[string]string{"to": swap.To, "sender": swap.Sender, "from": swap.From})
+	return m.eventPoint(MeasurementSwap, swap.ID, swap.Transaction, swap.Pair, swap.LogIndex, fields)
+}
+
+func (m *Mapper) liquidityPoint(measurement, id string, transaction *uniswap.Transaction, pair *uniswap.Pairs, to, logIndex, liquidity, amount0, amount1, amountUSD string) (db.Point, error) {
+	fields, err := decimalFields(map[string]string{
+		"liquidity":  liquidity,
+		"amount0":    amount0,
+		"amount1":    amount1,
+		"amount_usd": amountUSD,
+	})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("%s %s: %v", measurement, id, err)
+	}
+	stringFields(fields, map[string]string{"to": to})
+	return m.eventPoint(measurement, id, transaction, pair, logIndex, fields)
+}
+
+// eventPoint adds the fields and tags shared by swaps, mints and burns. The
+// point is keyed by the subgraph id and stamped with EventTime, so writing
+// the same event again overwrites it instead of adding a duplicate.
+func (m *Mapper) eventPoint(measurement, id string, transaction *uniswap.Transaction, pair *uniswap.Pairs, logIndex string, fields map[string]interface{}) (db.Point, error) {
+	if transaction == nil {
+		return db.Point{}, fmt.Errorf("%s %s: missing transaction", measurement, id)
+	}
+	timestamp, err := strconv.ParseInt(transaction.Timestamp, 10, 64)
+	if err != nil {
+		return db.Point{}, fmt.Errorf("%s %s: invalid timestamp: %v", measurement, id, err)
+	}
+	if err := integerFields(fields, map[string]string{"block": transaction.BlockNumber, "log_index": logIndex}); err != nil {
+		return db.Point{}, fmt.Errorf("%s %s: %v", measurement, id, err)
+	}
+	stringFields(fields, map[string]string{"id": id, "transaction": transaction.ID})
+
+	tags := make(map[string]string)
+	if pair != nil {
+		tags["pair"] = strings.ToLower(pair.ID)
+		m.mu.RLock()
+		known, ok := m.pairs[tags["pair"]]
+		m.mu.RUnlock()
+		if ok && known.Token0 != nil && known.Token1 != nil {
+			stringFields(fields, map[string]string{
+				"token0": strings.ToLower(known.Token0.ID),
+				"token1": strings.ToLower(known.Token1.ID),
+				"symbol": known.Token0.Symbol + "-" + known.Token1.Symbol,
+			})
+		}
+	}
+	return db.Point{
+		Measurement: measurement,
+		Tags:        tags,
+		Fields:      fields,
+		Time:        EventTime(timestamp, id, logIndex),
+		Key:         id,
+	}, nil
+}
+
+// EventTime returns the storage time of an event: its block timestamp plus
+// its log index in nanoseconds. Blocks have strictly increasing timestamps
+// and log indexes are unique within a block, so every event on a pair gets a
+// distinct time that does not change between runs. Events without a log
+// index fall back to an offset hashed from their id.
+func EventTime(timestamp int64, id, logIndex string) time.Time {
+	offset, err := strconv.ParseInt(logIndex, 10, 64)
+	if err != nil {
+		hash := fnv.New32a()
+		hash.Write([]byte(id))
+		offset = int64(hash.Sum32()) % int64(time.Second)
+	}
+	return time.Unix(timestamp, offset).UTC()
+}
+
+func tokenDayPoint(day uniswap.TokenDayData) (db.Point, error) {
+	// TokenDayData ids are "<token address>-<day number>".
+	token := day.ID
+	if i := strings.LastIndex(token, "-"); i > 0 {
+		token = token[:i]
+	}
+	fields, err := decimalFields(map[string]string{
+		"price_usd":           day.PriceUSD,
+		"total_liquidity":     day.TotalLiquidity,
+		"total_liquidity_usd": day.TotalLiquidityUSD,
+		"total_liquidity_eth": day.TotalLiquidityETH,
+		"daily_volume":        day.DailyVolume,
+		"daily_volume_usd":    day.DailyVolumeUSD,
+		"daily_volume_eth":    day.DailyVolumeETH,
+	})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("token day %s: %v", day.ID, err)
+	}
+	return db.Point{
+		Measurement: MeasurementTokenDay,
+		Tags:        map[string]string{"token": strings.ToLower(token)},
+		Fields:      fields,
+		Time:        time.Unix(int64(day.Date), 0).UTC(),
+	}, nil
+}
+
+func pairDayPoint(day uniswap.PairDailyAggregated) (db.Point, error) {
+	if day.PairAddress == "" {
+		return db.Point{}, fmt.Errorf("pair day %d: missing pairAddress", day.Date)
+	}
+	fields, err := decimalFields(map[string]string{
+		"reserve0":            day.Reserve0,
+		"reserve1":            day.Reserve1,
+		"reserve_usd":         day.ReserveUSD,
+		"daily_volume_token0": day.DailyVolumeToken0,
+		"daily_volume_token1": day.DailyVolumeToken1,
+		"daily_volume_usd":    day.DailyVolumeUSD,
+	})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("pair day %s-%d: %v", day.PairAddress, day.Date, err)
+	}
+	return db.Point{
+		Measurement: MeasurementPairDay,
+		Tags:        map[string]string{"pair": strings.ToLower(day.PairAddress)},
+		Fields:      fields,
+		Time:        time.Unix(int64(day.Date), 0).UTC(),
+	}, nil
+}
+
+func (m *Mapper) globalPoint(stats uniswap.GlobalStats) (db.Point, error) {
+	fields, err := decimalFields(map[string]string{
+		"total_volume_usd":    stats.TotalVolumeUSD,
+		"total_liquidity_usd": stats.TotalLiquidityUSD,
+	})
+	if err != nil {
+		return db.Point{}, fmt.Errorf("global stats: %v", err)
+	}
+	if err := integerFields(fields, map[string]string{"tx_count": stats.TxCount}); err != nil {
+		return db.Point{}, fmt.Errorf("global stats: %v", err)
+	}
+	return db.Point{Measurement: MeasurementGlobal, Tags: map[string]string{}, Fields: fields, Time: m.snapshotTime()}, nil
+}
+
+func (m *Mapper) snapshotTime() time.Time {
+	if m.SnapshotTime.IsZero() {
+		return time.Now().UTC()
+	}
+	return m.SnapshotTime
+}
+
+// decimalFields parses the subgraph's BigDecimal strings. Empty strings, for
+// fields that were not queried, are left out.
+func decimalFields(values map[string]string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", name, value)
+		}
+		fields[name] = parsed
+	}
+	return fields, nil
+}
+
+func integerFields(fields map[string]interface{}, values map[string]string) error {
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", name, value)
+		}
+		fields[name] = parsed
+	}
+	return nil
+}
+
+func stringFields(fields map[string]interface{}, values map[string]string) {
+	for name, value := range values {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+}
+
+// WriteEntities maps entities with a new Mapper and writes them to store.
+// Each argument may be an entity, a slice of entities, or a pointer to either.
+func WriteEntities(store db.Store, entities ...interface{}) error {
+	return NewMapper().WriteEntities(store, entities...)
+}
+
+// WriteEntities maps entities and writes them to store in a single call.
+func (m *Mapper) WriteEntities(store db.Store, entities ...interface{}) error {
+	var points []db.Point
+	for _, entity := range entities {
+		converted, err := m.Points(entity)
+		if err != nil {
+			return err
+		}
+		points = append(points, converted...)
+	}
+	return store.WritePoints(points)
+}
@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+func testPairData() uniswap.PairData {
+	return uniswap.PairData{
+		ID:         "0xPAIR",
+		Token0:     &uniswap.Token{ID: "0xUSDC", Symbol: "USDC"},
+		Token1:     &uniswap.Token{ID: "0xWETH", Symbol: "WETH"},
+		Reserve0:   "2000000",
+		Reserve1:   "1000",
+		ReserveUSD: "4000000",
+		VolumeUSD:  "123456.78",
+		TxCount:    "42",
+	}
+}
+
+func testSwap(id, timestamp string) uniswap.Swap {
+	return uniswap.Swap{
+		ID:          id,
+		Transaction: &uniswap.Transaction{ID: id[:5], BlockNumber: "17000000", Timestamp: timestamp},
+		Pair:        &uniswap.Pairs{ID: "0xpair"},
+		Amount0In:   "2000",
+		Amount0Out:  "0",
+		Amount1In:   "0",
+		Amount1Out:  "0.99",
+		AmountUSD:   "2000",
+		To:          "0xto",
+		LogIndex:    "7",
+	}
+}
+
+func TestMapperPairPoint(t *testing.T) {
+	mapper := NewMapper()
+	mapper.SnapshotTime = time.Unix(1680000000, 0)
+	points, err := mapper.Points(testPairData())
+	if err != nil {
+		t.Fatalf("Points failed: %v", err)
+	}
+	point := points[0]
+	if point.Measurement != MeasurementPair || point.Tags["pair"] != "0xpair" || point.Tags["symbol"] != "USDC-WETH" {
+		t.Errorf("Unexpected tags %+v", point)
+	}
+	if point.Fields["reserve_usd"] != 4000000.0 || point.Fields["tx_count"] != int64(42) {
+		t.Errorf("Unexpected fields %+v", point.Fields)
+	}
+	if !point.Time.Equal(mapper.SnapshotTime) {
+		t.Errorf("Expected snapshot time, got %v", point.Time)
+	}
+}
+
+func TestMapperEventsUseRegisteredPairs(t *testing.T) {
+	mapper := NewMapper()
+	mapper.Register(testPairData())
+	swaps := []*uniswap.Swap{ptr(testSwap("0xaaaa-7", "1680000100"))}
+
+	points, err := mapper.Points(&swaps)
+	if err != nil {
+		t.Fatalf("Points failed: %v", err)
+	}
+	point := points[0]
+	if len(point.Tags) != 1 || point.Fields["token0"] != "0xusdc" || point.Fields["symbol"] != "USDC-WETH" {
+		t.Errorf("Expected the pair tag and fields from the registered pair, got %+v, %+v", point.Tags, point.Fields)
+	}
+	if point.Fields["amount1_out"] != 0.99 || point.Fields["log_index"] != int64(7) || point.Fields["id"] != "0xaaaa-7" {
+		t.Errorf("Unexpected fields %+v", point.Fields)
+	}
+	if point.Time.Unix() != 1680000100 {
+		t.Errorf("Expected the transaction timestamp, got %v", point.Time)
+	}
+}
+
+func TestMapperTokenDayAndErrors(t *testing.T) {
+	points, err := NewMapper().Points([]uniswap.TokenDayData{{
+		ID: "0x6b17-19448", Date: 1680307200, PriceUSD: "1.001", DailyVolumeUSD: "1000",
+	}})
+	if err != nil {
+		t.Fatalf("Points failed: %v", err)
+	}
+	if points[0].Tags["token"] != "0x6b17" || points[0].Time.Unix() != 1680307200 {
+		t.Errorf("Unexpected token day point %+v", points[0])
+	}
+
+	if _, err := NewMapper().Points(uniswap.Pairs{ID: "0x1"}); err == nil {
+		t.Error("Expected an error for an unmapped type")
+	}
+	bad := testSwap("0xbbbb-1", "not-a-time")
+	if _, err := NewMapper().Points(bad); err == nil {
+		t.Error("Expected an error for an invalid timestamp")
+	}
+}
+
+func TestWriteEntities(t *testing.T) {
+	store := db.NewMemoryStore()
+	stats := uniswap.GlobalStats{TotalVolumeUSD: "1", TotalLiquidityUSD: "2", TxCount: "3"}
+	if err := WriteEntities(store, testPairData(), &stats, []uniswap.Swap{testSwap("0xcccc-1", "1680000200")}); err != nil {
+		t.Fatalf("WriteEntities failed: %v", err)
+	}
+	for _, measurement := range []string{MeasurementPair, MeasurementGlobal, MeasurementSwap} {
+		points, _ := store.ReadSeries(db.SeriesQuery{Measurement: measurement})
+		if len(points) != 1 {
+			t.Errorf("Expected one %s point, got %d", measurement, len(points))
+		}
+	}
+}
+
+func TestWriteEntitiesIsIdempotent(t *testing.T) {
+	store := db.NewMemoryStore()
+	swaps := []uniswap.Swap{testSwap("0xdddd-7", "1680000300")}
+	for i := 0; i < 2; i++ {
+		if err := WriteEntities(store, swaps); err != nil {
+			t.Fatalf("WriteEntities failed: %v", err)
+		}
+	}
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	if len(points) != 1 {
+		t.Fatalf("Expected the second write to replace the first, got %d points", len(points))
+	}
+	if points[0].Key != "0xdddd-7" || points[0].Time.Nanosecond() != 7 {
+		t.Errorf("Expected the swap id as key and the log index in the time, got %+v", points[0])
+	}
+}
+
+func TestEventSeriesIgnoresRegistration(t *testing.T) {
+	store := db.NewMemoryStore()
+	mapper := NewMapper()
+	swap := testSwap("0xeeee-7", "1680000400")
+	before, err := mapper.Points(swap)
+	if err != nil {
+		t.Fatalf("Points failed: %v", err)
+	}
+	mapper.Register(uniswap.PairData{ID: "0xpair", Token0: &uniswap.Token{ID: "0xUSDC", Symbol: "USDC"}, Token1: &uniswap.Token{ID: "0xWETH", Symbol: "WETH"}})
+	after, err := mapper.Points(swap)
+	if err != nil {
+		t.Fatalf("Points failed: %v", err)
+	}
+	if !reflect.DeepEqual(before[0].Tags, after[0].Tags) || !before[0].Time.Equal(after[0].Time) {
+		t.Errorf("Expected the same series and time, got %v at %v and %v at %v", before[0].Tags, before[0].Time, after[0].Tags, after[0].Time)
+	}
+	store.WritePoints(before)
+	store.WritePoints(after)
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	if len(points) != 1 || points[0].Fields["symbol"] != "USDC-WETH" {
+		t.Errorf("Expected one point with the registered fields, got %+v", points)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	if got := EventTime(1680000000, "0xtx-0", "12"); got.Unix() != 1680000000 || got.Nanosecond() != 12 {
+		t.Errorf("Unexpected event time %v", got)
+	}
+	first, second := EventTime(1680000000, "0xtx-0", ""), EventTime(1680000000, "0xtx-0", "")
+	if !first.Equal(second) || first.Unix() != 1680000000 {
+		t.Errorf("Expected a stable time within the second, got %v and %v", first, second)
+	}
+}
+
+func TestWriteEntitiesToSQLite(t *testing.T) {
+	store, err := db.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer store.Close()
+
+	mapper := NewMapper()
+	mapper.SnapshotTime = time.Unix(1680000000, 0)
+	mapper.Register(testPairData())
+	pair := testPairData()
+	days := []uniswap.PairDailyAggregated{{Date: 1679961600, PairAddress: "0xPAIR", ReserveUSD: "4000000", DailyVolumeUSD: "250000"}}
+	err = mapper.WriteEntities(store, pair, *pair.Token0, []uniswap.Swap{testSwap("0xeeee-7", "1680000400")}, days)
+	if err != nil {
+		t.Fatalf("WriteEntities failed: %v", err)
+	}
+
+	for measurement, field := range map[string]string{
+		MeasurementPair:    "reserve_usd",
+		MeasurementToken:   "",
+		MeasurementSwap:    "amount_usd",
+		MeasurementPairDay: "daily_volume_usd",
+	} {
+		points, err := store.ReadSeries(db.SeriesQuery{Measurement: measurement})
+		if err != nil {
+			t.Fatalf("ReadSeries %s failed: %v", measurement, err)
+		}
+		if len(points) != 1 {
+			t.Errorf("Expected one %s point, got %d", measurement, len(points))
+			continue
+		}
+		if _, ok := points[0].Fields[field]; field != "" && !ok {
+			t.Errorf("Expected %s on %s, got %+v", field, measurement, points[0].Fields)
+		}
+	}
+	swaps, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap, Tags: map[string]string{"pair": "0xpair"}})
+	if len(swaps) != 1 || swaps[0].Key != "0xeeee-7" {
+		t.Errorf("Unexpected swaps %+v", swaps)
+	}
+}
+
+func ptr(swap uniswap.Swap) *uniswap.Swap {
+	return &swap
+}
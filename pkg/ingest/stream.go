@@ -0,0 +1,284 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/router"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// Event is a swap, mint or burn delivered by a Streamer.
+type Event struct {
+	Entity    Entity
+	ID        string
+	Pair      string
+	Timestamp time.Time
+	LogIndex  int64
+	// Value is the uniswap.Swap, uniswap.Mint or uniswap.Burn.
+	Value interface{}
+}
+
+// Streamer polls the subgraph for new events of a set of pairs, or of every
+// pair of a token.
+//
+// Each poll re-reads the last Overlap before the newest event seen, so events
+// the subgraph indexes late, or in a block that shares a second with one
+// already read, are still picked up. Events already delivered are dropped by
+// id, so each event is delivered once. The events of a poll are delivered in
+// (timestamp, log index) order.
+type Streamer struct {
+	Pairs []string
+	// Token, when set, streams the events of its most liquid pairs instead
+	// of Pairs. MaxPairs bounds the pairs looked up on each side.
+	Token    string
+	MaxPairs int
+
+	Entities []Entity
+	// Start is where the first poll begins; zero starts at the time of the
+	// first poll.
+	Start    time.Time
+	Interval time.Duration
+	Overlap  time.Duration
+	PageSize int
+	// OnError, when set, is called with the error of a failed poll, which is
+	// then retried after Interval. Without it Run returns the error.
+	OnError func(error)
+
+	Fetchers
+	PairLookup router.PairSource
+
+	mu    sync.Mutex
+	where map[string]interface{}
+	from  map[Entity]int64
+	// seen holds the timestamp of each event delivered within the overlap.
+	seen map[string]int64
+}
+
+// NewStreamer streams the events of pairs, or of every pair if none is given.
+func NewStreamer(pairs ...string) *Streamer {
+	return &Streamer{
+		Pairs:      pairs,
+		MaxPairs:   100,
+		Entities:   Entities,
+		Interval:   15 * time.Second,
+		Overlap:    2 * time.Minute,
+		PageSize:   1000,
+		Fetchers:   DefaultFetchers(),
+		PairLookup: uniswap.QueryPairs,
+	}
+}
+
+// NewTokenStreamer streams the events of the pairs of token.
+func NewTokenStreamer(token string) *Streamer {
+	s := NewStreamer()
+	s.Token = token
+	return s
+}
+
+// Poll fetches the events since the previous poll. A failed poll changes
+// nothing, so the next one returns its events too.
+func (s *Streamer) Poll() ([]Event, error) {
+	return s.PollContext(context.Background())
+}
+
+// PollContext is Poll with a context its queries are cancelled with.
+func (s *Streamer) PollContext(ctx context.Context) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.where == nil {
+		where, err := s.filter()
+		if err != nil {
+			return nil, err
+		}
+		start := s.Start
+		if start.IsZero() {
+			start = time.Now()
+		}
+		s.where, s.seen, s.from = where, make(map[string]int64), make(map[Entity]int64)
+		for _, entity := range s.Entities {
+			s.from[entity] = start.Unix()
+		}
+	}
+
+	overlap := int64(s.Overlap / time.Second)
+	var fresh []record
+	from := make(map[Entity]int64, len(s.Entities))
+	entities := make(map[string]Entity)
+	for _, entity := range s.Entities {
+		records, err := s.fetchSince(ctx, entity, s.from[entity])
+		if err != nil {
+			return nil, err
+		}
+		newest := s.from[entity] + overlap
+		for _, r := range records {
+			if r.timestamp > newest {
+				newest = r.timestamp
+			}
+			if _, ok := s.seen[r.id]; ok {
+				continue
+			}
+			if _, ok := entities[r.id]; ok {
+				continue
+			}
+			entities[r.id] = entity
+			fresh = append(fresh, r)
+		}
+		from[entity] = newest - overlap
+	}
+
+	// The poll succeeded: move the windows and forget events that are now
+	// before every window.
+	oldest := int64(-1)
+	for entity, value := range from {
+		s.from[entity] = value
+		if oldest < 0 || value < oldest {
+			oldest = value
+		}
+	}
+	for _, r := range fresh {
+		s.seen[r.id] = r.timestamp
+	}
+	for id, timestamp := range s.seen {
+		if timestamp < oldest {
+			delete(s.seen, id)
+		}
+	}
+
+	sort.SliceStable(fresh, func(i, j int) bool {
+		a, b := fresh[i], fresh[j]
+		if a.timestamp != b.timestamp {
+			return a.timestamp < b.timestamp
+		}
+		if a.logIndex != b.logIndex {
+			return a.logIndex < b.logIndex
+		}
+		return a.id < b.id
+	})
+	events := make([]Event, len(fresh))
+	for i, r := range fresh {
+		events[i] = Event{
+			Entity:    entities[r.id],
+			ID:        r.id,
+			Pair:      r.pair,
+			Timestamp: time.Unix(r.timestamp, 0).UTC(),
+			LogIndex:  r.logIndex,
+			Value:     r.entity,
+		}
+	}
+	return events, nil
+}
+
+// Run polls every Interval and calls handle with each event, until ctx is
+// done or handle returns an error.
+func (s *Streamer) Run(ctx context.Context, handle func(Event) error) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		events, err := s.PollContext(ctx)
+		switch {
+		case err != nil && s.OnError != nil:
+			s.OnError(err)
+		case err != nil:
+			return err
+		}
+		for _, event := range events {
+			if err := handle(event); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stream runs the streamer in a goroutine and delivers its events on a
+// channel, closed once it stops. The error channel receives the reason it
+// stopped, unless that is ctx being done.
+func (s *Streamer) Stream(ctx context.Context, buffer int) (<-chan Event, <-chan error) {
+	events := make(chan Event, buffer)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(events)
+		defer close(errs)
+		err := s.Run(ctx, func(event Event) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+	return events, errs
+}
+
+func (s *Streamer) fetchSince(ctx context.Context, entity Entity, from int64) ([]record, error) {
+	cursor := uniswap.NewCursor("timestamp", from)
+	var records []record
+	for {
+		page, err := s.fetch(ctx, entity, cursor.Args(s.where, s.PageSize))
+		if err != nil {
+			return nil, err
+		}
+		timestamps := make([]int64, len(page))
+		for i, r := range page {
+			timestamps[i] = r.timestamp
+		}
+		cursor.Advance(timestamps)
+		records = append(records, page...)
+		if len(page) < s.PageSize {
+			return records, nil
+		}
+	}
+}
+
+// filter returns the where argument selecting the streamed pairs.
+func (s *Streamer) filter() (map[string]interface{}, error) {
+	pairs := s.Pairs
+	if s.Token != "" {
+		token := strings.ToLower(s.Token)
+		pairs = nil
+		for _, side := range []string{"token0", "token1"} {
+			found, err := s.PairLookup(map[string]interface{}{
+				"first":          s.MaxPairs,
+				"orderBy":        "reserveUSD",
+				"orderDirection": "desc",
+				"where":          map[string]interface{}{side: token},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if found != nil {
+				for _, pair := range *found {
+					pairs = append(pairs, pair.ID)
+				}
+			}
+		}
+		if len(pairs) == 0 {
+			return nil, fmt.Errorf("no pairs found for token %s", token)
+		}
+	}
+	ids := make([]string, len(pairs))
+	for i, pair := range pairs {
+		ids[i] = strings.ToLower(pair)
+	}
+	switch len(ids) {
+	case 0:
+		return map[string]interface{}{}, nil
+	case 1:
+		return map[string]interface{}{"pair": ids[0]}, nil
+	default:
+		return map[string]interface{}{"pair_in": ids}, nil
+	}
+}
@@ -0,0 +1,115 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+func testStreamer(subgraph *fakeSubgraph) *Streamer {
+	streamer := NewStreamer("0xPAIR")
+	streamer.Entities = []Entity{EntitySwaps}
+	streamer.Swaps = subgraph.querySwaps
+	streamer.Start = time.Unix(1000, 0)
+	streamer.Overlap = 60 * time.Second
+	streamer.PageSize = 2
+	streamer.Interval = time.Millisecond
+	return streamer
+}
+
+func eventIDs(events []Event) []string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestStreamerPollsWithOverlap(t *testing.T) {
+	subgraph := &fakeSubgraph{}
+	subgraph.add(testSwap("0xa1-0", "900"), testSwap("0xa2-0", "1000"), testSwap("0xa3-0", "1010"), testSwap("0xa4-0", "1010"))
+	streamer := testStreamer(subgraph)
+
+	events, err := streamer.Poll()
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if ids := eventIDs(events); len(ids) != 3 || ids[0] != "0xa2-0" || ids[2] != "0xa4-0" {
+		t.Errorf("Unexpected events %v", ids)
+	}
+	if events[0].Entity != EntitySwaps || events[0].Pair != "0xpair" || events[0].LogIndex != 7 {
+		t.Errorf("Unexpected event %+v", events[0])
+	}
+
+	// A swap indexed late, older than the newest one delivered but within the
+	// overlap, and a newer one are delivered once, in order.
+	subgraph.add(testSwap("0xb2-0", "1020"), testSwap("0xb1-0", "1005"))
+	events, err = streamer.Poll()
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if ids := eventIDs(events); len(ids) != 2 || ids[0] != "0xb1-0" || ids[1] != "0xb2-0" {
+		t.Errorf("Expected only the two new swaps in order, got %v", ids)
+	}
+	if events, _ = streamer.Poll(); len(events) != 0 {
+		t.Errorf("Expected no events, got %v", eventIDs(events))
+	}
+}
+
+func TestStreamerFailedPollIsRetried(t *testing.T) {
+	subgraph := &fakeSubgraph{failAfter: 1}
+	subgraph.add(testSwap("0xa1-0", "1000"), testSwap("0xa2-0", "1000"), testSwap("0xa3-0", "1001"))
+	streamer := testStreamer(subgraph)
+	if _, err := streamer.Poll(); err == nil {
+		t.Fatal("Expected the second page to fail")
+	}
+	subgraph.failAfter = 0
+	events, err := streamer.Poll()
+	if err != nil || len(events) != 3 {
+		t.Errorf("Expected all 3 swaps after the failure, got %v, %v", eventIDs(events), err)
+	}
+}
+
+func TestStreamerChannel(t *testing.T) {
+	subgraph := &fakeSubgraph{}
+	subgraph.add(testSwap("0xa1-0", "1000"))
+	streamer := testStreamer(subgraph)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := streamer.Stream(ctx, 0)
+
+	if event := <-events; event.ID != "0xa1-0" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	subgraph.mu.Lock()
+	subgraph.swaps = append(subgraph.swaps, testSwap("0xa2-0", "1030"))
+	subgraph.mu.Unlock()
+	if event := <-events; event.ID != "0xa2-0" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	cancel()
+	for range events {
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("Expected no error after cancel, got %v", err)
+	}
+}
+
+func TestStreamerTokenFilter(t *testing.T) {
+	streamer := NewTokenStreamer("0xWETH")
+	streamer.PairLookup = func(args map[string]interface{}) (*[]uniswap.PairData, error) {
+		where := args["where"].(map[string]interface{})
+		if where["token0"] == "0xweth" {
+			return &[]uniswap.PairData{{ID: "0xP1"}}, nil
+		}
+		return &[]uniswap.PairData{{ID: "0xP2"}}, nil
+	}
+	where, err := streamer.filter()
+	if err != nil {
+		t.Fatalf("filter failed: %v", err)
+	}
+	if pairs := where["pair_in"].([]string); len(pairs) != 2 || pairs[0] != "0xp1" || pairs[1] != "0xp2" {
+		t.Errorf("Unexpected filter %v", where)
+	}
+}
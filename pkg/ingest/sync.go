@@ -0,0 +1,498 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// Entity is a kind of event the Syncer fetches.
+type Entity string
+
+const (
+	EntitySwaps Entity = "swaps"
+	EntityMints Entity = "mints"
+	EntityBurns Entity = "burns"
+)
+
+// Entities lists every entity a Syncer supports.
+var Entities = []Entity{EntitySwaps, EntityMints, EntityBurns}
+
+// entityMeasurements maps entities to the measurement their points are written to.
+var entityMeasurements = map[Entity]string{
+	EntitySwaps: MeasurementSwap,
+	EntityMints: MeasurementMint,
+	EntityBurns: MeasurementBurn,
+}
+
+// Job is the sync of one entity of one pair. Start and End optionally bound
+// it to Start <= timestamp < End; a bounded job has its own checkpoint, so
+// windows of the same pair can be synced independently.
+type Job struct {
+	Entity Entity
+	Pair   string
+	Start  time.Time
+	End    time.Time
+}
+
+// Jobs returns a job per pair and entity.
+func Jobs(pairs []string, entities ...Entity) []Job {
+	if len(entities) == 0 {
+		entities = Entities
+	}
+	jobs := make([]Job, 0, len(pairs)*len(entities))
+	for _, pair := range pairs {
+		for _, entity := range entities {
+			jobs = append(jobs, Job{Entity: entity, Pair: strings.ToLower(pair)})
+		}
+	}
+	return jobs
+}
+
+// CheckpointKey is the key the job's progress is stored under, e.g.
+// "swaps/0xb4e1...", or "swaps/0xb4e1.../1680307200-1680393600" for a bounded job.
+func (j Job) CheckpointKey() string {
+	key := string(j.Entity) + "/" + strings.ToLower(j.Pair)
+	if !j.Start.IsZero() || !j.End.IsZero() {
+		key += fmt.Sprintf("/%d-%d", unixOrZero(j.Start), unixOrZero(j.End))
+	}
+	return key
+}
+
+// SyncResult reports what one call to Sync did.
+type SyncResult struct {
+	Job        Job
+	Records    int
+	Pages      int
+	Checkpoint db.Checkpoint
+	// Done is set when a bounded job has reached its End.
+	Done bool
+	// Stale is set when the records were written from a stale subgraph
+	// under StaleFlag; Health is the check it was based on.
+	Stale  bool
+	Health *Health
+	// Reorged is set when records past the last confirmed block were
+	// deleted because the subgraph's chain changed since they were written.
+	Reorged bool
+}
+
+// StaleAction is what a Syncer does when its HealthChecker reports the
+// subgraph stale.
+type StaleAction int
+
+const (
+	// StalePause waits for the subgraph to catch up before syncing.
+	StalePause StaleAction = iota
+	// StaleFlag syncs anyway and sets StaleField on the points written.
+	StaleFlag
+)
+
+// StaleField is set to true on points written from a stale subgraph.
+const StaleField = "stale"
+
+// Syncer copies subgraph events into a Store incrementally. For each job it
+// reads the checkpoint, fetches the records after it page by page in
+// (timestamp, id) order, writes them, then moves the checkpoint to the last
+// record written. A crash between the write and the checkpoint only causes
+// the page to be fetched and written again, which the keyed writes make
+// harmless.
+//
+// With Confirmations set, every job is synced as of the subgraph's latest
+// block, whose number and hash are kept in the checkpoint along with the
+// timestamp up to which records were already Confirmations blocks deep. The
+// next run asks the subgraph for the hash of that block again: if it
+// changed, a reorganization replaced it, so the unconfirmed records are
+// deleted and fetched again.
+type Syncer struct {
+	Store    db.Store
+	Mapper   *Mapper
+	PageSize int
+	// Settle is how long after its End a bounded job is considered complete
+	// once caught up, even if no later record has been seen yet. It leaves
+	// the subgraph time to index the last blocks of the window.
+	Settle time.Duration
+
+	// Health, when set, is checked before every job. Bounded jobs then
+	// settle relative to the subgraph's latest block instead of the clock.
+	Health        *HealthChecker
+	OnStale       StaleAction
+	PauseInterval time.Duration
+
+	// Confirmations is the depth in blocks past which records are final; 0
+	// disables reorg handling.
+	Confirmations int64
+	MetaAt        func(ctx context.Context, block int64) (*uniswap.Meta, error)
+
+	Fetchers
+	// Pairs, when set, is used to register the metadata of pairs the Mapper
+	// does not know yet, so their events are tagged with tokens and symbol.
+	Pairs func(ctx context.Context, args map[string]interface{}) (*[]uniswap.PairData, error)
+}
+
+func NewSyncer(store db.Store) *Syncer {
+	return &Syncer{
+		Store:    store,
+		Mapper:   NewMapper(),
+		PageSize: 1000,
+		Settle:   time.Hour,
+		Fetchers: DefaultFetchers(),
+		Pairs:    uniswap.QueryPairsContext,
+
+		PauseInterval: 30 * time.Second,
+		MetaAt:        uniswap.QueryMetaAtContext,
+	}
+}
+
+// Fetchers are the functions events are fetched with. They are passed the
+// context of the sync or poll, so a cancelled one stops its query.
+type Fetchers struct {
+	Swaps func(ctx context.Context, args map[string]interface{}) (*[]uniswap.Swap, error)
+	Mints func(ctx context.Context, args map[string]interface{}) (*[]uniswap.Mint, error)
+	Burns func(ctx context.Context, args map[string]interface{}) (*[]uniswap.Burn, error)
+}
+
+// DefaultFetchers returns the uniswap Query functions.
+func DefaultFetchers() Fetchers {
+	return Fetchers{Swaps: uniswap.QuerySwapsContext, Mints: uniswap.QueryMintsContext, Burns: uniswap.QueryBurnsContext}
+}
+
+// record is the part of an event the Syncer and Streamer order and
+// checkpoint by.
+type record struct {
+	id        string
+	pair      string
+	timestamp int64
+	block     int64
+	logIndex  int64
+	entity    interface{}
+}
+
+// Sync runs job until it has caught up with the subgraph, or reached End.
+func (s *Syncer) Sync(job Job) (*SyncResult, error) {
+	return s.SyncContext(context.Background(), job)
+}
+
+// SyncContext is Sync stopping between pages once ctx is done. Pages written
+// so far stay checkpointed.
+func (s *Syncer) SyncContext(ctx context.Context, job Job) (*SyncResult, error) {
+	job.Pair = strings.ToLower(job.Pair)
+	key := job.CheckpointKey()
+	result := &SyncResult{Job: job}
+
+	checkpoint, err := s.Store.GetCheckpoint(key)
+	switch {
+	case err == db.ErrNotFound:
+		checkpoint = &db.Checkpoint{Key: key, Timestamp: unixOrZero(job.Start)}
+	case err != nil:
+		return nil, err
+	}
+	result.Checkpoint = *checkpoint
+	end := unixOrZero(job.End)
+	if end > 0 && checkpoint.Timestamp >= end {
+		result.Done = true
+		return result, nil
+	}
+	indexed, err := s.checkHealth(ctx, result)
+	if err != nil {
+		return result, err
+	}
+	var head *uniswap.Meta
+	if s.Confirmations > 0 {
+		if head, err = s.checkReorg(ctx, job, checkpoint, result); err != nil {
+			return result, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if err := s.registerPair(ctx, job.Pair); err != nil {
+		return nil, err
+	}
+
+	cursor := uniswap.NewCursor("timestamp", checkpoint.Timestamp)
+	where := map[string]interface{}{"pair": job.Pair}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		args := cursor.Args(where, s.PageSize)
+		if head != nil {
+			args["block"] = map[string]interface{}{"number": head.Block.Number}
+		}
+		records, err := s.fetch(ctx, job.Entity, args)
+		if err != nil {
+			return result, fmt.Errorf("%s: %v", key, err)
+		}
+		result.Pages++
+		timestamps := make([]int64, len(records))
+		for i, r := range records {
+			timestamps[i] = r.timestamp
+		}
+		cursor.Advance(timestamps)
+
+		var fresh []interface{}
+		var last *record
+		reachedEnd := false
+		for i := range records {
+			r := &records[i]
+			if end > 0 && r.timestamp >= end {
+				reachedEnd = true
+				break
+			}
+			// Records at the checkpoint's timestamp up to its id were written
+			// by an earlier run.
+			if r.timestamp < checkpoint.Timestamp || (r.timestamp == checkpoint.Timestamp && r.id <= checkpoint.LastID) {
+				continue
+			}
+			fresh = append(fresh, r.entity)
+			last = r
+			if head != nil && r.block <= head.Block.Number-s.Confirmations && r.timestamp > checkpoint.Confirmed {
+				checkpoint.Confirmed = r.timestamp
+			}
+		}
+		if len(fresh) > 0 {
+			if err := s.write(fresh, result.Stale); err != nil {
+				return result, fmt.Errorf("%s: %v", key, err)
+			}
+			checkpoint.Timestamp, checkpoint.LastID = last.timestamp, last.id
+			if head != nil {
+				checkpoint.Block, checkpoint.BlockHash = head.Block.Number, head.Block.Hash
+			}
+			checkpoint.UpdatedAt = time.Time{}
+			if err := s.Store.SetCheckpoint(*checkpoint); err != nil {
+				return result, fmt.Errorf("%s: %v", key, err)
+			}
+			result.Records += len(fresh)
+			result.Checkpoint = *checkpoint
+		}
+
+		settled := end > 0 && len(records) < s.PageSize && indexed.Sub(job.End) > s.Settle
+		// A window with records that could still be reorganized away is
+		// not complete yet.
+		final := head == nil || !unconfirmed(checkpoint)
+		if (reachedEnd || settled) && final {
+			// Mark a bounded job complete so later runs skip it.
+			checkpoint.Timestamp, checkpoint.LastID, checkpoint.Confirmed = end, "", end-1
+			checkpoint.UpdatedAt = time.Time{}
+			if err := s.Store.SetCheckpoint(*checkpoint); err != nil {
+				return result, fmt.Errorf("%s: %v", key, err)
+			}
+			result.Checkpoint = *checkpoint
+			result.Done = true
+			return result, nil
+		}
+		if len(records) < s.PageSize {
+			return result, nil
+		}
+	}
+}
+
+// SyncAll runs the jobs in order and stops at the first error.
+func (s *Syncer) SyncAll(jobs []Job) ([]SyncResult, error) {
+	results := make([]SyncResult, 0, len(jobs))
+	for _, job := range jobs {
+		result, err := s.Sync(job)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+// checkReorg compares the hash of the block recorded in checkpoint with the
+// one the subgraph has now and rolls the checkpoint back to its confirmed
+// records if they differ. It returns the subgraph's latest block, which the
+// job is then synced at.
+func (s *Syncer) checkReorg(ctx context.Context, job Job, checkpoint *db.Checkpoint, result *SyncResult) (*uniswap.Meta, error) {
+	head, err := s.MetaAt(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Block == 0 {
+		// Written without reorg handling, or nothing written yet: trust it.
+		checkpoint.Confirmed = through(checkpoint)
+		return head, nil
+	}
+	if !unconfirmed(checkpoint) {
+		return head, nil
+	}
+
+	reorged := head.Block.Number < checkpoint.Block
+	if !reorged {
+		then, err := s.MetaAt(ctx, checkpoint.Block)
+		if err != nil {
+			return nil, err
+		}
+		reorged = then.Block.Hash != checkpoint.BlockHash
+	}
+	if !reorged {
+		if checkpoint.Block <= head.Block.Number-s.Confirmations {
+			checkpoint.Confirmed = through(checkpoint)
+			checkpoint.UpdatedAt = time.Time{}
+			if err := s.Store.SetCheckpoint(*checkpoint); err != nil {
+				return nil, err
+			}
+			result.Checkpoint = *checkpoint
+		}
+		return head, nil
+	}
+
+	from := checkpoint.Confirmed + 1
+	err = s.Store.DeleteSeries(db.SeriesQuery{
+		Measurement: entityMeasurements[job.Entity],
+		Tags:        map[string]string{"pair": job.Pair},
+		Start:       time.Unix(from, 0),
+		End:         job.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.Timestamp, checkpoint.LastID = from, ""
+	checkpoint.Block, checkpoint.BlockHash = 0, ""
+	checkpoint.UpdatedAt = time.Time{}
+	if err := s.Store.SetCheckpoint(*checkpoint); err != nil {
+		return nil, err
+	}
+	result.Checkpoint = *checkpoint
+	result.Reorged = true
+	return head, nil
+}
+
+// through returns the timestamp up to which checkpoint covers every record:
+// its Timestamp once a record there was written, the second before otherwise.
+func through(checkpoint *db.Checkpoint) int64 {
+	if checkpoint.LastID != "" {
+		return checkpoint.Timestamp
+	}
+	return checkpoint.Timestamp - 1
+}
+
+// unconfirmed reports whether checkpoint covers records past Confirmed.
+func unconfirmed(checkpoint *db.Checkpoint) bool {
+	return through(checkpoint) > checkpoint.Confirmed
+}
+
+// checkHealth applies OnStale and returns the time the subgraph has indexed
+// up to, or now without a HealthChecker.
+func (s *Syncer) checkHealth(ctx context.Context, result *SyncResult) (time.Time, error) {
+	if s.Health == nil {
+		return time.Now(), nil
+	}
+	for {
+		health, err := s.Health.Check()
+		if err != nil {
+			return time.Time{}, err
+		}
+		result.Health = health
+		if !health.Stale || s.OnStale == StaleFlag {
+			result.Stale = health.Stale
+			if health.IndexedAt.IsZero() {
+				return health.HeadTime, nil
+			}
+			return health.IndexedAt, nil
+		}
+		select {
+		case <-ctx.Done():
+			return time.Time{}, ctx.Err()
+		case <-time.After(s.PauseInterval):
+		}
+	}
+}
+
+func (s *Syncer) write(entities []interface{}, stale bool) error {
+	var points []db.Point
+	for _, entity := range entities {
+		converted, err := s.Mapper.Points(entity)
+		if err != nil {
+			return err
+		}
+		points = append(points, converted...)
+	}
+	if stale {
+		for _, point := range points {
+			point.Fields[StaleField] = true
+		}
+	}
+	return s.Store.WritePoints(points)
+}
+
+func (s *Syncer) registerPair(ctx context.Context, pair string) error {
+	if s.Pairs == nil || s.Mapper.known(pair) {
+		return nil
+	}
+	pairs, err := s.Pairs(ctx, map[string]interface{}{"where": map[string]interface{}{"id": pair}})
+	if err != nil {
+		return err
+	}
+	if pairs != nil {
+		s.Mapper.Register(*pairs...)
+	}
+	return nil
+}
+
+func (f Fetchers) fetch(ctx context.Context, entity Entity, args map[string]interface{}) ([]record, error) {
+	var records []record
+	add := func(id string, transaction *uniswap.Transaction, pair *uniswap.Pairs, logIndex string, value interface{}) error {
+		if transaction == nil {
+			return fmt.Errorf("%s: missing transaction", id)
+		}
+		timestamp, err := strconv.ParseInt(transaction.Timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid timestamp %q", id, transaction.Timestamp)
+		}
+		r := record{id: id, timestamp: timestamp, entity: value}
+		r.block, _ = strconv.ParseInt(transaction.BlockNumber, 10, 64)
+		if pair != nil {
+			r.pair = strings.ToLower(pair.ID)
+		}
+		// A missing log index sorts first; the id still orders the events.
+		r.logIndex, _ = strconv.ParseInt(logIndex, 10, 64)
+		records = append(records, r)
+		return nil
+	}
+	switch entity {
+	case EntitySwaps:
+		swaps, err := f.Swaps(ctx, args)
+		if err != nil || swaps == nil {
+			return nil, err
+		}
+		for _, swap := range *swaps {
+			if err := add(swap.ID, swap.Transaction, swap.Pair, swap.LogIndex, swap); err != nil {
+				return nil, err
+			}
+		}
+	case EntityMints:
+		mints, err := f.Mints(ctx, args)
+		if err != nil || mints == nil {
+			return nil, err
+		}
+		for _, mint := range *mints {
+			if err := add(mint.ID, mint.Transaction, mint.Pair, mint.LogIndex, mint); err != nil {
+				return nil, err
+			}
+		}
+	case EntityBurns:
+		burns, err := f.Burns(ctx, args)
+		if err != nil || burns == nil {
+			return nil, err
+		}
+		for _, burn := range *burns {
+			if err := add(burn.ID, burn.Transaction, burn.Pair, burn.LogIndex, burn); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown entity %q", entity)
+	}
+	return records, nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,278 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// fakeSubgraph serves swaps the way the subgraph does: filtered by pair and
+// timestamp_gte, ordered by timestamp then id, with first and skip. Once
+// failAfter pages have been served every request fails.
+type fakeSubgraph struct {
+	mu        sync.Mutex
+	swaps     []uniswap.Swap
+	calls     int
+	failAfter int
+}
+
+func (f *fakeSubgraph) add(swaps ...uniswap.Swap) {
+	f.swaps = append(f.swaps, swaps...)
+	sort.SliceStable(f.swaps, func(i, j int) bool {
+		a, _ := strconv.ParseInt(f.swaps[i].Transaction.Timestamp, 10, 64)
+		b, _ := strconv.ParseInt(f.swaps[j].Transaction.Timestamp, 10, 64)
+		if a != b {
+			return a < b
+		}
+		return f.swaps[i].ID < f.swaps[j].ID
+	})
+}
+
+func (f *fakeSubgraph) querySwaps(ctx context.Context, args map[string]interface{}) (*[]uniswap.Swap, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.failAfter > 0 && f.calls > f.failAfter {
+		return nil, errors.New("connection reset")
+	}
+	where := args["where"].(map[string]interface{})
+	gte := where["timestamp_gte"].(int64)
+	skip, _ := args["skip"].(int)
+	page := []uniswap.Swap{}
+	for _, swap := range f.swaps {
+		ts, _ := strconv.ParseInt(swap.Transaction.Timestamp, 10, 64)
+		if ts < gte || swap.Pair.ID != where["pair"] {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if len(page) == args["first"].(int) {
+			break
+		}
+		page = append(page, swap)
+	}
+	return &page, nil
+}
+
+func testSyncer(store db.Store, subgraph *fakeSubgraph) *Syncer {
+	syncer := NewSyncer(store)
+	syncer.PageSize = 2
+	syncer.Swaps = subgraph.querySwaps
+	syncer.Pairs = nil
+	return syncer
+}
+
+func swapsAt(timestamps ...int64) []uniswap.Swap {
+	swaps := make([]uniswap.Swap, len(timestamps))
+	for i, ts := range timestamps {
+		swaps[i] = testSwap(fmt.Sprintf("0x%04d-0", i), strconv.FormatInt(ts, 10))
+	}
+	return swaps
+}
+
+func TestSyncerResumesFromCheckpoint(t *testing.T) {
+	store := db.NewMemoryStore()
+	subgraph := &fakeSubgraph{}
+	// Three swaps share a second across a page boundary.
+	subgraph.add(swapsAt(100, 200, 200, 200, 300)...)
+	syncer := testSyncer(store, subgraph)
+	job := Job{Entity: EntitySwaps, Pair: "0xPAIR"}
+
+	result, err := syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.Records != 5 || result.Checkpoint.Timestamp != 300 || result.Checkpoint.LastID != "0x0004-0" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	checkpoint, err := store.GetCheckpoint("swaps/0xpair")
+	if err != nil || checkpoint.LastID != "0x0004-0" {
+		t.Errorf("Expected a stored checkpoint, got %+v, %v", checkpoint, err)
+	}
+
+	// A new swap in the checkpoint's second and a later one are picked up;
+	// nothing already written is written again.
+	subgraph.add(testSwap("0x0005-0", "300"), testSwap("0x0006-0", "400"))
+	result, err = syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.Records != 2 || result.Checkpoint.LastID != "0x0006-0" {
+		t.Errorf("Expected only the two new swaps, got %+v", result)
+	}
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	if len(points) != 7 {
+		t.Errorf("Expected 7 swaps, got %d", len(points))
+	}
+}
+
+func TestSyncerRecoversFromFailure(t *testing.T) {
+	store := db.NewMemoryStore()
+	subgraph := &fakeSubgraph{failAfter: 2}
+	subgraph.add(swapsAt(100, 100, 200, 300, 300, 400)...)
+	syncer := testSyncer(store, subgraph)
+	job := Job{Entity: EntitySwaps, Pair: "0xpair"}
+
+	result, err := syncer.Sync(job)
+	if err == nil {
+		t.Fatal("Expected the third page to fail")
+	}
+	if result.Records != 4 || result.Checkpoint.LastID != "0x0003-0" {
+		t.Errorf("Expected the first two pages to be checkpointed, got %+v", result)
+	}
+
+	subgraph.failAfter = 0
+	result, err = syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.Records != 2 {
+		t.Errorf("Expected the remaining 2 swaps, got %d", result.Records)
+	}
+	report, _ := db.Verify(store, db.SeriesQuery{Measurement: MeasurementSwap}, 0)
+	if len(report.Duplicates) != 0 {
+		t.Errorf("Unexpected duplicates %v", report.Duplicates)
+	}
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	if len(points) != 6 {
+		t.Errorf("Expected 6 swaps, got %d", len(points))
+	}
+}
+
+func TestSyncerBoundedJob(t *testing.T) {
+	store := db.NewMemoryStore()
+	subgraph := &fakeSubgraph{}
+	subgraph.add(swapsAt(100, 200, 300, 400)...)
+	syncer := testSyncer(store, subgraph)
+	job := Job{Entity: EntitySwaps, Pair: "0xpair", Start: time.Unix(200, 0), End: time.Unix(400, 0)}
+
+	result, err := syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !result.Done || result.Records != 2 || result.Checkpoint.Timestamp != 400 {
+		t.Errorf("Expected the window to be done, got %+v", result)
+	}
+	if key := job.CheckpointKey(); key != "swaps/0xpair/200-400" {
+		t.Errorf("Unexpected checkpoint key %s", key)
+	}
+
+	calls := subgraph.calls
+	if result, err = syncer.Sync(job); err != nil || !result.Done || subgraph.calls != calls {
+		t.Errorf("Expected a finished job to be skipped, got %+v, %v", result, err)
+	}
+}
+
+// fakeChain answers _meta queries: hashes by block number and a head.
+type fakeChain struct {
+	head   int64
+	hashes map[int64]string
+}
+
+func (c *fakeChain) metaAt(ctx context.Context, block int64) (*uniswap.Meta, error) {
+	if block == 0 {
+		block = c.head
+	}
+	if block > c.head {
+		return nil, fmt.Errorf("block %d not indexed", block)
+	}
+	return &uniswap.Meta{Block: uniswap.MetaBlock{Number: block, Hash: c.hashes[block]}}, nil
+}
+
+func swapInBlock(id string, timestamp, block int64) uniswap.Swap {
+	swap := testSwap(id, strconv.FormatInt(timestamp, 10))
+	swap.Transaction.BlockNumber = strconv.FormatInt(block, 10)
+	return swap
+}
+
+func TestSyncerHandlesReorg(t *testing.T) {
+	store := db.NewMemoryStore()
+	subgraph := &fakeSubgraph{}
+	subgraph.add(swapInBlock("0xa-0", 100, 10), swapInBlock("0xb-0", 112, 11), swapInBlock("0xc-0", 124, 12))
+	chain := &fakeChain{head: 12, hashes: map[int64]string{10: "0x10", 11: "0x11", 12: "0x12"}}
+	syncer := testSyncer(store, subgraph)
+	syncer.Confirmations = 2
+	syncer.MetaAt = chain.metaAt
+	job := Job{Entity: EntitySwaps, Pair: "0xpair"}
+
+	result, err := syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if cp := result.Checkpoint; cp.Block != 12 || cp.BlockHash != "0x12" || cp.Confirmed != 100 {
+		t.Errorf("Unexpected checkpoint %+v", cp)
+	}
+
+	// Block 12 is replaced: swap c is gone, c2 takes its place.
+	subgraph.swaps = subgraph.swaps[:2]
+	subgraph.add(swapInBlock("0xc2-0", 125, 12), swapInBlock("0xd-0", 136, 13))
+	chain.head, chain.hashes[12], chain.hashes[13] = 13, "0x12b", "0x13"
+	result, err = syncer.Sync(job)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !result.Reorged || result.Records != 3 {
+		t.Errorf("Expected the unconfirmed swaps to be fetched again, got %+v", result)
+	}
+	points, _ := store.ReadSeries(db.SeriesQuery{Measurement: MeasurementSwap})
+	var keys []string
+	for _, point := range points {
+		keys = append(keys, point.Key)
+	}
+	if fmt.Sprint(keys) != "[0xa-0 0xb-0 0xc2-0 0xd-0]" {
+		t.Errorf("Unexpected swaps after the reorg %v", keys)
+	}
+
+	// Once deep enough, the records are confirmed without a rollback.
+	chain.head = 15
+	if result, err = syncer.Sync(job); err != nil || result.Reorged || result.Checkpoint.Confirmed != 136 {
+		t.Errorf("Expected the checkpoint to be confirmed, got %+v, %v", result, err)
+	}
+}
+
+// blockingRunner answers no query before its context is done.
+type blockingRunner struct{}
+
+func (blockingRunner) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSyncerPassesContextToQueries(t *testing.T) {
+	previous := uniswap.DefaultRunner()
+	uniswap.SetRunner(blockingRunner{})
+	defer uniswap.SetRunner(previous)
+
+	// Without Confirmations the pair lookup is the first query, with them
+	// the _meta one.
+	for _, confirmations := range []int64{0, 2} {
+		syncer := NewSyncer(db.NewMemoryStore())
+		syncer.Confirmations = confirmations
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := syncer.SyncContext(ctx, Job{Entity: EntitySwaps, Pair: "0xpair"})
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+			t.Errorf("Expected the deadline to stop the queries with %d confirmations, got %v", confirmations, err)
+		}
+	}
+
+	// With the pair known and no Confirmations only the fetchers query.
+	syncer := NewSyncer(db.NewMemoryStore())
+	syncer.Pairs = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := syncer.SyncContext(ctx, Job{Entity: EntityMints, Pair: "0xpair"}); err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("Expected the deadline to stop the fetch, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package liquidity
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// HHI returns the Herfindahl-Hirschman index of values: the sum of squared
+// market shares, from 1/n for an even split to 1 for a single holder.
+func HHI(values []float64) float64 {
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+	if total <= 0 {
+		return 0
+	}
+	var index float64
+	for _, value := range values {
+		share := value / total
+		index += share * share
+	}
+	return index
+}
+
+// Share is the portion of a total held by one pair or one address.
+type Share struct {
+	ID    string
+	Value float64
+	Share float64
+}
+
+// Concentration summarises how a total is split across holders.
+type Concentration struct {
+	Total float64
+	HHI   float64
+	// TopShare is the share of the largest holder.
+	TopShare float64
+	// Shares are sorted largest first.
+	Shares []Share
+}
+
+// TopN returns the combined share of the n largest holders.
+func (c *Concentration) TopN(n int) float64 {
+	var share float64
+	for i := 0; i < n && i < len(c.Shares); i++ {
+		share += c.Shares[i].Share
+	}
+	return share
+}
+
+func newConcentration(ids []string, values []float64) *Concentration {
+	concentration := &Concentration{HHI: HHI(values)}
+	for _, value := range values {
+		concentration.Total += value
+	}
+	for i, id := range ids {
+		share := Share{ID: id, Value: values[i]}
+		if concentration.Total > 0 {
+			share.Share = values[i] / concentration.Total
+		}
+		concentration.Shares = append(concentration.Shares, share)
+	}
+	sort.SliceStable(concentration.Shares, func(i, j int) bool {
+		return concentration.Shares[i].Value > concentration.Shares[j].Value
+	})
+	if len(concentration.Shares) > 0 {
+		concentration.TopShare = concentration.Shares[0].Share
+	}
+	return concentration
+}
+
+// MarketConcentration measures how liquidity, by reserveUSD, is spread
+// across pairs, e.g. the output of QueryMostLiquidPairs with reserves.
+func MarketConcentration(pairs []uniswap.PairData) (*Concentration, error) {
+	ids := make([]string, 0, len(pairs))
+	values := make([]float64, 0, len(pairs))
+	for _, pair := range pairs {
+		reserveUSD, err := strconv.ParseFloat(pair.ReserveUSD, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pair %s: invalid reserveUSD: %v", pair.ID, err)
+		}
+		ids = append(ids, strings.ToLower(pair.ID))
+		values = append(values, reserveUSD)
+	}
+	return newConcentration(ids, values), nil
+}
+
+// TokenConcentration measures how a token's liquidity is split across the
+// pairs it trades in. A pair contributes the USD value of the token's side,
+// half of its reserveUSD.
+func TokenConcentration(token string, pairs []uniswap.PairData) (*Concentration, error) {
+	token = strings.ToLower(token)
+	var ids []string
+	var values []float64
+	for _, pair := range pairs {
+		if pair.Token0 == nil || pair.Token1 == nil {
+			return nil, fmt.Errorf("pair %s: missing token data", pair.ID)
+		}
+		if strings.ToLower(pair.Token0.ID) != token && strings.ToLower(pair.Token1.ID) != token {
+			continue
+		}
+		reserveUSD, err := strconv.ParseFloat(pair.ReserveUSD, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pair %s: invalid reserveUSD: %v", pair.ID, err)
+		}
+		ids = append(ids, strings.ToLower(pair.ID))
+		values = append(values, reserveUSD/2)
+	}
+	return newConcentration(ids, values), nil
+}
+
+// ProviderConcentration measures how a pair's LP tokens are split across
+// holders, from the output of QueryLiquidityPositions. Only the positions
+// fetched are counted, so pass every open position or read the result as
+// concentration among the largest holders.
+func ProviderConcentration(positions []uniswap.LiquidityPosition) (*Concentration, error) {
+	ids := make([]string, 0, len(positions))
+	values := make([]float64, 0, len(positions))
+	for _, position := range positions {
+		balance, err := strconv.ParseFloat(position.LiquidityTokenBalance, 64)
+		if err != nil {
+			return nil, fmt.Errorf("position %s: invalid liquidityTokenBalance: %v", position.ID, err)
+		}
+		id := position.ID
+		if position.User != nil {
+			id = strings.ToLower(position.User.ID)
+		}
+		ids = append(ids, id)
+		values = append(values, balance)
+	}
+	return newConcentration(ids, values), nil
+}
@@ -0,0 +1,93 @@
+package liquidity
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswaptest"
+)
+
+const token = "0xtoken"
+
+func testPair(id, other, reserveUSD string) uniswap.PairData {
+	pair := uniswaptest.Pair(id, token, other, "", "")
+	pair.ReserveUSD = reserveUSD
+	return pair
+}
+
+func TestHHI(t *testing.T) {
+	if hhi := HHI([]float64{1, 1, 1, 1}); math.Abs(hhi-0.25) > 1e-12 {
+		t.Errorf("Expected 0.25 for an even split, got %f", hhi)
+	}
+	if hhi := HHI([]float64{5}); hhi != 1 {
+		t.Errorf("Expected 1 for a single holder, got %f", hhi)
+	}
+	if hhi := HHI(nil); hhi != 0 {
+		t.Errorf("Expected 0 for no holders, got %f", hhi)
+	}
+}
+
+func TestTokenConcentration(t *testing.T) {
+	pairs := []uniswap.PairData{
+		testPair("0xa", "0xweth", "1600000"),
+		testPair("0xb", "0xusdc", "400000"),
+		{ID: "0xc", Token0: &uniswap.Token{ID: "0xother"}, Token1: &uniswap.Token{ID: "0xweth"}, ReserveUSD: "9000000"},
+	}
+	concentration, err := TokenConcentration(token, pairs)
+	if err != nil {
+		t.Fatalf("TokenConcentration failed: %v", err)
+	}
+	if len(concentration.Shares) != 2 || concentration.Total != 1000000 {
+		t.Fatalf("Unexpected concentration %+v", concentration)
+	}
+	if concentration.Shares[0].ID != "0xa" || concentration.TopShare != 0.8 {
+		t.Errorf("Expected 0xa to hold 80%%, got %+v", concentration.Shares[0])
+	}
+	if math.Abs(concentration.HHI-0.68) > 1e-12 {
+		t.Errorf("Expected HHI 0.68, got %f", concentration.HHI)
+	}
+}
+
+func TestTrackerTake(t *testing.T) {
+	tracker := NewTracker()
+	var blocks []interface{}
+	tracker.Pairs = func(args map[string]interface{}) (*[]uniswap.PairData, error) {
+		blocks = append(blocks, args["block"])
+		pairs := []uniswap.PairData{}
+		if _, ok := args["where"].(map[string]interface{})["token0"]; ok {
+			pairs = append(pairs, testPair("0xa", "0xweth", "1600000"), testPair("0xb", "0xusdc", "400000"))
+		}
+		return &pairs, nil
+	}
+	tracker.Positions = func(args map[string]interface{}) (*[]uniswap.LiquidityPosition, error) {
+		if pair := args["where"].(map[string]interface{})["pair"]; pair != "0xa" {
+			t.Errorf("Expected positions of the top pair, got %v", pair)
+		}
+		positions := []uniswap.LiquidityPosition{
+			{ID: "0xa-0x1", User: &uniswap.User{ID: "0x1"}, LiquidityTokenBalance: "90"},
+			{ID: "0xa-0x2", User: &uniswap.User{ID: "0x2"}, LiquidityTokenBalance: "10"},
+		}
+		return &positions, nil
+	}
+
+	for _, block := range []int{100, 200} {
+		if _, err := tracker.Take(token, block); err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+	}
+	history := tracker.History(token)
+	if len(history) != 2 || history[1].Block != 200 {
+		t.Fatalf("Unexpected history %+v", history)
+	}
+	snapshot := history[0]
+	if snapshot.TopPair != "0xa" || snapshot.PairCount != 2 || snapshot.TopProviderShare != 0.9 {
+		t.Errorf("Unexpected snapshot %+v", snapshot)
+	}
+	if math.Abs(snapshot.ProviderHHI-0.82) > 1e-12 {
+		t.Errorf("Expected provider HHI 0.82, got %f", snapshot.ProviderHHI)
+	}
+	if len(blocks) != 4 || blocks[0] == nil {
+		t.Errorf("Expected block-pinned pair queries, got %v", blocks)
+	}
+}
@@ -0,0 +1,138 @@
+package liquidity
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/router"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// PositionSource fetches liquidity positions; uniswap.QueryLiquidityPositions is the default.
+type PositionSource func(args map[string]interface{}) (*[]uniswap.LiquidityPosition, error)
+
+// Snapshot is the market structure of one token at a point in time, the
+// inputs to a listing risk assessment.
+type Snapshot struct {
+	Token string
+	// Block is the block the data was read at, 0 for the latest state.
+	Block   int
+	TakenAt time.Time
+
+	LiquidityUSD float64
+	PairCount    int
+	// PairHHI is the concentration of the token's liquidity across its pairs.
+	PairHHI      float64
+	TopPair      string
+	TopPairShare float64
+
+	// LP concentration of the token's largest pair.
+	ProviderHHI        float64
+	TopProviderShare   float64
+	Top10ProviderShare float64
+}
+
+// Tracker takes snapshots of tokens and keeps their history.
+type Tracker struct {
+	Pairs     router.PairSource
+	Positions PositionSource
+	// MaxPositions caps the LP positions fetched for the top pair.
+	MaxPositions int
+
+	mu      sync.Mutex
+	history map[string][]Snapshot
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		Pairs:        uniswap.QueryPairs,
+		Positions:    uniswap.QueryLiquidityPositions,
+		MaxPositions: 1000,
+		history:      make(map[string][]Snapshot),
+	}
+}
+
+// Take measures token at block (0 for latest), records the snapshot and returns it.
+func (t *Tracker) Take(token string, block int) (*Snapshot, error) {
+	token = strings.ToLower(token)
+	pairs, err := t.tokenPairs(token, block)
+	if err != nil {
+		return nil, err
+	}
+	pairConcentration, err := TokenConcentration(token, pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{
+		Token:        token,
+		Block:        block,
+		TakenAt:      time.Now(),
+		LiquidityUSD: pairConcentration.Total,
+		PairCount:    len(pairConcentration.Shares),
+		PairHHI:      pairConcentration.HHI,
+		TopPairShare: pairConcentration.TopShare,
+	}
+	if len(pairConcentration.Shares) > 0 {
+		snapshot.TopPair = pairConcentration.Shares[0].ID
+		args := map[string]interface{}{
+			"first":          t.MaxPositions,
+			"orderBy":        "liquidityTokenBalance",
+			"orderDirection": "desc",
+			"where": map[string]interface{}{
+				"pair":                     snapshot.TopPair,
+				"liquidityTokenBalance_gt": 0,
+			},
+		}
+		uniswap.AtBlock(args, block)
+		positions, err := t.Positions(args)
+		if err != nil {
+			return nil, err
+		}
+		if positions != nil {
+			providerConcentration, err := ProviderConcentration(*positions)
+			if err != nil {
+				return nil, err
+			}
+			snapshot.ProviderHHI = providerConcentration.HHI
+			snapshot.TopProviderShare = providerConcentration.TopShare
+			snapshot.Top10ProviderShare = providerConcentration.TopN(10)
+		}
+	}
+
+	t.mu.Lock()
+	t.history[token] = append(t.history[token], snapshot)
+	t.mu.Unlock()
+	return &snapshot, nil
+}
+
+// History returns the snapshots recorded for token in the order they were taken.
+func (t *Tracker) History(token string) []Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Snapshot(nil), t.history[strings.ToLower(token)]...)
+}
+
+func (t *Tracker) tokenPairs(token string, block int) ([]uniswap.PairData, error) {
+	var pairs []uniswap.PairData
+	for _, side := range []string{"token0", "token1"} {
+		args := map[string]interface{}{
+			"first":          1000,
+			"orderBy":        "reserveUSD",
+			"orderDirection": "desc",
+			"where": map[string]interface{}{
+				side: token,
+			},
+		}
+		uniswap.AtBlock(args, block)
+		page, err := t.Pairs(args)
+		if err != nil {
+			return nil, err
+		}
+		if page != nil {
+			pairs = append(pairs, *page...)
+		}
+	}
+	return pairs, nil
+}
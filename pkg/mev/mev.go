@@ -0,0 +1,232 @@
+package mev
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+const secondsPerDay = 86400
+
+// Sandwich is a victim swap bracketed, in the same block and pair, by a
+// front-run and a back-run from the same actor trading in opposite directions.
+type Sandwich struct {
+	Pair     string
+	Block    int64
+	Attacker string
+	FrontRun SwapRecord
+	Victims  []SwapRecord
+	BackRun  SwapRecord
+}
+
+// WashActivity is same-address volume that goes round trip on one pair within a window.
+type WashActivity struct {
+	Pair        string
+	Address     string
+	WindowStart int64
+	BuyUSD      float64
+	SellUSD     float64
+	// CircularUSD is the volume that nets out: twice the smaller of the two sides.
+	CircularUSD float64
+	Swaps       []string
+}
+
+type Config struct {
+	// WashWindow is the bucket, in seconds, within which buys and sells of the
+	// same address are matched. Defaults to one day.
+	WashWindow int64
+	// MinWashUSD ignores round trips whose circular volume is below this value.
+	MinWashUSD float64
+}
+
+// Report holds the patterns found in a set of swaps.
+type Report struct {
+	Sandwiches []Sandwich
+	Wash       []WashActivity
+	// FlaggedUSD is the volume attributable to sandwich legs and wash trading,
+	// keyed by pair then by day (unix timestamp at midnight UTC).
+	FlaggedUSD map[string]map[int64]float64
+}
+
+// Analyze detects sandwiches and wash trading in swaps.
+func Analyze(swaps []uniswap.Swap, config Config) (*Report, error) {
+	records, err := NewRecords(swaps)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeRecords(records, config), nil
+}
+
+// AnalyzeRecords is Analyze for already parsed records. It sorts a copy of
+// records, leaving the caller's slice in its order.
+func AnalyzeRecords(records []SwapRecord, config Config) *Report {
+	if config.WashWindow <= 0 {
+		config.WashWindow = secondsPerDay
+	}
+	records = append([]SwapRecord(nil), records...)
+	sortRecords(records)
+
+	report := &Report{FlaggedUSD: make(map[string]map[int64]float64)}
+	report.Sandwiches = DetectSandwiches(records)
+
+	// Sandwich legs are counted once, as such, and excluded from the wash scan.
+	sandwichLegs := make(map[string]bool)
+	for _, sandwich := range report.Sandwiches {
+		for _, leg := range []SwapRecord{sandwich.FrontRun, sandwich.BackRun} {
+			if !sandwichLegs[leg.ID] {
+				sandwichLegs[leg.ID] = true
+				report.flag(leg.Pair, leg.Timestamp, leg.AmountUSD)
+			}
+		}
+	}
+	var remaining []SwapRecord
+	for _, record := range records {
+		if !sandwichLegs[record.ID] {
+			remaining = append(remaining, record)
+		}
+	}
+	report.Wash = DetectWash(remaining, config)
+	for _, wash := range report.Wash {
+		report.flag(wash.Pair, wash.WindowStart, wash.CircularUSD)
+	}
+	return report
+}
+
+func (r *Report) flag(pair string, timestamp int64, amountUSD float64) {
+	if r.FlaggedUSD[pair] == nil {
+		r.FlaggedUSD[pair] = make(map[int64]float64)
+	}
+	r.FlaggedUSD[pair][timestamp-timestamp%secondsPerDay] += amountUSD
+}
+
+// DetectSandwiches scans each block and pair in log order for a swap whose
+// actor trades back in the opposite direction later in the block, with at
+// least one other actor trading in the front-run's direction in between.
+func DetectSandwiches(records []SwapRecord) []Sandwich {
+	type blockPair struct {
+		block int64
+		pair  string
+	}
+	groups := make(map[blockPair][]SwapRecord)
+	var keys []blockPair
+	for _, record := range records {
+		key := blockPair{record.Block, record.Pair}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], record)
+	}
+
+	var sandwiches []Sandwich
+	for _, key := range keys {
+		swaps := groups[key]
+		used := make(map[int]bool)
+		for i := 0; i < len(swaps); i++ {
+			if used[i] {
+				continue
+			}
+			front := swaps[i]
+			attacker := front.Actor()
+			var victims []SwapRecord
+			for k := i + 1; k < len(swaps); k++ {
+				candidate := swaps[k]
+				if candidate.Actor() != attacker {
+					if candidate.ZeroForOne() == front.ZeroForOne() {
+						victims = append(victims, candidate)
+					}
+					continue
+				}
+				if candidate.ZeroForOne() == front.ZeroForOne() || candidate.TxHash == front.TxHash {
+					continue
+				}
+				if len(victims) > 0 {
+					sandwiches = append(sandwiches, Sandwich{
+						Pair:     key.pair,
+						Block:    key.block,
+						Attacker: attacker,
+						FrontRun: front,
+						Victims:  victims,
+						BackRun:  candidate,
+					})
+					used[i], used[k] = true, true
+				}
+				break
+			}
+		}
+	}
+	return sandwiches
+}
+
+// DetectWash matches, per pair, address and window, the volume an address
+// bought against the volume it sold.
+func DetectWash(records []SwapRecord, config Config) []WashActivity {
+	if config.WashWindow <= 0 {
+		config.WashWindow = secondsPerDay
+	}
+	type bucket struct {
+		pair    string
+		address string
+		window  int64
+	}
+	activity := make(map[bucket]*WashActivity)
+	var order []bucket
+	for _, record := range records {
+		key := bucket{record.Pair, record.Actor(), record.Timestamp - record.Timestamp%config.WashWindow}
+		wash, ok := activity[key]
+		if !ok {
+			wash = &WashActivity{Pair: key.pair, Address: key.address, WindowStart: key.window}
+			activity[key] = wash
+			order = append(order, key)
+		}
+		if record.ZeroForOne() {
+			wash.SellUSD += record.AmountUSD
+		} else {
+			wash.BuyUSD += record.AmountUSD
+		}
+		wash.Swaps = append(wash.Swaps, record.ID)
+	}
+
+	var washes []WashActivity
+	for _, key := range order {
+		wash := activity[key]
+		wash.CircularUSD = 2 * math.Min(wash.BuyUSD, wash.SellUSD)
+		if wash.CircularUSD > 0 && wash.CircularUSD >= config.MinWashUSD {
+			washes = append(washes, *wash)
+		}
+	}
+	sort.SliceStable(washes, func(i, j int) bool { return washes[i].CircularUSD > washes[j].CircularUSD })
+	return washes
+}
+
+// CleanedVolume is a pair's daily volume with flagged volume removed.
+type CleanedVolume struct {
+	Date           int
+	RawVolumeUSD   float64
+	FlaggedUSD     float64
+	CleanVolumeUSD float64
+}
+
+// CleanDailyVolume subtracts the volume flagged in report for pairID from
+// each day's DailyVolumeUSD. The report should cover every swap of those days
+// for the figures to be complete.
+func CleanDailyVolume(days []uniswap.PairDailyAggregated, pairID string, report *Report) ([]CleanedVolume, error) {
+	flagged := report.FlaggedUSD[strings.ToLower(pairID)]
+	cleaned := make([]CleanedVolume, 0, len(days))
+	for _, day := range days {
+		raw, err := strconv.ParseFloat(day.DailyVolumeUSD, 64)
+		if err != nil {
+			return nil, err
+		}
+		flaggedUSD := math.Min(flagged[int64(day.Date)], raw)
+		cleaned = append(cleaned, CleanedVolume{
+			Date:           day.Date,
+			RawVolumeUSD:   raw,
+			FlaggedUSD:     flaggedUSD,
+			CleanVolumeUSD: raw - flaggedUSD,
+		})
+	}
+	return cleaned, nil
+}
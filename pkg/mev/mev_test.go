@@ -0,0 +1,119 @@
+package mev
+
+import (
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+const (
+	pair   = "0xpair"
+	day    = 1680048000
+	bot    = "0xb07"
+	victim = "0xv1c"
+	washer = "0xwa5"
+)
+
+// testSwap builds a swap selling token0 when zeroForOne is set, token1 otherwise.
+func testSwap(id, tx, block, logIndex, timestamp, from string, zeroForOne bool, amountUSD string) uniswap.Swap {
+	swap := uniswap.Swap{
+		ID:          id,
+		Transaction: &uniswap.Transaction{ID: tx, BlockNumber: block, Timestamp: timestamp},
+		Pair:        &uniswap.Pairs{ID: pair},
+		From:        from,
+		To:          from,
+		LogIndex:    logIndex,
+		Amount0In:   "0",
+		Amount0Out:  "0",
+		Amount1In:   "0",
+		Amount1Out:  "0",
+		AmountUSD:   amountUSD,
+	}
+	if zeroForOne {
+		swap.Amount0In, swap.Amount1Out = "1", "2000"
+	} else {
+		swap.Amount1In, swap.Amount0Out = "2000", "1"
+	}
+	return swap
+}
+
+func fixtureSwaps() []uniswap.Swap {
+	return []uniswap.Swap{
+		// Listed out of order on purpose: analysis must sort by block and log index.
+		testSwap("0x3-5", "0x3", "100", "5", "1680050000", bot, false, "50000"),
+		testSwap("0x1-1", "0x1", "100", "1", "1680050000", bot, true, "50000"),
+		testSwap("0x2-3", "0x2", "100", "3", "1680050000", victim, true, "10000"),
+		// The same address buying and selling across the day.
+		testSwap("0x4-0", "0x4", "200", "0", "1680060000", washer, true, "30000"),
+		testSwap("0x5-0", "0x5", "300", "0", "1680070000", washer, false, "25000"),
+		// An ordinary trade in another block.
+		testSwap("0x6-0", "0x6", "400", "0", "1680080000", "0x0th", false, "5000"),
+	}
+}
+
+func TestDetectSandwich(t *testing.T) {
+	report, err := Analyze(fixtureSwaps(), Config{})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(report.Sandwiches) != 1 {
+		t.Fatalf("Expected one sandwich, got %d", len(report.Sandwiches))
+	}
+	sandwich := report.Sandwiches[0]
+	if sandwich.FrontRun.ID != "0x1-1" || sandwich.BackRun.ID != "0x3-5" {
+		t.Errorf("Unexpected legs: front %s, back %s", sandwich.FrontRun.ID, sandwich.BackRun.ID)
+	}
+	if sandwich.Attacker != bot || len(sandwich.Victims) != 1 || sandwich.Victims[0].ID != "0x2-3" {
+		t.Errorf("Unexpected sandwich %+v", sandwich)
+	}
+}
+
+func TestAnalyzeRecordsKeepsCallerOrder(t *testing.T) {
+	records, err := NewRecords(fixtureSwaps())
+	if err != nil {
+		t.Fatalf("NewRecords failed: %v", err)
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	first := records[0].ID
+	if report := AnalyzeRecords(records, Config{}); len(report.Sandwiches) != 1 {
+		t.Errorf("Expected one sandwich, got %d", len(report.Sandwiches))
+	}
+	if records[0].ID != first {
+		t.Errorf("Expected the records left in order, got %s first", records[0].ID)
+	}
+}
+
+func TestDetectWashAndCleanVolume(t *testing.T) {
+	report, err := Analyze(fixtureSwaps(), Config{MinWashUSD: 1000})
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(report.Wash) != 1 || report.Wash[0].Address != washer || report.Wash[0].CircularUSD != 50000 {
+		t.Fatalf("Unexpected wash activity %+v", report.Wash)
+	}
+
+	days := []uniswap.PairDailyAggregated{{Date: day, DailyVolumeUSD: "170000"}}
+	cleaned, err := CleanDailyVolume(days, pair, report)
+	if err != nil {
+		t.Fatalf("CleanDailyVolume failed: %v", err)
+	}
+	// 100000 of sandwich legs plus 50000 of circular volume.
+	if cleaned[0].FlaggedUSD != 150000 || cleaned[0].CleanVolumeUSD != 20000 {
+		t.Errorf("Unexpected cleaned volume %+v", cleaned[0])
+	}
+}
+
+func TestGroupByTransaction(t *testing.T) {
+	records, err := NewRecords(fixtureSwaps())
+	if err != nil {
+		t.Fatalf("NewRecords failed: %v", err)
+	}
+	if records[0].ID != "0x1-1" || records[2].ID != "0x3-5" {
+		t.Errorf("Expected records ordered by block and log index, got %s..%s", records[0].ID, records[2].ID)
+	}
+	if grouped := GroupByTransaction(records); len(grouped) != 6 {
+		t.Errorf("Expected 6 transactions, got %d", len(grouped))
+	}
+}
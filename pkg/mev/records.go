@@ -0,0 +1,118 @@
+package mev
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// SwapRecord is a swap with its numeric fields parsed and its position in the
+// chain made explicit, so swaps can be ordered within a block.
+type SwapRecord struct {
+	ID         string
+	TxHash     string
+	Pair       string
+	Sender     string
+	From       string
+	To         string
+	Block      int64
+	LogIndex   int64
+	Timestamp  int64
+	Amount0In  float64
+	Amount0Out float64
+	Amount1In  float64
+	Amount1Out float64
+	AmountUSD  float64
+}
+
+// ZeroForOne reports whether the swap sold token0 for token1.
+func (r SwapRecord) ZeroForOne() bool {
+	return r.Amount0In > 0 && r.Amount1Out > 0
+}
+
+// Actor is the account behind the swap: the transaction signer when the
+// subgraph provides it, the recipient otherwise.
+func (r SwapRecord) Actor() string {
+	if r.From != "" {
+		return strings.ToLower(r.From)
+	}
+	return strings.ToLower(r.To)
+}
+
+// NewRecords parses swaps and sorts them by block, then log index.
+func NewRecords(swaps []uniswap.Swap) ([]SwapRecord, error) {
+	records := make([]SwapRecord, 0, len(swaps))
+	for _, swap := range swaps {
+		if swap.Transaction == nil || swap.Pair == nil {
+			return nil, fmt.Errorf("swap %s: missing transaction or pair", swap.ID)
+		}
+		record := SwapRecord{
+			ID:     swap.ID,
+			TxHash: swap.Transaction.ID,
+			Pair:   strings.ToLower(swap.Pair.ID),
+			Sender: swap.Sender,
+			From:   swap.From,
+			To:     swap.To,
+		}
+		var err error
+		integers := []struct {
+			value string
+			dest  *int64
+		}{
+			{swap.Transaction.BlockNumber, &record.Block},
+			{swap.Transaction.Timestamp, &record.Timestamp},
+			{swap.LogIndex, &record.LogIndex},
+		}
+		for _, field := range integers {
+			if field.value == "" {
+				continue
+			}
+			if *field.dest, err = strconv.ParseInt(field.value, 10, 64); err != nil {
+				return nil, fmt.Errorf("swap %s: %v", swap.ID, err)
+			}
+		}
+		decimals := []struct {
+			value string
+			dest  *float64
+		}{
+			{swap.Amount0In, &record.Amount0In},
+			{swap.Amount0Out, &record.Amount0Out},
+			{swap.Amount1In, &record.Amount1In},
+			{swap.Amount1Out, &record.Amount1Out},
+			{swap.AmountUSD, &record.AmountUSD},
+		}
+		for _, field := range decimals {
+			if *field.dest, err = strconv.ParseFloat(field.value, 64); err != nil {
+				return nil, fmt.Errorf("swap %s: %v", swap.ID, err)
+			}
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func sortRecords(records []SwapRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Block != records[j].Block {
+			return records[i].Block < records[j].Block
+		}
+		if records[i].Timestamp != records[j].Timestamp {
+			return records[i].Timestamp < records[j].Timestamp
+		}
+		return records[i].LogIndex < records[j].LogIndex
+	})
+}
+
+// GroupByTransaction returns the swaps of every transaction, keyed by hash.
+// Multi-hop trades show up as several swaps in one transaction.
+func GroupByTransaction(records []SwapRecord) map[string][]SwapRecord {
+	grouped := make(map[string][]SwapRecord)
+	for _, record := range records {
+		grouped[record.TxHash] = append(grouped[record.TxHash], record)
+	}
+	return grouped
+}
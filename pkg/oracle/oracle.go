@@ -0,0 +1,229 @@
+package oracle
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gelhteag/onchainaggregator/pkg/router"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// Mainnet token addresses used as pricing anchors.
+const (
+	WETH = "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+	USDC = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	DAI  = "0x6b175474e89094c44da98b954eedeac495271d0f"
+	USDT = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+)
+
+// ErrNoPrice is returned when no whitelisted pair with enough liquidity contains the token.
+var ErrNoPrice = errors.New("no liquid whitelisted pair")
+
+type Config struct {
+	// WETH is the token every price is first expressed in.
+	WETH string
+	// Whitelist lists the tokens whose pairs may be used to price other tokens.
+	Whitelist []string
+	// Stablecoins are whitelisted tokens anchored at 1 USD; the ETH price is
+	// derived from their WETH pairs.
+	Stablecoins []string
+	// MinLiquidityETH is the minimum value, in ETH, of the whitelisted side of
+	// a pair for it to be used. Thin pairs are trivially manipulated.
+	MinLiquidityETH float64
+}
+
+// DefaultConfig mirrors the whitelist used by the Uniswap V2 subgraph.
+func DefaultConfig() Config {
+	return Config{
+		WETH:            WETH,
+		Whitelist:       []string{WETH, USDC, DAI, USDT},
+		Stablecoins:     []string{USDC, DAI, USDT},
+		MinLiquidityETH: 2,
+	}
+}
+
+// Price is a token price derived from pair reserves.
+type Price struct {
+	Token string
+	ETH   float64
+	USD   float64
+	// LiquidityETH is the combined whitelisted-side liquidity, in ETH, of the pairs used.
+	LiquidityETH float64
+	Pairs        []string
+}
+
+// Oracle derives token prices from the reserves in a pair graph instead of
+// trusting the subgraph's derivedETH.
+type Oracle struct {
+	Graph  *router.Graph
+	Config Config
+}
+
+func NewOracle(graph *router.Graph, config Config) *Oracle {
+	config.WETH = strings.ToLower(config.WETH)
+	config.Whitelist = lowerAll(config.Whitelist)
+	config.Stablecoins = lowerAll(config.Stablecoins)
+	return &Oracle{Graph: graph, Config: config}
+}
+
+// AtBlock builds an oracle over the limit most liquid pairs as they were at block.
+func AtBlock(source router.PairSource, block int, limit int, config Config) (*Oracle, error) {
+	graph := router.NewGraph()
+	if err := graph.Load(source, limit, uniswap.AtBlock(nil, block)); err != nil {
+		return nil, err
+	}
+	return NewOracle(graph, config), nil
+}
+
+// LoadToken adds every pair containing token to the graph, so tokens outside
+// the most liquid set can be priced. A block of 0 loads the latest state.
+func (o *Oracle) LoadToken(source router.PairSource, token string, block int) error {
+	for _, side := range []string{"token0", "token1"} {
+		extra := map[string]interface{}{
+			"where": map[string]interface{}{
+				side: strings.ToLower(token),
+			},
+		}
+		if err := o.Graph.Load(source, 1000, uniswap.AtBlock(extra, block)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ETHPriceUSD returns the USD price of WETH as the average of the stablecoin
+// pairs weighted by their stablecoin reserves.
+func (o *Oracle) ETHPriceUSD() (float64, error) {
+	var weightedPrice, totalWeight float64
+	for _, pool := range o.Graph.PoolsForToken(o.Config.WETH) {
+		reserveWETH, reserveStable, stable := pool.Reserves(o.Config.WETH)
+		if !contains(o.Config.Stablecoins, stable) || reserveWETH <= 0 {
+			continue
+		}
+		if reserveWETH < o.Config.MinLiquidityETH {
+			continue
+		}
+		weightedPrice += reserveStable / reserveWETH * reserveStable
+		totalWeight += reserveStable
+	}
+	if totalWeight == 0 {
+		return 0, fmt.Errorf("pricing ETH: %w", ErrNoPrice)
+	}
+	return weightedPrice / totalWeight, nil
+}
+
+// PriceUSD derives the price of token from its pairs against whitelisted
+// tokens, averaging them weighted by the whitelisted side's liquidity.
+func (o *Oracle) PriceUSD(token string) (*Price, error) {
+	token = strings.ToLower(token)
+	ethUSD, err := o.ETHPriceUSD()
+	if err != nil {
+		return nil, err
+	}
+	price := &Price{Token: token}
+	switch {
+	case token == o.Config.WETH:
+		price.ETH = 1
+	case contains(o.Config.Stablecoins, token):
+		price.ETH = 1 / ethUSD
+	default:
+		price.ETH, price.LiquidityETH, price.Pairs, err = o.derive(token, ethUSD, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	price.USD = price.ETH * ethUSD
+	return price, nil
+}
+
+// derive prices token in ETH from its whitelisted pairs. Whitelisted
+// counterparts are themselves priced one level deep against WETH or stables.
+func (o *Oracle) derive(token string, ethUSD float64, recurse bool) (float64, float64, []string, error) {
+	var weightedPrice, totalLiquidity float64
+	var pairs []string
+	for _, pool := range o.Graph.PoolsForToken(token) {
+		reserveToken, reserveCounter, counter := pool.Reserves(token)
+		if reserveToken <= 0 || !contains(o.Config.Whitelist, counter) {
+			continue
+		}
+		var counterETH float64
+		switch {
+		case counter == o.Config.WETH:
+			counterETH = 1
+		case contains(o.Config.Stablecoins, counter):
+			counterETH = 1 / ethUSD
+		case recurse:
+			var err error
+			counterETH, _, _, err = o.derive(counter, ethUSD, false)
+			if err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		liquidity := reserveCounter * counterETH
+		if liquidity < o.Config.MinLiquidityETH {
+			continue
+		}
+		weightedPrice += reserveCounter / reserveToken * counterETH * liquidity
+		totalLiquidity += liquidity
+		pairs = append(pairs, pool.ID)
+	}
+	if totalLiquidity == 0 {
+		return 0, 0, nil, fmt.Errorf("pricing %s: %w", token, ErrNoPrice)
+	}
+	return weightedPrice / totalLiquidity, totalLiquidity, pairs, nil
+}
+
+// Deviation compares the oracle price of a token with the derivedETH the
+// subgraph reports for it.
+type Deviation struct {
+	Token       string
+	OracleETH   float64
+	SubgraphETH float64
+	// Relative is (SubgraphETH - OracleETH) / OracleETH.
+	Relative float64
+}
+
+// Check returns how far the subgraph's derivedETH for token is from the oracle price.
+func (o *Oracle) Check(token uniswap.Token) (*Deviation, error) {
+	subgraphETH, err := strconv.ParseFloat(token.DerivedETH, 64)
+	if err != nil {
+		return nil, fmt.Errorf("token %s: invalid derivedETH: %v", token.ID, err)
+	}
+	price, err := o.PriceUSD(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Deviation{
+		Token:       price.Token,
+		OracleETH:   price.ETH,
+		SubgraphETH: subgraphETH,
+		Relative:    (subgraphETH - price.ETH) / price.ETH,
+	}, nil
+}
+
+// Suspicious reports whether the deviation exceeds tolerance in either direction.
+func (d *Deviation) Suspicious(tolerance float64) bool {
+	return math.Abs(d.Relative) > tolerance
+}
+
+func contains(list []string, token string) bool {
+	for _, item := range list {
+		if item == token {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerAll(list []string) []string {
+	lowered := make([]string, len(list))
+	for i, item := range list {
+		lowered[i] = strings.ToLower(item)
+	}
+	return lowered
+}
@@ -0,0 +1,100 @@
+package oracle
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/router"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswaptest"
+)
+
+const (
+	uni  = "0x1f9840a85d5af5bf1d1762f925bdaddc4201f984"
+	scam = "0x000000000000000000000000000000000000dead"
+)
+
+func testOracle(t *testing.T) *Oracle {
+	graph := router.NewGraph()
+	err := graph.Upsert([]uniswap.PairData{
+		uniswaptest.Pair("0xusdc-weth", USDC, WETH, "2000000", "1000"),
+		uniswaptest.Pair("0xdai-weth", DAI, WETH, "6300000", "3000"),
+		uniswaptest.Pair("0xuni-weth", uni, WETH, "40000", "100"),
+		uniswaptest.Pair("0xuni-usdt", uni, USDT, "10000", "50000"),
+		// A thin pool quoting UNI at a silly price must be ignored.
+		uniswaptest.Pair("0xuni-dai", uni, DAI, "1", "1000"),
+		uniswaptest.Pair("0xscam-weth", scam, WETH, "1000", "0.5"),
+	})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	return NewOracle(graph, DefaultConfig())
+}
+
+func TestETHPriceUSDIsLiquidityWeighted(t *testing.T) {
+	price, err := testOracle(t).ETHPriceUSD()
+	if err != nil {
+		t.Fatalf("ETHPriceUSD failed: %v", err)
+	}
+	expected := (2000*2000000 + 2100*6300000) / 8300000.0
+	if math.Abs(price-expected) > 1e-9 {
+		t.Errorf("Expected %f but got %f", expected, price)
+	}
+}
+
+func TestPriceUSDSkipsThinPairs(t *testing.T) {
+	oracle := testOracle(t)
+	ethUSD, _ := oracle.ETHPriceUSD()
+
+	price, err := oracle.PriceUSD(uni)
+	if err != nil {
+		t.Fatalf("PriceUSD failed: %v", err)
+	}
+	if len(price.Pairs) != 2 {
+		t.Errorf("Expected the WETH and USDT pairs only, got %v", price.Pairs)
+	}
+	// Both liquid pairs quote UNI at roughly 5 USD.
+	if math.Abs(price.USD-5) > 0.5 {
+		t.Errorf("Expected UNI near 5 USD, got %f (ETH %f)", price.USD, ethUSD)
+	}
+
+	if _, err := oracle.PriceUSD(scam); err == nil {
+		t.Error("Expected an error pricing a token without liquid pairs")
+	}
+}
+
+func TestCheckFlagsSubgraphDeviation(t *testing.T) {
+	oracle := testOracle(t)
+	deviation, err := oracle.Check(uniswap.Token{ID: uni, DerivedETH: "0.01"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !deviation.Suspicious(0.2) {
+		t.Errorf("Expected a large deviation, got %+v", deviation)
+	}
+}
+
+func TestAtBlockAndLoadTokenPinQueries(t *testing.T) {
+	var queries []map[string]interface{}
+	source := func(args map[string]interface{}) (*[]uniswap.PairData, error) {
+		queries = append(queries, args)
+		pairs := []uniswap.PairData{uniswaptest.Pair("0xusdc-weth", USDC, WETH, "2000000", "1000")}
+		return &pairs, nil
+	}
+	oracle, err := AtBlock(source, 15000000, 10, DefaultConfig())
+	if err != nil {
+		t.Fatalf("AtBlock failed: %v", err)
+	}
+	if err := oracle.LoadToken(source, uni, 15000000); err != nil {
+		t.Fatalf("LoadToken failed: %v", err)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("Expected three queries, got %d", len(queries))
+	}
+	for _, args := range queries {
+		block, ok := args["block"].(map[string]interface{})
+		if !ok || block["number"] != 15000000 {
+			t.Errorf("Expected query pinned to block, got %v", args)
+		}
+	}
+}
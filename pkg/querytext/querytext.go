@@ -0,0 +1,50 @@
+// Package querytext normalizes the text of GraphQL queries, so queries
+// differing only in layout compare equal, e.g. as cache or fixture keys.
+package querytext
+
+import "strings"
+
+// punctuators are the characters whitespace is dropped around.
+const punctuators = "{}():,$![]"
+
+// Normalize collapses the whitespace of query to single spaces and drops it
+// around punctuators. String literals are kept as written, so "A B" and
+// "A  B" stay distinct.
+func Normalize(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	var last byte
+	space, inString := false, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if inString {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(query) {
+				i++
+				b.WriteByte(query[i])
+			} else if c == '"' {
+				inString = false
+			}
+			last = c
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 && !isPunctuator(last) && !isPunctuator(c) {
+			b.WriteByte(' ')
+		}
+		space = false
+		if c == '"' {
+			inString = true
+		}
+		b.WriteByte(c)
+		last = c
+	}
+	return b.String()
+}
+
+func isPunctuator(c byte) bool {
+	return strings.IndexByte(punctuators, c) >= 0
+}
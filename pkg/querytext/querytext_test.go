@@ -0,0 +1,20 @@
+package querytext
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for _, test := range []struct{ query, expected string }{
+		{"{\n  pair( id: \"0xa\" ) {\n    id\n    token0 { symbol }\n  }\n}", `{pair(id:"0xa"){id token0{symbol}}}`},
+		{"query($first: Int!, $ids: [String!]) { pairs(first: $first) { id } }", `query($first:Int!,$ids:[String!]){pairs(first:$first){id}}`},
+		// String literals are kept as written, escaped quotes included.
+		{`{ tokens(where: {symbol: "A  B"}) { id } }`, `{tokens(where:{symbol:"A  B"}){id}}`},
+		{`{ tokens(where: {name: "say \"hi , there\" "}) { id } }`, `{tokens(where:{name:"say \"hi , there\" "}){id}}`},
+	} {
+		if got := Normalize(test.query); got != test.expected {
+			t.Errorf("Unexpected normalized query:\nGot:      %s\nExpected: %s", got, test.expected)
+		}
+	}
+	if Normalize(`{ tokens(where: {symbol: "A B"}) { id } }`) == Normalize(`{ tokens(where: {symbol: "A  B"}) { id } }`) {
+		t.Error("Expected different string literals to stay distinct")
+	}
+}
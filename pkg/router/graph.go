@@ -0,0 +1,239 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// The Graph limits entity return amounts to 1000 per query.
+const pageSize = 1000
+
+// PairSource fetches pairs with their reserves. uniswap.QueryPairs is the
+// default; tests and backtests can plug in fixtures or historical snapshots.
+type PairSource func(args map[string]interface{}) (*[]uniswap.PairData, error)
+
+// Pool is the routing view of a Uniswap V2 pair: two token addresses and
+// their decimal-adjusted reserves.
+type Pool struct {
+	ID        string
+	Token0    string
+	Token1    string
+	Symbol0   string
+	Symbol1   string
+	Reserve0  float64
+	Reserve1  float64
+	UpdatedAt time.Time
+}
+
+// Reserves returns the reserves of the pool oriented from tokenIn to the other token.
+func (p *Pool) Reserves(tokenIn string) (reserveIn, reserveOut float64, tokenOut string) {
+	if tokenIn == p.Token0 {
+		return p.Reserve0, p.Reserve1, p.Token1
+	}
+	return p.Reserve1, p.Reserve0, p.Token0
+}
+
+// Graph is a cached token graph where every pool is an edge between its two
+// tokens. It is safe for concurrent use and can be refreshed pair by pair.
+type Graph struct {
+	mu     sync.RWMutex
+	pools  map[string]*Pool
+	tokens map[string][]string
+}
+
+func NewGraph() *Graph {
+	return &Graph{
+		pools:  make(map[string]*Pool),
+		tokens: make(map[string][]string),
+	}
+}
+
+// NewPool converts subgraph pair data into a Pool.
+func NewPool(pair uniswap.PairData) (*Pool, error) {
+	if pair.Token0 == nil || pair.Token1 == nil {
+		return nil, fmt.Errorf("pair %s: missing token data", pair.ID)
+	}
+	reserve0, err := strconv.ParseFloat(pair.Reserve0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("pair %s: invalid reserve0: %v", pair.ID, err)
+	}
+	reserve1, err := strconv.ParseFloat(pair.Reserve1, 64)
+	if err != nil {
+		return nil, fmt.Errorf("pair %s: invalid reserve1: %v", pair.ID, err)
+	}
+	return &Pool{
+		ID:        strings.ToLower(pair.ID),
+		Token0:    strings.ToLower(pair.Token0.ID),
+		Token1:    strings.ToLower(pair.Token1.ID),
+		Symbol0:   pair.Token0.Symbol,
+		Symbol1:   pair.Token1.Symbol,
+		Reserve0:  reserve0,
+		Reserve1:  reserve1,
+		UpdatedAt: time.Now(),
+	}, nil
+}
+
+// Upsert adds new pairs to the graph and updates the reserves of known ones.
+func (g *Graph) Upsert(pairs []uniswap.PairData) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, pair := range pairs {
+		pool, err := NewPool(pair)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.pools[pool.ID]; !ok {
+			g.tokens[pool.Token0] = append(g.tokens[pool.Token0], pool.ID)
+			g.tokens[pool.Token1] = append(g.tokens[pool.Token1], pool.ID)
+		}
+		g.pools[pool.ID] = pool
+	}
+	return nil
+}
+
+// Remove drops a pair from the graph.
+func (g *Graph) Remove(pairID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pairID = strings.ToLower(pairID)
+	pool, ok := g.pools[pairID]
+	if !ok {
+		return
+	}
+	delete(g.pools, pairID)
+	for _, token := range []string{pool.Token0, pool.Token1} {
+		ids := g.tokens[token]
+		for i, id := range ids {
+			if id == pairID {
+				g.tokens[token] = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(g.tokens[token]) == 0 {
+			delete(g.tokens, token)
+		}
+	}
+}
+
+// Pool returns a copy of the pool with the given pair ID.
+func (g *Graph) Pool(pairID string) (Pool, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	pool, ok := g.pools[strings.ToLower(pairID)]
+	if !ok {
+		return Pool{}, false
+	}
+	return *pool, true
+}
+
+// Pools returns a copy of every pool in the graph.
+func (g *Graph) Pools() []Pool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	pools := make([]Pool, 0, len(g.pools))
+	for _, pool := range g.pools {
+		pools = append(pools, *pool)
+	}
+	return pools
+}
+
+// PoolsForToken returns copies of the pools that contain token.
+func (g *Graph) PoolsForToken(token string) []Pool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	ids := g.tokens[strings.ToLower(token)]
+	pools := make([]Pool, 0, len(ids))
+	for _, id := range ids {
+		pools = append(pools, *g.pools[id])
+	}
+	return pools
+}
+
+// Len returns the number of pools in the graph.
+func (g *Graph) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.pools)
+}
+
+// Load fetches up to limit of the most liquid pairs from source, 1000 at a
+// time, and upserts them into the graph. Extra args such as a block
+// constraint are merged into every page request.
+func (g *Graph) Load(source PairSource, limit int, extra map[string]interface{}) error {
+	for skip := 0; skip < limit; skip += pageSize {
+		first := pageSize
+		if limit-skip < first {
+			first = limit - skip
+		}
+		args := map[string]interface{}{
+			"first":          first,
+			"skip":           skip,
+			"orderBy":        "reserveUSD",
+			"orderDirection": "desc",
+		}
+		for k, v := range extra {
+			args[k] = v
+		}
+		pairs, err := source(args)
+		if err != nil {
+			return err
+		}
+		if pairs == nil || len(*pairs) == 0 {
+			return nil
+		}
+		if err := g.Upsert(*pairs); err != nil {
+			return err
+		}
+		if len(*pairs) < first {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Refresh re-fetches the reserves of the given pairs only, so the cached
+// graph can be kept current without reloading every pair.
+func (g *Graph) Refresh(source PairSource, pairIDs []string) error {
+	for start := 0; start < len(pairIDs); start += pageSize {
+		end := start + pageSize
+		if end > len(pairIDs) {
+			end = len(pairIDs)
+		}
+		args := map[string]interface{}{
+			"first": end - start,
+			"where": map[string]interface{}{
+				"id_in": pairIDs[start:end],
+			},
+		}
+		pairs, err := source(args)
+		if err != nil {
+			return err
+		}
+		if pairs == nil {
+			continue
+		}
+		if err := g.Upsert(*pairs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshOlderThan re-fetches every pool whose reserves are older than maxAge.
+func (g *Graph) RefreshOlderThan(source PairSource, maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+	var stale []string
+	g.mu.RLock()
+	for id, pool := range g.pools {
+		if pool.UpdatedAt.Before(cutoff) {
+			stale = append(stale, id)
+		}
+	}
+	g.mu.RUnlock()
+	return g.Refresh(source, stale)
+}
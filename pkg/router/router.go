@@ -0,0 +1,131 @@
+package router
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// DefaultMaxHops matches the path length most Uniswap V2 frontends route through.
+const DefaultMaxHops = 3
+
+// ErrNoRoute is returned when no path connects the two tokens within the hop limit.
+var ErrNoRoute = errors.New("no route found")
+
+// Route is a swap path through one or more pools.
+type Route struct {
+	Tokens    []string // token addresses from input to output, len(Pairs)+1
+	Pairs     []string // pair IDs traversed in order
+	AmountIn  float64
+	AmountOut float64
+	// MidPrice is the product of the spot prices along the path, before fees.
+	MidPrice float64
+	// PriceImpact is the relative shortfall of AmountOut against AmountIn*MidPrice,
+	// including the 0.3% fee charged at every hop.
+	PriceImpact float64
+}
+
+type Router struct {
+	Graph   *Graph
+	MaxHops int
+}
+
+func NewRouter(graph *Graph, maxHops int) *Router {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	return &Router{Graph: graph, MaxHops: maxHops}
+}
+
+// BestRoute searches every simple path of up to MaxHops pools between tokenIn
+// and tokenOut, simulates amountIn through each with the constant-product
+// formula and returns the path with the highest output.
+func (r *Router) BestRoute(tokenIn, tokenOut string, amountIn float64) (*Route, error) {
+	tokenIn = strings.ToLower(tokenIn)
+	tokenOut = strings.ToLower(tokenOut)
+	if tokenIn == tokenOut {
+		return nil, errors.New("tokenIn and tokenOut must differ")
+	}
+	if amountIn <= 0 {
+		return nil, errors.New("amountIn must be positive")
+	}
+
+	var best *Route
+	visited := map[string]bool{tokenIn: true}
+	path := &Route{Tokens: []string{tokenIn}, AmountIn: amountIn, MidPrice: 1}
+
+	var search func(token string, amount float64)
+	search = func(token string, amount float64) {
+		for _, pool := range r.Graph.PoolsForToken(token) {
+			reserveIn, reserveOut, next := pool.Reserves(token)
+			if visited[next] {
+				continue
+			}
+			out, err := uniswap.GetAmountOut(amount, reserveIn, reserveOut)
+			if err != nil || out <= 0 {
+				continue
+			}
+			midPrice := path.MidPrice
+			path.Tokens = append(path.Tokens, next)
+			path.Pairs = append(path.Pairs, pool.ID)
+			path.MidPrice *= uniswap.SpotPrice(reserveIn, reserveOut)
+
+			if next == tokenOut {
+				if best == nil || out > best.AmountOut {
+					best = &Route{
+						Tokens:    append([]string(nil), path.Tokens...),
+						Pairs:     append([]string(nil), path.Pairs...),
+						AmountIn:  amountIn,
+						AmountOut: out,
+						MidPrice:  path.MidPrice,
+					}
+				}
+			} else if len(path.Pairs) < r.MaxHops {
+				visited[next] = true
+				search(next, out)
+				visited[next] = false
+			}
+
+			path.Tokens = path.Tokens[:len(path.Tokens)-1]
+			path.Pairs = path.Pairs[:len(path.Pairs)-1]
+			path.MidPrice = midPrice
+		}
+	}
+	search(tokenIn, amountIn)
+
+	if best == nil {
+		return nil, ErrNoRoute
+	}
+	best.PriceImpact = 1 - best.AmountOut/(best.AmountIn*best.MidPrice)
+	return best, nil
+}
+
+// Quote simulates amountIn through a fixed path of pair IDs starting at tokenIn.
+func (r *Router) Quote(tokenIn string, pairIDs []string, amountIn float64) (*Route, error) {
+	token := strings.ToLower(tokenIn)
+	route := &Route{Tokens: []string{token}, AmountIn: amountIn, MidPrice: 1}
+	amount := amountIn
+	for _, id := range pairIDs {
+		pool, ok := r.Graph.Pool(id)
+		if !ok {
+			return nil, errors.New("unknown pair " + id)
+		}
+		if token != pool.Token0 && token != pool.Token1 {
+			return nil, errors.New("pair " + id + " does not contain " + token)
+		}
+		reserveIn, reserveOut, next := pool.Reserves(token)
+		out, err := uniswap.GetAmountOut(amount, reserveIn, reserveOut)
+		if err != nil {
+			return nil, err
+		}
+		route.MidPrice *= uniswap.SpotPrice(reserveIn, reserveOut)
+		route.Tokens = append(route.Tokens, next)
+		route.Pairs = append(route.Pairs, pool.ID)
+		amount = out
+		token = next
+	}
+	route.AmountOut = amount
+	route.PriceImpact = 1 - route.AmountOut/(route.AmountIn*route.MidPrice)
+	return route, nil
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswaptest"
+)
+
+const (
+	weth = "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+	usdc = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	dai  = "0x6b175474e89094c44da98b954eedeac495271d0f"
+)
+
+func testGraph(t *testing.T) *Graph {
+	graph := NewGraph()
+	err := graph.Upsert([]uniswap.PairData{
+		uniswaptest.Pair("0xpair-weth-usdc", usdc, weth, "2000000", "1000"),
+		uniswaptest.Pair("0xpair-weth-dai", dai, weth, "20000000", "10000"),
+		uniswaptest.Pair("0xpair-usdc-dai", usdc, dai, "5000000", "5000000"),
+	})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	return graph
+}
+
+func TestBestRoutePrefersDeeperPath(t *testing.T) {
+	router := NewRouter(testGraph(t), 3)
+
+	route, err := router.BestRoute(weth, usdc, 10)
+	if err != nil {
+		t.Fatalf("BestRoute failed: %v", err)
+	}
+
+	// The direct WETH/USDC pool is shallow, so routing through the deep DAI pool wins.
+	expectedPairs := []string{"0xpair-weth-dai", "0xpair-usdc-dai"}
+	if len(route.Pairs) != len(expectedPairs) {
+		t.Fatalf("Unexpected path: %v", route.Pairs)
+	}
+	for i := range expectedPairs {
+		if route.Pairs[i] != expectedPairs[i] {
+			t.Fatalf("Unexpected path: %v", route.Pairs)
+		}
+	}
+
+	direct, err := router.Quote(weth, []string{"0xpair-weth-usdc"}, 10)
+	if err != nil {
+		t.Fatalf("Quote failed: %v", err)
+	}
+	if route.AmountOut <= direct.AmountOut {
+		t.Errorf("Expected routed output %f to beat direct output %f", route.AmountOut, direct.AmountOut)
+	}
+	if route.PriceImpact <= 0 || route.PriceImpact >= 1 {
+		t.Errorf("Unexpected price impact %f", route.PriceImpact)
+	}
+}
+
+func TestBestRouteRespectsMaxHops(t *testing.T) {
+	router := NewRouter(testGraph(t), 1)
+
+	route, err := router.BestRoute(weth, usdc, 10)
+	if err != nil {
+		t.Fatalf("BestRoute failed: %v", err)
+	}
+	if len(route.Pairs) != 1 || route.Pairs[0] != "0xpair-weth-usdc" {
+		t.Errorf("Expected direct route, got %v", route.Pairs)
+	}
+
+	if _, err := router.BestRoute(weth, "0xunknown", 10); err != ErrNoRoute {
+		t.Errorf("Expected ErrNoRoute, got %v", err)
+	}
+}
+
+func TestQuoteMatchesConstantProduct(t *testing.T) {
+	router := NewRouter(testGraph(t), 3)
+
+	route, err := router.Quote(usdc, []string{"0xpair-weth-usdc"}, 2000)
+	if err != nil {
+		t.Fatalf("Quote failed: %v", err)
+	}
+	expected := 2000 * 997 * 1000 / (2000000*1000 + 2000*997.0)
+	if math.Abs(route.AmountOut-expected) > 1e-9 {
+		t.Errorf("Expected %f but got %f", expected, route.AmountOut)
+	}
+}
+
+func TestGraphRefreshAndRemove(t *testing.T) {
+	graph := testGraph(t)
+	source := func(args map[string]interface{}) (*[]uniswap.PairData, error) {
+		pairs := []uniswap.PairData{uniswaptest.Pair("0xpair-usdc-dai", usdc, dai, "6000000", "4000000")}
+		return &pairs, nil
+	}
+	if err := graph.Refresh(source, []string{"0xpair-usdc-dai"}); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	pool, ok := graph.Pool("0xpair-usdc-dai")
+	if !ok || pool.Reserve0 != 6000000 {
+		t.Errorf("Expected refreshed reserves, got %+v", pool)
+	}
+	if graph.Len() != 3 {
+		t.Errorf("Refresh must not duplicate pools, got %d", graph.Len())
+	}
+
+	graph.Remove("0xpair-usdc-dai")
+	if len(graph.PoolsForToken(dai)) != 1 {
+		t.Errorf("Expected one DAI pool after removal, got %d", len(graph.PoolsForToken(dai)))
+	}
+}
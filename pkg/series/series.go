@@ -0,0 +1,171 @@
+package series
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// Day is the step between two points of a daily series, in seconds.
+const Day = 86400
+
+// Point is one daily observation. Date is the unix timestamp of midnight UTC,
+// as in the subgraph's day entities. Missing values are NaN.
+type Point struct {
+	Date  int64
+	Value float64
+}
+
+// Series is a named daily series ordered by date.
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// New returns a series with its points sorted by date.
+func New(name string, points []Point) *Series {
+	sorted := append([]Point(nil), points...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+	return &Series{Name: name, Points: sorted}
+}
+
+// Values returns the values of the series in date order.
+func (s *Series) Values() []float64 {
+	values := make([]float64, len(s.Points))
+	for i, point := range s.Points {
+		values[i] = point.Value
+	}
+	return values
+}
+
+// Len returns the number of points.
+func (s *Series) Len() int {
+	return len(s.Points)
+}
+
+// TokenField selects the value of a TokenDayData to build a series from.
+type TokenField func(uniswap.TokenDayData) string
+
+// PairField selects the value of a PairDailyAggregated to build a series from.
+type PairField func(uniswap.PairDailyAggregated) string
+
+var (
+	TokenPriceUSD          TokenField = func(d uniswap.TokenDayData) string { return d.PriceUSD }
+	TokenDailyVolumeUSD    TokenField = func(d uniswap.TokenDayData) string { return d.DailyVolumeUSD }
+	TokenTotalLiquidityUSD TokenField = func(d uniswap.TokenDayData) string { return d.TotalLiquidityUSD }
+	PairDailyVolumeUSD     PairField  = func(d uniswap.PairDailyAggregated) string { return d.DailyVolumeUSD }
+	PairReserveUSD         PairField  = func(d uniswap.PairDailyAggregated) string { return d.ReserveUSD }
+)
+
+// FromTokenDayData builds a series from the output of QueryTokenDailyData.
+func FromTokenDayData(name string, data []uniswap.TokenDayData, field TokenField) (*Series, error) {
+	points := make([]Point, 0, len(data))
+	for _, day := range data {
+		value, err := strconv.ParseFloat(field(day), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s on %d: %v", name, day.Date, err)
+		}
+		points = append(points, Point{Date: int64(day.Date), Value: value})
+	}
+	return New(name, points), nil
+}
+
+// FromPairDailyAggregated builds a series from the output of QueryPairDailyAggregated.
+func FromPairDailyAggregated(name string, data []uniswap.PairDailyAggregated, field PairField) (*Series, error) {
+	points := make([]Point, 0, len(data))
+	for _, day := range data {
+		value, err := strconv.ParseFloat(field(day), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s on %d: %v", name, day.Date, err)
+		}
+		points = append(points, Point{Date: int64(day.Date), Value: value})
+	}
+	return New(name, points), nil
+}
+
+// Fill decides what goes into the days a series has no data for.
+type Fill int
+
+const (
+	// FillNaN leaves gaps as NaN.
+	FillNaN Fill = iota
+	// FillForward carries the last known value forward, which suits prices
+	// and reserves. Leading gaps stay NaN.
+	FillForward
+	// FillZero uses 0, which suits volumes.
+	FillZero
+)
+
+// Align puts every series on the same daily calendar, from the earliest to
+// the latest date across all of them, filling gaps with fill.
+func Align(fill Fill, series ...*Series) []*Series {
+	if len(series) == 0 {
+		return nil
+	}
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, s := range series {
+		if s.Len() == 0 {
+			continue
+		}
+		if s.Points[0].Date < first {
+			first = s.Points[0].Date
+		}
+		if s.Points[s.Len()-1].Date > last {
+			last = s.Points[s.Len()-1].Date
+		}
+	}
+	aligned := make([]*Series, len(series))
+	for i, s := range series {
+		byDate := make(map[int64]float64, s.Len())
+		for _, point := range s.Points {
+			byDate[point.Date] = point.Value
+		}
+		out := &Series{Name: s.Name}
+		previous := math.NaN()
+		for date := first; date <= last; date += Day {
+			value, ok := byDate[date]
+			if !ok {
+				switch fill {
+				case FillForward:
+					value = previous
+				case FillZero:
+					value = 0
+				default:
+					value = math.NaN()
+				}
+			}
+			previous = value
+			out.Points = append(out.Points, Point{Date: date, Value: value})
+		}
+		aligned[i] = out
+	}
+	return aligned
+}
+
+// WriteTo writes the series to store as one point per day with a single
+// "value" field, tagged with the series name and the given tags. NaN points
+// are skipped.
+func (s *Series) WriteTo(store db.Store, measurement string, tags map[string]string) error {
+	pointTags := map[string]string{"series": s.Name}
+	for k, v := range tags {
+		pointTags[k] = v
+	}
+	points := make([]db.Point, 0, len(s.Points))
+	for _, point := range s.Points {
+		if math.IsNaN(point.Value) || math.IsInf(point.Value, 0) {
+			continue
+		}
+		points = append(points, db.Point{
+			Measurement: measurement,
+			Tags:        pointTags,
+			Fields:      map[string]interface{}{"value": point.Value},
+			Time:        time.Unix(point.Date, 0).UTC(),
+		})
+	}
+	return store.WritePoints(points)
+}
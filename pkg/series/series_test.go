@@ -0,0 +1,119 @@
+package series
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/db"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+const start = 1672531200 // 2023-01-01
+
+func daily(name string, values ...float64) *Series {
+	points := make([]Point, len(values))
+	for i, value := range values {
+		points[i] = Point{Date: start + int64(i)*Day, Value: value}
+	}
+	return New(name, points)
+}
+
+func TestFromTokenDayData(t *testing.T) {
+	data := []uniswap.TokenDayData{
+		{Date: start + Day, PriceUSD: "1.01"},
+		{Date: start, PriceUSD: "0.99"},
+	}
+	s, err := FromTokenDayData("dai", data, TokenPriceUSD)
+	if err != nil {
+		t.Fatalf("FromTokenDayData failed: %v", err)
+	}
+	if s.Points[0].Date != start || s.Points[1].Value != 1.01 {
+		t.Errorf("Expected points sorted by date, got %+v", s.Points)
+	}
+	if _, err := FromTokenDayData("dai", []uniswap.TokenDayData{{PriceUSD: "n/a"}}, TokenPriceUSD); err == nil {
+		t.Error("Expected an error for an invalid value")
+	}
+}
+
+func TestAlignFillsGaps(t *testing.T) {
+	a := New("a", []Point{{start, 1}, {start + 3*Day, 4}})
+	b := New("b", []Point{{start + Day, 10}})
+
+	aligned := Align(FillForward, a, b)
+	if aligned[0].Len() != 4 || aligned[1].Len() != 4 {
+		t.Fatalf("Expected 4 aligned days, got %d and %d", aligned[0].Len(), aligned[1].Len())
+	}
+	if aligned[0].Points[2].Value != 1 {
+		t.Errorf("Expected forward fill, got %v", aligned[0].Points[2].Value)
+	}
+	if !math.IsNaN(aligned[1].Points[0].Value) || aligned[1].Points[3].Value != 10 {
+		t.Errorf("Unexpected fill for b: %+v", aligned[1].Points)
+	}
+
+	zero := Align(FillZero, a, b)
+	if zero[0].Points[1].Value != 0 {
+		t.Errorf("Expected zero fill, got %v", zero[0].Points[1].Value)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	s := daily("eth", 100, 110, 99, 120, 90)
+
+	returns := s.Returns().Values()
+	if !math.IsNaN(returns[0]) || math.Abs(returns[1]-0.1) > 1e-12 {
+		t.Errorf("Unexpected returns %v", returns)
+	}
+	ma := s.MovingAverage(3).Values()
+	if !math.IsNaN(ma[1]) || math.Abs(ma[2]-103) > 1e-12 {
+		t.Errorf("Unexpected moving average %v", ma)
+	}
+	if drawdown := s.MaxDrawdown(); math.Abs(drawdown+0.25) > 1e-12 {
+		t.Errorf("Expected max drawdown -0.25, got %f", drawdown)
+	}
+	volatility := s.RollingVolatility(2, false).Values()
+	if !math.IsNaN(volatility[1]) || volatility[4] <= 0 {
+		t.Errorf("Unexpected volatility %v", volatility)
+	}
+	if ema := s.ExponentialMovingAverage(3).Values(); ema[0] != 100 || ema[1] != 105 {
+		t.Errorf("Unexpected EMA %v", ema)
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	a := daily("a", 1, 2, 3, 4)
+	b := daily("b", 2, 4, 6, 8)
+	c := daily("c", 8, 6, 4, 2)
+
+	if correlation, _ := Correlation(a, b); math.Abs(correlation-1) > 1e-12 {
+		t.Errorf("Expected perfect correlation, got %f", correlation)
+	}
+	if correlation, _ := Correlation(a, c); math.Abs(correlation+1) > 1e-12 {
+		t.Errorf("Expected perfect anti-correlation, got %f", correlation)
+	}
+	if _, err := Correlation(a, daily("short", 1)); err == nil {
+		t.Error("Expected an error for unaligned series")
+	}
+
+	matrix, err := CorrelationMatrix(daily("x", 1, 2, 1, 2), daily("y", 10, 20, 10, 20))
+	if err != nil {
+		t.Fatalf("CorrelationMatrix failed: %v", err)
+	}
+	if matrix[0][0] != 1 || math.Abs(matrix[0][1]-1) > 1e-12 {
+		t.Errorf("Unexpected matrix %v", matrix)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	store := db.NewMemoryStore()
+	s := daily("eth", 100, math.NaN(), 120)
+	if err := s.WriteTo(store, "token_stats", map[string]string{"token": "weth"}); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	points, err := store.ReadSeries(db.SeriesQuery{Measurement: "token_stats", Tags: map[string]string{"series": "eth"}})
+	if err != nil {
+		t.Fatalf("ReadSeries failed: %v", err)
+	}
+	if len(points) != 2 || points[1].Fields["value"] != 120.0 || points[0].Tags["token"] != "weth" {
+		t.Errorf("Unexpected points %+v", points)
+	}
+}
@@ -0,0 +1,198 @@
+package series
+
+import (
+	"errors"
+	"math"
+)
+
+// DaysPerYear annualizes daily statistics; crypto markets trade every day.
+const DaysPerYear = 365
+
+// Returns returns the simple daily returns value[i]/value[i-1] - 1. The first
+// point, and any point next to a gap, is NaN.
+func (s *Series) Returns() *Series {
+	return s.derive(s.Name+"_returns", func(i int) float64 {
+		if i == 0 {
+			return math.NaN()
+		}
+		return s.Points[i].Value/s.Points[i-1].Value - 1
+	})
+}
+
+// LogReturns returns ln(value[i]/value[i-1]).
+func (s *Series) LogReturns() *Series {
+	return s.derive(s.Name+"_log_returns", func(i int) float64 {
+		if i == 0 {
+			return math.NaN()
+		}
+		return math.Log(s.Points[i].Value / s.Points[i-1].Value)
+	})
+}
+
+// MovingAverage returns the simple moving average over window points,
+// skipping NaN values. Points before the window is full are NaN.
+func (s *Series) MovingAverage(window int) *Series {
+	values := s.Values()
+	return s.derive(s.Name+"_ma", func(i int) float64 {
+		if window <= 0 || i+1 < window {
+			return math.NaN()
+		}
+		mean, _ := meanStd(values[i+1-window : i+1])
+		return mean
+	})
+}
+
+// ExponentialMovingAverage returns the EMA with smoothing 2/(span+1), seeded
+// with the first non-NaN value.
+func (s *Series) ExponentialMovingAverage(span int) *Series {
+	alpha := 2 / (float64(span) + 1)
+	ema := math.NaN()
+	return s.derive(s.Name+"_ema", func(i int) float64 {
+		value := s.Points[i].Value
+		switch {
+		case math.IsNaN(value):
+		case math.IsNaN(ema):
+			ema = value
+		default:
+			ema = alpha*value + (1-alpha)*ema
+		}
+		return ema
+	})
+}
+
+// RollingVolatility returns the standard deviation of daily log returns over
+// window days, annualized with sqrt(365) when annualize is set.
+func (s *Series) RollingVolatility(window int, annualize bool) *Series {
+	returns := s.LogReturns().Values()
+	scale := 1.0
+	if annualize {
+		scale = math.Sqrt(DaysPerYear)
+	}
+	return s.derive(s.Name+"_volatility", func(i int) float64 {
+		if window < 2 || i < window {
+			return math.NaN()
+		}
+		_, std := meanStd(returns[i+1-window : i+1])
+		return std * scale
+	})
+}
+
+// Drawdowns returns, for every point, the relative distance to the running
+// peak: 0 at a new high, -0.25 when 25% below it.
+func (s *Series) Drawdowns() *Series {
+	peak := math.Inf(-1)
+	return s.derive(s.Name+"_drawdown", func(i int) float64 {
+		value := s.Points[i].Value
+		if math.IsNaN(value) {
+			return math.NaN()
+		}
+		if value > peak {
+			peak = value
+		}
+		return value/peak - 1
+	})
+}
+
+// MaxDrawdown returns the deepest drawdown of the series, as a negative fraction.
+func (s *Series) MaxDrawdown() float64 {
+	deepest := 0.0
+	for _, drawdown := range s.Drawdowns().Values() {
+		if drawdown < deepest {
+			deepest = drawdown
+		}
+	}
+	return deepest
+}
+
+var errLength = errors.New("series must have the same length; align them first")
+
+// Correlation returns the Pearson correlation of two aligned series over the
+// points where both are defined.
+func Correlation(a, b *Series) (float64, error) {
+	if a.Len() != b.Len() {
+		return 0, errLength
+	}
+	var xs, ys []float64
+	for i := range a.Points {
+		x, y := a.Points[i].Value, b.Points[i].Value
+		if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+			continue
+		}
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+	if len(xs) < 2 {
+		return math.NaN(), nil
+	}
+	meanX, stdX := meanStd(xs)
+	meanY, stdY := meanStd(ys)
+	if stdX == 0 || stdY == 0 {
+		return math.NaN(), nil
+	}
+	var covariance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	covariance /= float64(len(xs) - 1)
+	return covariance / (stdX * stdY), nil
+}
+
+// CorrelationMatrix aligns the series, forward filling gaps, and returns the
+// pairwise correlations of their daily returns, in the order given.
+func CorrelationMatrix(series ...*Series) ([][]float64, error) {
+	aligned := Align(FillForward, series...)
+	returns := make([]*Series, len(aligned))
+	for i, s := range aligned {
+		returns[i] = s.Returns()
+	}
+	matrix := make([][]float64, len(returns))
+	for i := range returns {
+		matrix[i] = make([]float64, len(returns))
+		for j := range returns {
+			if i == j {
+				matrix[i][j] = 1
+				continue
+			}
+			correlation, err := Correlation(returns[i], returns[j])
+			if err != nil {
+				return nil, err
+			}
+			matrix[i][j] = correlation
+		}
+	}
+	return matrix, nil
+}
+
+func (s *Series) derive(name string, value func(i int) float64) *Series {
+	out := &Series{Name: name, Points: make([]Point, len(s.Points))}
+	for i, point := range s.Points {
+		out.Points[i] = Point{Date: point.Date, Value: value(i)}
+	}
+	return out
+}
+
+// meanStd returns the mean and sample standard deviation of the non-NaN values.
+func meanStd(values []float64) (float64, float64) {
+	var sum float64
+	var n int
+	for _, value := range values {
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			sum += value
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	mean := sum / float64(n)
+	if n < 2 {
+		return mean, math.NaN()
+	}
+	var squares float64
+	for _, value := range values {
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			squares += (value - mean) * (value - mean)
+		}
+	}
+	return mean, math.Sqrt(squares / float64(n-1))
+}
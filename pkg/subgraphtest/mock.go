@@ -0,0 +1,383 @@
+package subgraphtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Mock is a subgraph answering queries from entities in memory. Unlike a
+// Server it evaluates them: first, skip, orderBy, orderDirection and where,
+// with the field, _not, _gt, _gte, _lt, _lte, _in and _not_in filters.
+//
+// Entities are loaded from JSON files mapping collections to entities:
+//
+//	{
+//	  "tokens": [{"id": "0x6b17...", "symbol": "DAI"}],
+//	  "pairs": [{"id": "0xa478...", "token0": "0x6b17...", "reserveUSD": "14030838.95"}]
+//	}
+//
+// A field naming another entity holds its id, or the entity itself, and is
+// resolved when the query selects its fields. Collections are queried by
+// name (pairs) and single entities by the name without the trailing s
+// (pair(id: ...)).
+type Mock struct {
+	*httptest.Server
+	// Block is the block number _meta reports.
+	Block int64
+
+	mu          sync.Mutex
+	collections map[string][]map[string]interface{}
+	queries     []string
+}
+
+// references maps the fields holding entity ids to their collection.
+var references = map[string]string{
+	"pair":        "pairs",
+	"token":       "tokens",
+	"token0":      "tokens",
+	"token1":      "tokens",
+	"user":        "users",
+	"transaction": "transactions",
+}
+
+const (
+	defaultFirst = 100
+	maxFirst     = 1000
+	maxSkip      = 5000
+)
+
+// NewMock starts a mock with the entities of paths, closed when the test ends.
+func NewMock(t testing.TB, paths ...string) *Mock {
+	t.Helper()
+	m := &Mock{collections: make(map[string][]map[string]interface{})}
+	for _, path := range paths {
+		if err := m.Load(path); err != nil {
+			t.Fatalf("subgraphtest: %v", err)
+		}
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// Load adds the entities of a JSON file.
+func (m *Mock) Load(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	var collections map[string][]map[string]interface{}
+	if err := decoder.Decode(&collections); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for collection, entities := range collections {
+		m.Add(collection, entities...)
+	}
+	return nil
+}
+
+// Add adds entities to a collection, replacing those with the same id.
+func (m *Mock) Add(collection string, entities ...map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entity := range entities {
+		replaced := false
+		for i, existing := range m.collections[collection] {
+			if compare(existing["id"], entity["id"]) == 0 {
+				m.collections[collection][i] = entity
+				replaced = true
+			}
+		}
+		if !replaced {
+			m.collections[collection] = append(m.collections[collection], entity)
+		}
+	}
+}
+
+// Queries returns the normalized queries received, in order.
+func (m *Mock) Queries() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.queries...)
+}
+
+// Run executes query, so a Mock can also be used directly as a uniswap.Runner.
+func (m *Mock) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	return m.Execute(query, nil)
+}
+
+// Execute returns the data of query with variables, or the error graph-node
+// would report.
+func (m *Mock) Execute(query string, variables map[string]interface{}) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries = append(m.queries, NormalizeQuery(query))
+	// Decode variables as they would arrive over HTTP, so []string becomes
+	// []interface{} and numbers json.Number.
+	raw, err := json.Marshal(variables)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&variables); err != nil {
+		return nil, err
+	}
+	fields, err := parseQuery(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{})
+	for _, f := range fields {
+		value, err := m.resolveRoot(f)
+		if err != nil {
+			return nil, err
+		}
+		data[f.alias] = value
+	}
+	return data, nil
+}
+
+func (m *Mock) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := m.Execute(request.Query, request.Variables)
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"errors": []map[string]string{{"message": err.Error()}}})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"data": data})
+}
+
+func (m *Mock) resolveRoot(f field) (interface{}, error) {
+	if f.name == "_meta" {
+		meta := map[string]interface{}{
+			"block":             map[string]interface{}{"number": m.Block, "hash": fmt.Sprintf("0x%064x", m.Block), "timestamp": nil},
+			"hasIndexingErrors": false,
+			"deployment":        "subgraphtest",
+		}
+		return m.project(meta, f.selection), nil
+	}
+	if entities, ok := m.collections[f.name]; ok || strings.HasSuffix(f.name, "s") {
+		return m.list(entities, f)
+	}
+	entities, ok := m.collections[f.name+"s"]
+	if !ok {
+		return nil, fmt.Errorf("Type `Query` has no field `%s`", f.name)
+	}
+	id, ok := f.args["id"]
+	if !ok {
+		return nil, fmt.Errorf("missing argument `id` for field `%s`", f.name)
+	}
+	for _, entity := range entities {
+		if compare(entity["id"], id) == 0 {
+			return m.project(entity, f.selection), nil
+		}
+	}
+	return nil, nil
+}
+
+// list applies where, orderBy, orderDirection, skip and first to entities.
+func (m *Mock) list(entities []map[string]interface{}, f field) (interface{}, error) {
+	first, err := intArg(f.args, "first", defaultFirst)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := intArg(f.args, "skip", 0)
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 || first > maxFirst {
+		return nil, fmt.Errorf("The `first` argument must be between 0 and %d, but is %d", maxFirst, first)
+	}
+	if skip < 0 || skip > maxSkip {
+		return nil, fmt.Errorf("The `skip` argument must be between 0 and %d, but is %d", maxSkip, skip)
+	}
+
+	var matched []map[string]interface{}
+	where, _ := f.args["where"].(map[string]interface{})
+	for _, entity := range entities {
+		ok, err := matches(entity, where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, entity)
+		}
+	}
+
+	orderBy, _ := f.args["orderBy"].(string)
+	descending := f.args["orderDirection"] == "desc"
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := 0
+		if orderBy != "" {
+			c = compare(matched[i][orderBy], matched[j][orderBy])
+		}
+		if c == 0 {
+			c = compare(matched[i]["id"], matched[j]["id"])
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if skip > len(matched) {
+		skip = len(matched)
+	}
+	matched = matched[skip:]
+	if first < len(matched) {
+		matched = matched[:first]
+	}
+	results := make([]interface{}, len(matched))
+	for i, entity := range matched {
+		results[i] = m.project(entity, f.selection)
+	}
+	return results, nil
+}
+
+// project selects the fields of entity, resolving references.
+func (m *Mock) project(entity map[string]interface{}, selection []field) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, f := range selection {
+		value := entity[f.name]
+		if f.selection != nil && value != nil {
+			value = m.resolveNested(f, value)
+		}
+		result[f.alias] = value
+	}
+	return result
+}
+
+func (m *Mock) resolveNested(f field, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return m.project(v, f.selection)
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved[i] = m.resolveNested(f, item)
+		}
+		return resolved
+	}
+	entity := map[string]interface{}{"id": value}
+	for _, candidate := range m.collections[references[f.name]] {
+		if compare(candidate["id"], value) == 0 {
+			entity = candidate
+			break
+		}
+	}
+	return m.project(entity, f.selection)
+}
+
+var filterSuffixes = []string{"_not_in", "_not", "_gte", "_gt", "_lte", "_lt", "_in"}
+
+// matches evaluates a where filter against entity.
+func matches(entity map[string]interface{}, where map[string]interface{}) (bool, error) {
+	for key, want := range where {
+		name, op := key, ""
+		for _, suffix := range filterSuffixes {
+			if strings.HasSuffix(key, suffix) {
+				name, op = strings.TrimSuffix(key, suffix), suffix
+				break
+			}
+		}
+		got := entity[name]
+		var ok bool
+		switch op {
+		case "":
+			ok = compare(got, want) == 0
+		case "_not":
+			ok = compare(got, want) != 0
+		case "_gt":
+			ok = got != nil && compare(got, want) > 0
+		case "_gte":
+			ok = got != nil && compare(got, want) >= 0
+		case "_lt":
+			ok = got != nil && compare(got, want) < 0
+		case "_lte":
+			ok = got != nil && compare(got, want) <= 0
+		case "_in", "_not_in":
+			list, isList := want.([]interface{})
+			if !isList {
+				return false, fmt.Errorf("filter `%s` expects a list", key)
+			}
+			in := false
+			for _, item := range list {
+				if compare(got, item) == 0 {
+					in = true
+				}
+			}
+			ok = in == (op == "_in")
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+var decimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// compare orders values as graph-node does: decimal strings and numbers
+// (BigInt, BigDecimal, Int) numerically, anything else, ids included, as
+// strings. References compare by id.
+func compare(a, b interface{}) int {
+	as, bs := scalar(a), scalar(b)
+	if decimal.MatchString(as) && decimal.MatchString(bs) {
+		ar, _ := new(big.Rat).SetString(as)
+		br, _ := new(big.Rat).SetString(bs)
+		return ar.Cmp(br)
+	}
+	return strings.Compare(as, bs)
+}
+
+func scalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}:
+		return scalar(v["id"])
+	}
+	return fmt.Sprint(v)
+}
+
+func intArg(args map[string]interface{}, name string, fallback int) (int, error) {
+	v, ok := args[name]
+	if !ok {
+		return fallback, nil
+	}
+	var n int
+	if _, err := fmt.Sscan(scalar(v), &n); err != nil {
+		return 0, fmt.Errorf("argument `%s` is not an Int: %v", name, v)
+	}
+	return n, nil
+}
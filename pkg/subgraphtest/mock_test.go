@@ -0,0 +1,106 @@
+package subgraphtest
+
+import (
+	"strings"
+	"testing"
+)
+
+func testMock(t *testing.T) *Mock {
+	mock := NewMock(t)
+	mock.Add("tokens",
+		map[string]interface{}{"id": "0xdai", "symbol": "DAI"},
+		map[string]interface{}{"id": "0xweth", "symbol": "WETH"},
+	)
+	mock.Add("pairs", map[string]interface{}{"id": "0xpair", "token0": "0xdai", "token1": "0xweth", "reserveUSD": "100.5"})
+	for _, swap := range []struct{ id, timestamp, pair string }{
+		{"0x01-0", "100", "0xpair"}, {"0x02-0", "20", "0xpair"}, {"0x03-0", "100", "0xpair"}, {"0x04-0", "300", "0xother"},
+	} {
+		mock.Add("swaps", map[string]interface{}{"id": swap.id, "timestamp": swap.timestamp, "pair": swap.pair})
+	}
+	return mock
+}
+
+func ids(t *testing.T, data map[string]interface{}, field string) string {
+	t.Helper()
+	list, ok := data[field].([]interface{})
+	if !ok {
+		t.Fatalf("Expected a list for %s, got %v", field, data[field])
+	}
+	var ids []string
+	for _, entity := range list {
+		ids = append(ids, entity.(map[string]interface{})["id"].(string))
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestMockFilters(t *testing.T) {
+	mock := testMock(t)
+	for _, test := range []struct{ query, ids string }{
+		// Numeric order, not string order, with ties broken by id.
+		{`{ swaps(orderBy: timestamp) { id } }`, "0x02-0 0x01-0 0x03-0 0x04-0"},
+		{`{ swaps(orderBy: timestamp, orderDirection: desc, first: 2) { id } }`, "0x04-0 0x03-0"},
+		{`{ swaps(where: {pair: "0xpair", timestamp_gte: 100}, skip: 1) { id } }`, "0x03-0"},
+		{`{ swaps(where: {timestamp_gt: "20", timestamp_lt: 300}) { id } }`, "0x01-0 0x03-0"},
+		{`{ swaps(where: {id_gt: "0x02-0"}) { id } }`, "0x03-0 0x04-0"},
+		{`{ swaps(where: {id_in: ["0x04-0", "0x01-0"], pair_not: "0xother"}) { id } }`, "0x01-0"},
+		{`{ swaps(where: {pair_not_in: ["0xpair"]}) { id } }`, "0x04-0"},
+	} {
+		data, err := mock.Execute(test.query, nil)
+		if err != nil {
+			t.Errorf("%s failed: %v", test.query, err)
+			continue
+		}
+		if got := ids(t, data, "swaps"); got != test.ids {
+			t.Errorf("%s: expected %s, got %s", test.query, test.ids, got)
+		}
+	}
+}
+
+func TestMockPagesWithVariables(t *testing.T) {
+	mock := testMock(t)
+	var pages []string
+	last := ""
+	for i := 0; i < 5; i++ {
+		data, err := run(mock.URL, `query($first: Int!, $last: String!) {
+			swaps(first: $first, orderBy: id, where: {id_gt: $last}) { id }
+		}`, map[string]interface{}{"first": 3, "last": last})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		page := ids(t, data, "swaps")
+		if page == "" {
+			break
+		}
+		pages = append(pages, page)
+		last = page[strings.LastIndex(page, " ")+1:]
+	}
+	if strings.Join(pages, " | ") != "0x01-0 0x02-0 0x03-0 | 0x04-0" {
+		t.Errorf("Unexpected pages %v", pages)
+	}
+}
+
+func TestMockResolvesReferences(t *testing.T) {
+	mock := testMock(t)
+	data, err := mock.Execute(`{ p0: pair(id: "0xpair") { token0 { symbol } token1 { symbol } } missing: pair(id: "0xnone") { id } }`, nil)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	pair := data["p0"].(map[string]interface{})
+	if pair["token0"].(map[string]interface{})["symbol"] != "DAI" || pair["token1"].(map[string]interface{})["symbol"] != "WETH" {
+		t.Errorf("Unexpected pair %v", pair)
+	}
+	if data["missing"] != nil {
+		t.Errorf("Expected null for a missing pair, got %v", data["missing"])
+	}
+
+	for _, query := range []string{
+		`{ swaps(first: 1001) { id } }`,
+		`{ swaps(skip: 5001) { id } }`,
+		`{ factory(id: "0x") { id } }`,
+		`{ swaps { id }`,
+	} {
+		if _, err := mock.Execute(query, nil); err == nil {
+			t.Errorf("Expected %s to fail", query)
+		}
+	}
+}
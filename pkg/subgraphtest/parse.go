@@ -0,0 +1,263 @@
+package subgraphtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// field is a selected field: alias: name(args) { selection }.
+type field struct {
+	alias, name string
+	args        map[string]interface{}
+	selection   []field
+}
+
+// parser reads the subset of GraphQL the uniswap package sends: one
+// operation, optionally with variable definitions, made of fields with
+// aliases, arguments and selection sets. Fragments and directives are not
+// supported.
+type parser struct {
+	tokens    []string
+	pos       int
+	variables map[string]interface{}
+}
+
+func parseQuery(query string, variables map[string]interface{}) ([]field, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, variables: variables}
+	if p.peek() == "query" {
+		p.next()
+		if p.peek() != "(" && p.peek() != "{" {
+			p.next()
+		}
+		if p.peek() == "(" {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("syntax error: unexpected %q after the query", p.peek())
+	}
+	return fields, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *parser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("syntax error: expected %q, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *parser) skipVariableDefinitions() error {
+	for depth := 0; ; {
+		switch p.next() {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		case "":
+			return fmt.Errorf("syntax error: unterminated variable definitions")
+		}
+	}
+}
+
+func (p *parser) selectionSet() ([]field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []field
+	for p.peek() != "}" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("syntax error: unterminated selection set")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+	return fields, nil
+}
+
+func (p *parser) field() (field, error) {
+	name := p.next()
+	if !isName(name) {
+		return field{}, fmt.Errorf("syntax error: expected a field, got %q", name)
+	}
+	f := field{alias: name, name: name}
+	if p.peek() == ":" {
+		p.next()
+		f.name = p.next()
+		if !isName(f.name) {
+			return field{}, fmt.Errorf("syntax error: expected a field after %s:, got %q", f.alias, f.name)
+		}
+	}
+	if p.peek() == "(" {
+		p.next()
+		f.args = make(map[string]interface{})
+		for p.peek() != ")" {
+			name := p.next()
+			if err := p.expect(":"); err != nil {
+				return field{}, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return field{}, err
+			}
+			f.args[name] = value
+		}
+		p.next()
+	}
+	if p.peek() == "{" {
+		selection, err := p.selectionSet()
+		if err != nil {
+			return field{}, err
+		}
+		f.selection = selection
+	}
+	return f, nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	token := p.next()
+	switch {
+	case token == "$":
+		name := p.next()
+		value, ok := p.variables[name]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not provided", name)
+		}
+		return value, nil
+	case token == "[":
+		list := []interface{}{}
+		for p.peek() != "]" {
+			if p.peek() == "" {
+				return nil, fmt.Errorf("syntax error: unterminated list")
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		p.next()
+		return list, nil
+	case token == "{":
+		object := make(map[string]interface{})
+		for p.peek() != "}" {
+			name := p.next()
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			object[name] = value
+		}
+		p.next()
+		return object, nil
+	case token == "true" || token == "false":
+		return token == "true", nil
+	case token == "null":
+		return nil, nil
+	case len(token) > 0 && token[0] == '"':
+		return strconv.Unquote(token)
+	case len(token) > 0 && (token[0] == '-' || unicode.IsDigit(rune(token[0]))):
+		return json.Number(token), nil
+	case isName(token):
+		// Enum values such as orderBy: timestamp.
+		return token, nil
+	}
+	return nil, fmt.Errorf("syntax error: unexpected %q", token)
+}
+
+// tokenize splits query into punctuators, names, numbers and quoted strings,
+// dropping whitespace, commas and comments.
+func tokenize(query string) ([]string, error) {
+	var tokens []string
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || r == ',':
+			i++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("syntax error: unterminated string")
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case r == '-' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'e' || runes[j] == 'E' || runes[j] == '+' || runes[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case r == '_' || unicode.IsLetter(r):
+			j := i + 1
+			for j < len(runes) && (runes[j] == '_' || unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case strings.ContainsRune("{}()[]:!$=", r):
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			return nil, fmt.Errorf("syntax error: unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+func isName(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, r := range token {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
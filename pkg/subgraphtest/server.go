@@ -0,0 +1,234 @@
+// Package subgraphtest serves recorded subgraph responses over HTTP, so code
+// using the uniswap package can be tested without network access.
+//
+// A Server replays the fixtures of a JSON file, matching each request on its
+// query, with whitespace normalized, and its variables:
+//
+//	server := subgraphtest.NewServer(t, "testdata/queries.json")
+//	uniswap.SetRunner(uniswap.NewClient(server.URL, nil))
+//
+// To record the fixtures, run the tests with SUBGRAPHTEST_RECORD set to a live
+// endpoint. Every request is then forwarded to it and the responses are
+// written to the file when the test ends:
+//
+//	SUBGRAPHTEST_RECORD=https://gateway.thegraph.com/api/<key>/subgraphs/id/<id> go test ./pkg/uniswap
+//
+// A Mock instead evaluates queries against entities loaded from JSON, for
+// tests of pagination and filters.
+package subgraphtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/querytext"
+)
+
+// RecordEnv is the environment variable holding the endpoint to record from.
+const RecordEnv = "SUBGRAPHTEST_RECORD"
+
+// Fixture is a recorded request and the full response body, data and errors.
+type Fixture struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+	Response  json.RawMessage        `json:"response"`
+}
+
+// Server is an httptest.Server replaying or recording fixtures.
+type Server struct {
+	*httptest.Server
+
+	t        testing.TB
+	path     string
+	upstream string
+
+	mu       sync.Mutex
+	fixtures map[string]Fixture
+	recorded []Fixture
+	queries  []string
+}
+
+// NewServer starts a server for the fixtures in path, which is closed, and
+// in record mode saved, when the test ends. In replay mode a request without
+// a fixture fails the test.
+func NewServer(t testing.TB, path string) *Server {
+	t.Helper()
+	s := &Server{t: t, path: path, upstream: os.Getenv(RecordEnv), fixtures: make(map[string]Fixture)}
+	fixtures, err := ReadFixtures(path)
+	if err != nil && !(os.IsNotExist(err) && s.upstream != "") {
+		t.Fatalf("subgraphtest: %v", err)
+	}
+	for _, fixture := range fixtures {
+		s.fixtures[fixtureKey(fixture.Query, fixture.Variables)] = fixture
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(func() {
+		s.Close()
+		if err := s.save(); err != nil {
+			t.Errorf("subgraphtest: %v", err)
+		}
+	})
+	return s
+}
+
+// Add replays data, as {"data": data}, for query and variables.
+func (s *Server) Add(query string, variables map[string]interface{}, data interface{}) {
+	response, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		s.t.Fatalf("subgraphtest: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fixture := Fixture{Query: NormalizeQuery(query), Variables: variables, Response: response}
+	s.fixtures[fixtureKey(fixture.Query, variables)] = fixture
+}
+
+// Queries returns the normalized queries received, in order.
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := NormalizeQuery(request.Query)
+	key := fixtureKey(query, request.Variables)
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	fixture, ok := s.fixtures[key]
+	s.mu.Unlock()
+
+	if !ok && s.upstream != "" {
+		if fixture, err = s.record(body, query, request.Variables); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		ok = true
+	}
+	if !ok {
+		s.t.Errorf("subgraphtest: no fixture in %s for query %s with variables %v", s.path, query, request.Variables)
+		writeJSON(w, map[string]interface{}{"errors": []map[string]string{{"message": "subgraphtest: no fixture for query"}}})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(fixture.Response)
+}
+
+// record forwards body to the upstream endpoint and keeps its response.
+func (s *Server) record(body []byte, query string, variables map[string]interface{}) (Fixture, error) {
+	response, err := http.Post(s.upstream, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Fixture{}, err
+	}
+	defer response.Body.Close()
+	raw, err := io.ReadAll(response.Body)
+	if err != nil {
+		return Fixture{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return Fixture{}, fmt.Errorf("%s: %s: %s", s.upstream, response.Status, raw)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return Fixture{}, err
+	}
+	fixture := Fixture{Query: query, Variables: variables, Response: compact.Bytes()}
+	s.mu.Lock()
+	s.fixtures[fixtureKey(query, variables)] = fixture
+	s.recorded = append(s.recorded, fixture)
+	s.mu.Unlock()
+	return fixture, nil
+}
+
+// save merges the recorded fixtures into the file, sorted by query, so other
+// tests sharing it keep theirs.
+func (s *Server) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recorded) == 0 {
+		return nil
+	}
+	existing, err := ReadFixtures(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	merged := make(map[string]Fixture)
+	for _, fixture := range append(existing, s.recorded...) {
+		merged[fixtureKey(fixture.Query, fixture.Variables)] = fixture
+	}
+	fixtures := make([]Fixture, 0, len(merged))
+	for _, fixture := range merged {
+		fixtures = append(fixtures, fixture)
+	}
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtureKey(fixtures[i].Query, fixtures[i].Variables) < fixtureKey(fixtures[j].Query, fixtures[j].Variables)
+	})
+	raw, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	s.recorded = nil
+	return os.WriteFile(s.path, append(raw, '\n'), 0o644)
+}
+
+// ReadFixtures reads a fixture file written by a recording Server.
+func ReadFixtures(path string) ([]Fixture, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []Fixture
+	if err := json.Unmarshal(raw, &fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range fixtures {
+		fixtures[i].Query = NormalizeQuery(fixtures[i].Query)
+	}
+	return fixtures, nil
+}
+
+// NormalizeQuery is querytext.Normalize: queries differing only in layout
+// outside string literals match the same fixture.
+func NormalizeQuery(query string) string {
+	return querytext.Normalize(query)
+}
+
+// fixtureKey identifies a request by its normalized query and variables,
+// which encoding/json writes in key order.
+func fixtureKey(query string, variables map[string]interface{}) string {
+	if len(variables) == 0 {
+		return query
+	}
+	raw, _ := json.Marshal(variables)
+	return query + " " + string(raw)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
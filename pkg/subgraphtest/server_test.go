@@ -0,0 +1,106 @@
+package subgraphtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/machinebox/graphql"
+)
+
+// errorsTB records the errors a Server reports instead of failing the test.
+type errorsTB struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (t *errorsTB) Errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func run(url, query string, vars map[string]interface{}) (map[string]interface{}, error) {
+	request := graphql.NewRequest(query)
+	for k, v := range vars {
+		request.Var(k, v)
+	}
+	var data map[string]interface{}
+	err := graphql.NewClient(url).Run(context.Background(), request, &data)
+	return data, err
+}
+
+func TestServerMatchesQueryAndVariables(t *testing.T) {
+	t.Setenv(RecordEnv, "")
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	os.WriteFile(path, []byte("[]"), 0o644)
+	tb := &errorsTB{TB: t}
+	server := NewServer(tb, path)
+
+	server.Add(`{ pair(id: "0xa") { id } }`, nil, map[string]interface{}{"pair": map[string]interface{}{"id": "0xa"}})
+	server.Add(`query($first: Int!) { pairs(first: $first) { id } }`, map[string]interface{}{"first": 1}, map[string]interface{}{"pairs": []interface{}{}})
+
+	data, err := run(server.URL, "{\n  pair( id: \"0xa\" ) {\n    id\n  }\n}", nil)
+	if err != nil || data["pair"] == nil {
+		t.Errorf("Expected the pair, got %v, %v", data, err)
+	}
+	if _, err := run(server.URL, `query($first: Int!) { pairs(first: $first) { id } }`, map[string]interface{}{"first": 1}); err != nil {
+		t.Errorf("Expected the pairs, got %v", err)
+	}
+	if _, err := run(server.URL, `query($first: Int!) { pairs(first: $first) { id } }`, map[string]interface{}{"first": 2}); err == nil {
+		t.Errorf("Expected an error for other variables")
+	}
+	if len(tb.errors) != 1 || len(server.Queries()) != 3 {
+		t.Errorf("Expected 1 missing fixture of 3 queries, got %v", tb.errors)
+	}
+}
+
+func TestServerRecords(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"token": {"symbol": "DAI"}}}`))
+	}))
+	defer upstream.Close()
+	path := filepath.Join(t.TempDir(), "testdata", "fixtures.json")
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv(RecordEnv, upstream.URL)
+		server := NewServer(t, path)
+		if _, err := run(server.URL, `{ token(id: "0xdai") { symbol } }`, nil); err != nil {
+			t.Errorf("Record failed: %v", err)
+		}
+	})
+	upstream.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		t.Setenv(RecordEnv, "")
+		server := NewServer(t, path)
+		data, err := run(server.URL, `{ token(id: "0xdai") { symbol } }`, nil)
+		if err != nil || data["token"].(map[string]interface{})["symbol"] != "DAI" {
+			t.Errorf("Expected the recorded token, got %v, %v", data, err)
+		}
+	})
+	fixtures, err := ReadFixtures(path)
+	if err != nil || len(fixtures) != 1 || fixtures[0].Query != `{token(id:"0xdai"){symbol}}` {
+		t.Errorf("Unexpected fixtures %+v, %v", fixtures, err)
+	}
+}
+
+func TestServerKeepsStringLiterals(t *testing.T) {
+	t.Setenv(RecordEnv, "")
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	os.WriteFile(path, []byte("[]"), 0o644)
+	server := NewServer(t, path)
+	server.Add(`{ tokens(where: {symbol: "A B"}) { id } }`, nil, map[string]interface{}{"tokens": []interface{}{"one space"}})
+	server.Add(`{ tokens(where: {symbol: "A  B"}) { id } }`, nil, map[string]interface{}{"tokens": []interface{}{"two spaces"}})
+
+	data, err := run(server.URL, "{\n  tokens(where: { symbol: \"A  B\" }) {\n    id\n  }\n}", nil)
+	if err != nil || data["tokens"].([]interface{})[0] != "two spaces" {
+		t.Errorf("Expected the fixture with the same literal, got %v, %v", data, err)
+	}
+}
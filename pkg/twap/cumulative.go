@@ -0,0 +1,109 @@
+package twap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/gelhteag/onchainaggregator/pkg/ethrpc"
+)
+
+// Function selectors of the UniswapV2Pair contract.
+var (
+	selectorPrice0CumulativeLast = []byte{0x59, 0x09, 0xc0, 0xd5}
+	selectorPrice1CumulativeLast = []byte{0x5a, 0x3d, 0x54, 0x93}
+	selectorGetReserves          = []byte{0x09, 0x02, 0xf1, 0xac}
+)
+
+var (
+	q112      = new(big.Int).Lsh(big.NewInt(1), 112)
+	uint256   = new(big.Int).Lsh(big.NewInt(1), 256)
+	uint32Mod = uint64(1) << 32
+)
+
+// Cumulative is a reading of a pair's on-chain price accumulators. Price0 and
+// Price1 are UQ112x112 sums of price * seconds, counterfactually brought up
+// to Timestamp the way UniswapV2OracleLibrary.currentCumulativePrices does.
+type Cumulative struct {
+	Block     uint64
+	Timestamp uint64
+	Price0    *big.Int
+	Price1    *big.Int
+}
+
+// ReadCumulative reads price0CumulativeLast, price1CumulativeLast and
+// getReserves from pair at block (0 for latest) over JSON-RPC.
+func ReadCumulative(client *ethrpc.Client, pair string, block uint64) (*Cumulative, error) {
+	header, err := client.BlockByNumber(block)
+	if err != nil {
+		return nil, err
+	}
+	price0Data, err := client.EthCall(pair, selectorPrice0CumulativeLast, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("price0CumulativeLast: %v", err)
+	}
+	price1Data, err := client.EthCall(pair, selectorPrice1CumulativeLast, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("price1CumulativeLast: %v", err)
+	}
+	reservesData, err := client.EthCall(pair, selectorGetReserves, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("getReserves: %v", err)
+	}
+	if len(price0Data) < 32 || len(price1Data) < 32 || len(reservesData) < 96 {
+		return nil, errors.New("unexpected return data from pair contract")
+	}
+
+	cumulative := &Cumulative{
+		Block:     header.Number,
+		Timestamp: header.Timestamp,
+		Price0:    new(big.Int).SetBytes(price0Data[:32]),
+		Price1:    new(big.Int).SetBytes(price1Data[:32]),
+	}
+	reserve0 := new(big.Int).SetBytes(reservesData[0:32])
+	reserve1 := new(big.Int).SetBytes(reservesData[32:64])
+	blockTimestampLast := new(big.Int).SetBytes(reservesData[64:96]).Uint64()
+
+	// The accumulators only move on the first interaction in a block, so add
+	// the time elapsed since then at the current reserves.
+	elapsed := (header.Timestamp%uint32Mod + uint32Mod - blockTimestampLast) % uint32Mod
+	if elapsed > 0 && reserve0.Sign() > 0 && reserve1.Sign() > 0 {
+		seconds := new(big.Int).SetUint64(elapsed)
+		price0 := new(big.Int).Div(new(big.Int).Lsh(reserve1, 112), reserve0)
+		price1 := new(big.Int).Div(new(big.Int).Lsh(reserve0, 112), reserve1)
+		cumulative.Price0.Add(cumulative.Price0, price0.Mul(price0, seconds)).Mod(cumulative.Price0, uint256)
+		cumulative.Price1.Add(cumulative.Price1, price1.Mul(price1, seconds)).Mod(cumulative.Price1, uint256)
+	}
+	return cumulative, nil
+}
+
+// FromCumulative computes the TWAP between two accumulator readings of the
+// same pair. decimals0 and decimals1 are the token decimals, used to turn the
+// raw ratio into a price in whole tokens.
+func FromCumulative(first, last *Cumulative, decimals0, decimals1 int) (*Result, error) {
+	if last.Timestamp <= first.Timestamp {
+		return nil, errors.New("readings must be in increasing time order")
+	}
+	elapsed := new(big.Float).SetUint64(last.Timestamp - first.Timestamp)
+	price0 := averageFromAccumulators(first.Price0, last.Price0, elapsed)
+	price1 := averageFromAccumulators(first.Price1, last.Price1, elapsed)
+	return &Result{
+		Start:        int64(first.Timestamp),
+		End:          int64(last.Timestamp),
+		Price0:       price0 * math.Pow10(decimals0-decimals1),
+		Price1:       price1 * math.Pow10(decimals1-decimals0),
+		Observations: 2,
+	}, nil
+}
+
+// averageFromAccumulators returns (last - first) / elapsed as a plain number.
+// Accumulators are designed to overflow, so the difference is taken mod 2^256.
+func averageFromAccumulators(first, last *big.Int, elapsed *big.Float) float64 {
+	diff := new(big.Int).Sub(last, first)
+	diff.Mod(diff, uint256)
+	average := new(big.Float).Quo(new(big.Float).SetInt(diff), elapsed)
+	average.Quo(average, new(big.Float).SetInt(q112))
+	value, _ := average.Float64()
+	return value
+}
@@ -0,0 +1,91 @@
+package twap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// reserveChange is the effect of a single event on a pair's reserves.
+type reserveChange struct {
+	timestamp int64
+	delta0    float64
+	delta1    float64
+}
+
+// Reconstruct rebuilds the swap-by-swap reserve history of a pair. Starting
+// from the current reserves it walks the pair's swaps, mints and burns from
+// newest to oldest, undoing each one, and returns a snapshot of the reserves
+// left by every event in ascending time order. Events missing from the input
+// (for example older than the fetched window) are not accounted for, so the
+// snapshots are only exact back to the oldest event supplied.
+func Reconstruct(reserve0, reserve1 float64, swaps []uniswap.Swap, mints []uniswap.Mint, burns []uniswap.Burn) ([]Snapshot, error) {
+	var changes []reserveChange
+	for _, swap := range swaps {
+		timestamp, err := eventTimestamp(swap.Transaction)
+		if err != nil {
+			return nil, err
+		}
+		amounts, err := parseAmounts(swap.Amount0In, swap.Amount0Out, swap.Amount1In, swap.Amount1Out)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, reserveChange{timestamp: timestamp, delta0: amounts[0] - amounts[1], delta1: amounts[2] - amounts[3]})
+	}
+	for _, mint := range mints {
+		timestamp, err := eventTimestamp(mint.Transaction)
+		if err != nil {
+			return nil, err
+		}
+		amounts, err := parseAmounts(mint.Amount0, mint.Amount1)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, reserveChange{timestamp: timestamp, delta0: amounts[0], delta1: amounts[1]})
+	}
+	for _, burn := range burns {
+		timestamp, err := eventTimestamp(burn.Transaction)
+		if err != nil {
+			return nil, err
+		}
+		amounts, err := parseAmounts(burn.Amount0, burn.Amount1)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, reserveChange{timestamp: timestamp, delta0: -amounts[0], delta1: -amounts[1]})
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].timestamp > changes[j].timestamp })
+
+	snapshots := make([]Snapshot, len(changes))
+	for i, change := range changes {
+		snapshots[len(changes)-1-i] = Snapshot{Timestamp: change.timestamp, Reserve0: reserve0, Reserve1: reserve1}
+		reserve0 -= change.delta0
+		reserve1 -= change.delta1
+	}
+	return snapshots, nil
+}
+
+func eventTimestamp(transaction *uniswap.Transaction) (int64, error) {
+	if transaction == nil {
+		return 0, fmt.Errorf("event without transaction")
+	}
+	timestamp, err := strconv.ParseInt(transaction.Timestamp, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("transaction %s: invalid timestamp: %v", transaction.ID, err)
+	}
+	return timestamp, nil
+}
+
+func parseAmounts(values ...string) ([]float64, error) {
+	amounts := make([]float64, len(values))
+	for i, value := range values {
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q: %v", value, err)
+		}
+		amounts[i] = amount
+	}
+	return amounts, nil
+}
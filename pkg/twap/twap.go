@@ -0,0 +1,223 @@
+package twap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+const (
+	hour = 3600
+	day  = 86400
+)
+
+// ErrNoData is returned when no snapshot overlaps the requested window.
+var ErrNoData = errors.New("no reserve data in window")
+
+// Snapshot holds the reserves of a pair from Timestamp until the next snapshot.
+type Snapshot struct {
+	Timestamp int64
+	Reserve0  float64
+	Reserve1  float64
+}
+
+// Result is a time-weighted average price over [Start, End].
+type Result struct {
+	// Start is the beginning of the covered window. It is later than the
+	// requested start when no snapshot precedes it.
+	Start int64
+	End   int64
+	// Price0 is the average price of token0 in units of token1 and Price1 the
+	// average price of token1 in units of token0. As with Uniswap's own
+	// accumulators, Price1 is not simply 1/Price0.
+	Price0       float64
+	Price1       float64
+	Observations int
+}
+
+// Compute returns the TWAP over [start, end] of the step function defined by
+// the snapshots: each snapshot's reserves hold until the next one.
+func Compute(snapshots []Snapshot, start, end int64) (*Result, error) {
+	if end <= start {
+		return nil, errors.New("end must be after start")
+	}
+	sorted := append([]Snapshot(nil), snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	result := &Result{Start: -1, End: end}
+	var weighted0, weighted1 float64
+	for i, snapshot := range sorted {
+		from := snapshot.Timestamp
+		if from < start {
+			from = start
+		}
+		to := end
+		if i+1 < len(sorted) && sorted[i+1].Timestamp < to {
+			to = sorted[i+1].Timestamp
+		}
+		if to <= from {
+			continue
+		}
+		if snapshot.Reserve0 <= 0 || snapshot.Reserve1 <= 0 {
+			return nil, fmt.Errorf("snapshot at %d has empty reserves", snapshot.Timestamp)
+		}
+		if result.Start < 0 {
+			result.Start = from
+		}
+		elapsed := float64(to - from)
+		weighted0 += snapshot.Reserve1 / snapshot.Reserve0 * elapsed
+		weighted1 += snapshot.Reserve0 / snapshot.Reserve1 * elapsed
+		result.Observations++
+	}
+	if result.Observations == 0 {
+		return nil, ErrNoData
+	}
+	covered := float64(result.End - result.Start)
+	result.Price0 = weighted0 / covered
+	result.Price1 = weighted1 / covered
+	return result, nil
+}
+
+// FromHourData converts hourly pair data into snapshots. The subgraph stores
+// the reserves left by the last event of the hour, so they take effect at
+// the end of the hour.
+func FromHourData(data []uniswap.PairHourData) ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0, len(data))
+	for _, hourData := range data {
+		snapshot, err := newSnapshot(int64(hourData.HourStartUnix)+hour, hourData.Reserve0, hourData.Reserve1)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// FromDayData converts daily pair data into snapshots taking effect at the end of each day.
+func FromDayData(data []uniswap.PairDailyAggregated) ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0, len(data))
+	for _, dayData := range data {
+		snapshot, err := newSnapshot(int64(dayData.Date)+day, dayData.Reserve0, dayData.Reserve1)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func newSnapshot(timestamp int64, reserve0, reserve1 string) (Snapshot, error) {
+	r0, err := strconv.ParseFloat(reserve0, 64)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("invalid reserve0 at %d: %v", timestamp, err)
+	}
+	r1, err := strconv.ParseFloat(reserve1, 64)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("invalid reserve1 at %d: %v", timestamp, err)
+	}
+	return Snapshot{Timestamp: timestamp, Reserve0: r0, Reserve1: r1}, nil
+}
+
+// HourlyTWAP fetches the hourly snapshots of pairID covering [start, end]
+// and computes the TWAP over that window.
+func HourlyTWAP(pairID string, start, end int64) (*Result, error) {
+	var data []uniswap.PairHourData
+	// The last hour closing before start sets the price at the start of the window.
+	previous, err := uniswap.QueryPairHourData(map[string]interface{}{
+		"first":          1,
+		"orderBy":        "hourStartUnix",
+		"orderDirection": "desc",
+		"where": map[string]interface{}{
+			"pair":              pairID,
+			"hourStartUnix_lte": start - hour,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		data = append(data, *previous...)
+	}
+	cursor := start - hour
+	for {
+		page, err := uniswap.QueryPairHourData(map[string]interface{}{
+			"first":          1000,
+			"orderBy":        "hourStartUnix",
+			"orderDirection": "asc",
+			"where": map[string]interface{}{
+				"pair":             pairID,
+				"hourStartUnix_gt": cursor,
+				"hourStartUnix_lt": end,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if page == nil || len(*page) == 0 {
+			break
+		}
+		data = append(data, *page...)
+		cursor = int64((*page)[len(*page)-1].HourStartUnix)
+		if len(*page) < 1000 {
+			break
+		}
+	}
+	snapshots, err := FromHourData(data)
+	if err != nil {
+		return nil, err
+	}
+	return Compute(snapshots, start, end)
+}
+
+// DailyTWAP fetches the daily snapshots of pairID covering [start, end]
+// and computes the TWAP over that window.
+func DailyTWAP(pairID string, start, end int64) (*Result, error) {
+	var data []uniswap.PairDailyAggregated
+	previous, err := uniswap.QueryPairDailyAggregated(map[string]interface{}{
+		"first":          1,
+		"orderBy":        "date",
+		"orderDirection": "desc",
+		"where": map[string]interface{}{
+			"pairAddress": pairID,
+			"date_lte":    start - day,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		data = append(data, *previous...)
+	}
+	cursor := start - day
+	for {
+		page, err := uniswap.QueryPairDailyAggregated(map[string]interface{}{
+			"first":          1000,
+			"orderBy":        "date",
+			"orderDirection": "asc",
+			"where": map[string]interface{}{
+				"pairAddress": pairID,
+				"date_gt":     cursor,
+				"date_lt":     end,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if page == nil || len(*page) == 0 {
+			break
+		}
+		data = append(data, *page...)
+		cursor = int64((*page)[len(*page)-1].Date)
+		if len(*page) < 1000 {
+			break
+		}
+	}
+	snapshots, err := FromDayData(data)
+	if err != nil {
+		return nil, err
+	}
+	return Compute(snapshots, start, end)
+}
@@ -0,0 +1,266 @@
+package twap
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gelhteag/onchainaggregator/pkg/ethrpc"
+	"github.com/gelhteag/onchainaggregator/pkg/subgraphtest"
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+func loadFixture(t *testing.T, name string, v interface{}) {
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Error reading fixture: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Error decoding fixture: %v", err)
+	}
+}
+
+func TestComputeFromHourData(t *testing.T) {
+	var hours []uniswap.PairHourData
+	loadFixture(t, "pair_hour_datas.json", &hours)
+	snapshots, err := FromHourData(hours)
+	if err != nil {
+		t.Fatalf("FromHourData failed: %v", err)
+	}
+
+	// Hours close at 2000, 2100 and 1900, each holding for one hour of the window.
+	start := int64(1679997600 + hour)
+	result, err := Compute(snapshots, start, start+3*hour)
+	if err != nil {
+		t.Fatalf("Compute failed: %v", err)
+	}
+	if math.Abs(result.Price0-2000) > 1e-9 {
+		t.Errorf("Expected TWAP 2000 but got %f", result.Price0)
+	}
+	if result.Observations != 3 {
+		t.Errorf("Expected 3 observations but got %d", result.Observations)
+	}
+	if result.Price1 <= 1/2100.0 || result.Price1 >= 1/1900.0 {
+		t.Errorf("Unexpected token1 TWAP %f", result.Price1)
+	}
+}
+
+func TestComputeShrinksWindowWithoutPriorSnapshot(t *testing.T) {
+	snapshots := []Snapshot{{Timestamp: 100, Reserve0: 1, Reserve1: 3}}
+	result, err := Compute(snapshots, 0, 200)
+	if err != nil {
+		t.Fatalf("Compute failed: %v", err)
+	}
+	if result.Start != 100 || result.Price0 != 3 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if _, err := Compute(snapshots, 300, 200); err == nil {
+		t.Error("Expected an error for an inverted window")
+	}
+	if _, err := Compute(nil, 0, 200); err != ErrNoData {
+		t.Errorf("Expected ErrNoData, got %v", err)
+	}
+}
+
+func TestReconstructFromSwaps(t *testing.T) {
+	var swaps []uniswap.Swap
+	loadFixture(t, "swaps.json", &swaps)
+
+	snapshots, err := Reconstruct(1000, 2000000, swaps, nil, nil)
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots but got %d", len(snapshots))
+	}
+	if snapshots[1].Timestamp != 1680000200 || snapshots[1].Reserve0 != 1000 || snapshots[1].Reserve1 != 2000000 {
+		t.Errorf("Latest snapshot must equal current reserves, got %+v", snapshots[1])
+	}
+	if snapshots[0].Timestamp != 1680000100 || math.Abs(snapshots[0].Reserve0-1009.9) > 1e-9 || snapshots[0].Reserve1 != 1980000 {
+		t.Errorf("Unexpected reserves after first swap: %+v", snapshots[0])
+	}
+}
+
+func word(v *big.Int) string {
+	return hex.EncodeToString(v.FillBytes(make([]byte, 32)))
+}
+
+// fakeNode serves two blocks of a pair whose price stays at 2000 (token0 18
+// decimals, token1 6 decimals) for the whole window.
+func fakeNode(t *testing.T) *httptest.Server {
+	reserve0, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	reserve1 := big.NewInt(2000000000000)
+	fraction0 := new(big.Int).Div(new(big.Int).Lsh(reserve1, 112), reserve0)
+	fraction1 := new(big.Int).Div(new(big.Int).Lsh(reserve0, 112), reserve1)
+
+	type state struct {
+		timestamp, last int64
+		price0, price1  *big.Int
+	}
+	blocks := map[string]state{
+		"0x64": {timestamp: 1000, last: 1000, price0: big.NewInt(0), price1: big.NewInt(0)},
+		"0xc8": {
+			timestamp: 1600,
+			last:      1500,
+			price0:    new(big.Int).Mul(fraction0, big.NewInt(500)),
+			price1:    new(big.Int).Mul(fraction1, big.NewInt(500)),
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int               `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Bad request: %v", err)
+			return
+		}
+		var result interface{}
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			var tag string
+			json.Unmarshal(req.Params[0], &tag)
+			result = map[string]string{
+				"number":    tag,
+				"hash":      "0xhash" + tag,
+				"timestamp": "0x" + strconv.FormatInt(blocks[tag].timestamp, 16),
+			}
+		case "eth_call":
+			var call map[string]string
+			var tag string
+			json.Unmarshal(req.Params[0], &call)
+			json.Unmarshal(req.Params[1], &tag)
+			block := blocks[tag]
+			switch call["data"] {
+			case "0x5909c0d5":
+				result = "0x" + word(block.price0)
+			case "0x5a3d5493":
+				result = "0x" + word(block.price1)
+			case "0x0902f1ac":
+				result = "0x" + word(reserve0) + word(reserve1) + word(big.NewInt(block.last))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+func TestFromCumulativeOverJSONRPC(t *testing.T) {
+	server := fakeNode(t)
+	defer server.Close()
+	client := ethrpc.NewClient(server.URL)
+
+	first, err := ReadCumulative(client, "0xpair", 100)
+	if err != nil {
+		t.Fatalf("ReadCumulative failed: %v", err)
+	}
+	last, err := ReadCumulative(client, "0xpair", 200)
+	if err != nil {
+		t.Fatalf("ReadCumulative failed: %v", err)
+	}
+	result, err := FromCumulative(first, last, 18, 6)
+	if err != nil {
+		t.Fatalf("FromCumulative failed: %v", err)
+	}
+	if result.Start != 1000 || result.End != 1600 {
+		t.Errorf("Unexpected window %d-%d", result.Start, result.End)
+	}
+	if math.Abs(result.Price0-2000) > 1e-6 {
+		t.Errorf("Expected TWAP 2000 but got %f", result.Price0)
+	}
+	if math.Abs(result.Price1-0.0005) > 1e-12 {
+		t.Errorf("Expected TWAP 0.0005 but got %g", result.Price1)
+	}
+}
+
+type failingRunner struct{}
+
+func (failingRunner) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	return nil, errors.New("subgraph unavailable")
+}
+
+func TestDailyTWAPReturnsQueryErrors(t *testing.T) {
+	previous := uniswap.DefaultRunner()
+	uniswap.SetRunner(failingRunner{})
+	defer uniswap.SetRunner(previous)
+	if _, err := DailyTWAP("0xpair", 1680000000, 1680600000); err == nil {
+		t.Error("Expected the query error")
+	}
+}
+
+// useMock points the default runner at a mock subgraph for the rest of the test.
+func useMock(t *testing.T) *subgraphtest.Mock {
+	mock := subgraphtest.NewMock(t)
+	previous := uniswap.DefaultRunner()
+	uniswap.SetRunner(uniswap.NewClient(mock.URL, nil))
+	t.Cleanup(func() { uniswap.SetRunner(previous) })
+	return mock
+}
+
+// rising returns snapshots of a price rising by 1 each period, from 1000.
+func rising(base, period int64, n int) []Snapshot {
+	snapshots := make([]Snapshot, n)
+	for i := range snapshots {
+		snapshots[i] = Snapshot{Timestamp: base + int64(i+1)*period, Reserve0: 1, Reserve1: float64(1000 + i)}
+	}
+	return snapshots
+}
+
+func expectResult(t *testing.T, got *Result, err error, snapshots []Snapshot, start, end int64) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("TWAP failed: %v", err)
+	}
+	expected, _ := Compute(snapshots, start, end)
+	if got.Start != expected.Start || got.Observations != expected.Observations || math.Abs(got.Price0-expected.Price0) > 1e-9 {
+		t.Errorf("Unexpected result %+v, expected %+v", got, expected)
+	}
+}
+
+func TestHourlyTWAPPagesThroughMock(t *testing.T) {
+	mock := useMock(t)
+	const base, n = 1680000000, 2500
+	for i := 0; i < n; i++ {
+		mock.Add("pairHourDatas", map[string]interface{}{
+			"id": fmt.Sprintf("0xpair-%d", i), "pair": "0xpair", "hourStartUnix": base + i*hour,
+			"reserve0": "1", "reserve1": strconv.Itoa(1000 + i), "reserveUSD": "0",
+		})
+	}
+	mock.Add("pairHourDatas", map[string]interface{}{"id": "0xother-0", "pair": "0xother", "hourStartUnix": base + 20*hour, "reserve0": "1", "reserve1": "1"})
+
+	start, end := int64(base+10*hour+1800), int64(base+2400*hour)
+	result, err := HourlyTWAP("0xpair", start, end)
+	expectResult(t, result, err, rising(base, hour, n), start, end)
+	// The hour before start, then pages of 1000, 1000 and 390 hours.
+	if queries := len(mock.Queries()); queries != 4 {
+		t.Errorf("Expected 4 queries, got %d", queries)
+	}
+}
+
+func TestDailyTWAPPagesThroughMock(t *testing.T) {
+	mock := useMock(t)
+	const base, n = 1600000000 - 1600000000%day, 1200
+	for i := 0; i < n; i++ {
+		mock.Add("pairDayDatas", map[string]interface{}{
+			"id": fmt.Sprintf("0xpair-%d", i), "pairAddress": "0xpair", "date": base + i*day,
+			"reserve0": "1", "reserve1": strconv.Itoa(1000 + i), "reserveUSD": "0",
+		})
+	}
+
+	start, end := int64(base+5*day), int64(base+1100*day)
+	result, err := DailyTWAP("0xpair", start, end)
+	expectResult(t, result, err, rising(base, day, n), start, end)
+	if queries := len(mock.Queries()); queries != 3 {
+		t.Errorf("Expected 3 queries, got %d", queries)
+	}
+}
@@ -0,0 +1,51 @@
+package uniswap
+
+import "errors"
+
+// Uniswap V2 charges a 0.3% fee on the input amount of every swap.
+const (
+	FeeNumerator   = 997
+	FeeDenominator = 1000
+)
+
+// ErrInsufficientLiquidity is returned when a pool cannot fill the requested amount.
+var ErrInsufficientLiquidity = errors.New("insufficient liquidity")
+
+// GetAmountOut simulates a swap on a constant-product pool and returns the
+// amount of the output token received for amountIn, fees included.
+// It mirrors UniswapV2Library.getAmountOut with decimal-adjusted reserves.
+func GetAmountOut(amountIn, reserveIn, reserveOut float64) (float64, error) {
+	if amountIn <= 0 {
+		return 0, errors.New("amountIn must be positive")
+	}
+	if reserveIn <= 0 || reserveOut <= 0 {
+		return 0, ErrInsufficientLiquidity
+	}
+	amountInWithFee := amountIn * FeeNumerator
+	numerator := amountInWithFee * reserveOut
+	denominator := reserveIn*FeeDenominator + amountInWithFee
+	return numerator / denominator, nil
+}
+
+// GetAmountIn returns the input amount required to receive amountOut from a
+// constant-product pool, fees included. It mirrors UniswapV2Library.getAmountIn.
+func GetAmountIn(amountOut, reserveIn, reserveOut float64) (float64, error) {
+	if amountOut <= 0 {
+		return 0, errors.New("amountOut must be positive")
+	}
+	if reserveIn <= 0 || reserveOut <= 0 || amountOut >= reserveOut {
+		return 0, ErrInsufficientLiquidity
+	}
+	numerator := reserveIn * amountOut * FeeDenominator
+	denominator := (reserveOut - amountOut) * FeeNumerator
+	return numerator / denominator, nil
+}
+
+// SpotPrice returns the marginal price of the input token in units of the
+// output token, ignoring fees and price impact.
+func SpotPrice(reserveIn, reserveOut float64) float64 {
+	if reserveIn <= 0 {
+		return 0
+	}
+	return reserveOut / reserveIn
+}
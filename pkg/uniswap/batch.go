@@ -0,0 +1,331 @@
+package uniswap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lookup is a single-entity query, e.g. pair(id: "0x...") selecting the
+// graphql fields of Fields.
+type Lookup struct {
+	Entity string
+	ID     string
+	Fields interface{}
+}
+
+func (l Lookup) key() string {
+	return l.Entity + "|" + l.ID + "|" + BuildFields(l.Fields)
+}
+
+var graphqlName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// validate checks that l can be written into a query.
+func (l Lookup) validate() error {
+	if !graphqlName.MatchString(l.Entity) {
+		return fmt.Errorf("invalid lookup entity %q", l.Entity)
+	}
+	if l.ID == "" || strings.ContainsAny(l.ID, `"\`) {
+		return fmt.Errorf("invalid %s id %q", l.Entity, l.ID)
+	}
+	if l.Fields == nil || entityType(reflect.TypeOf(l.Fields)).Kind() != reflect.Struct {
+		return fmt.Errorf("%s %s: Fields must be a struct, got %T", l.Entity, l.ID, l.Fields)
+	}
+	return nil
+}
+
+// defaultListSize is how many entities graph-node returns for a list field
+// without first, which Complexity counts list fields as.
+const defaultListSize = 100
+
+// Complexity estimates the cost of selecting the fields of obj: one per field,
+// nested fields included, with list fields counted defaultListSize times.
+func Complexity(obj interface{}) int {
+	return complexityOfType(reflect.TypeOf(obj))
+}
+
+func complexityOfType(t reflect.Type) int {
+	t = entityType(t)
+	cost := 0
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("graphql") == "" {
+			continue
+		}
+		fieldCost := 1
+		if entityType(field.Type).Kind() == reflect.Struct {
+			fieldCost += complexityOfType(field.Type)
+		}
+		if field.Type.Kind() == reflect.Slice {
+			fieldCost *= defaultListSize
+		}
+		cost += fieldCost
+	}
+	return cost
+}
+
+// Batch merges lookups into as few queries as MaxComplexity allows, each
+// lookup under its own alias:
+//
+//	{ p0: pair(id: "0x..."){ id ... } p1: pair(id: "0x..."){ id ... } }
+type Batch struct {
+	// Runner defaults to the runner set with SetRunner.
+	Runner Runner
+	// MaxComplexity is the Complexity budget of one query. A lookup over
+	// budget on its own is sent alone.
+	MaxComplexity int
+}
+
+func NewBatch() *Batch {
+	return &Batch{MaxComplexity: 1000}
+}
+
+// Run returns the data of each lookup, in order, or nil for entities that do
+// not exist. Identical lookups are queried once.
+func (b *Batch) Run(ctx context.Context, lookups []Lookup) ([]map[string]interface{}, error) {
+	for _, lookup := range lookups {
+		if err := lookup.validate(); err != nil {
+			return nil, err
+		}
+	}
+	runner := b.Runner
+	if runner == nil {
+		runner = DefaultRunner()
+	}
+	byKey := make(map[string]map[string]interface{})
+	var unique []Lookup
+	for _, lookup := range lookups {
+		if _, ok := byKey[lookup.key()]; !ok {
+			byKey[lookup.key()] = nil
+			unique = append(unique, lookup)
+		}
+	}
+
+	for _, chunk := range b.split(unique) {
+		var query strings.Builder
+		query.WriteString("{ ")
+		for i, lookup := range chunk {
+			fmt.Fprintf(&query, `%s: %s(id: "%s"){ %s } `, alias(lookup, i), lookup.Entity, lookup.ID, BuildFields(lookup.Fields))
+		}
+		query.WriteString("}")
+		response, err := runner.Run(ctx, query.String())
+		if err != nil {
+			return nil, err
+		}
+		for i, lookup := range chunk {
+			data, _ := response[alias(lookup, i)].(map[string]interface{})
+			byKey[lookup.key()] = data
+		}
+	}
+
+	results := make([]map[string]interface{}, len(lookups))
+	for i, lookup := range lookups {
+		results[i] = byKey[lookup.key()]
+	}
+	return results, nil
+}
+
+// split groups lookups into queries within MaxComplexity.
+func (b *Batch) split(lookups []Lookup) [][]Lookup {
+	var chunks [][]Lookup
+	var chunk []Lookup
+	cost := 0
+	for _, lookup := range lookups {
+		lookupCost := 1 + Complexity(lookup.Fields)
+		if len(chunk) > 0 && b.MaxComplexity > 0 && cost+lookupCost > b.MaxComplexity {
+			chunks = append(chunks, chunk)
+			chunk, cost = nil, 0
+		}
+		chunk = append(chunk, lookup)
+		cost += lookupCost
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// alias names the i-th lookup of a query after its entity: p0, p1, t2, ...
+func alias(lookup Lookup, i int) string {
+	return fmt.Sprintf("%s%d", lookup.Entity[:1], i)
+}
+
+// decodeLookup unmarshals the data of a lookup into obj.
+func decodeLookup(data map[string]interface{}, obj interface{}) error {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(dataJSON, obj)
+}
+
+// QueryPairOverviews is QueryPairOverview for many pairs in batched queries.
+// Pairs that do not exist are left out of the map.
+func QueryPairOverviews(pairIDs []string) (map[string]*PairData, error) {
+	lookups := make([]Lookup, len(pairIDs))
+	for i, id := range pairIDs {
+		lookups[i] = Lookup{Entity: "pair", ID: id, Fields: &PairData{}}
+	}
+	results, err := NewBatch().Run(context.Background(), lookups)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]*PairData)
+	for i, data := range results {
+		if data == nil {
+			continue
+		}
+		var pair *PairData
+		if err := decodeLookup(data, &pair); err != nil {
+			return nil, err
+		}
+		pairs[pairIDs[i]] = pair
+	}
+	return pairs, nil
+}
+
+// QueryTokenOverviews is QueryTokenOverview for many tokens in batched
+// queries. Tokens that do not exist are left out of the map.
+func QueryTokenOverviews(tokenIDs []string) (map[string]*TokenOverview, error) {
+	lookups := make([]Lookup, len(tokenIDs))
+	for i, id := range tokenIDs {
+		lookups[i] = Lookup{Entity: "token", ID: id, Fields: &TokenOverview{}}
+	}
+	results, err := NewBatch().Run(context.Background(), lookups)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]*TokenOverview)
+	for i, data := range results {
+		if data == nil {
+			continue
+		}
+		var token *TokenOverview
+		if err := decodeLookup(data, &token); err != nil {
+			return nil, err
+		}
+		tokens[tokenIDs[i]] = token
+	}
+	return tokens, nil
+}
+
+// Loader coalesces the lookups of concurrent goroutines: lookups made within
+// Wait of each other are sent as one Batch, or sooner once MaxLookups are
+// pending.
+type Loader struct {
+	Batch      *Batch
+	Wait       time.Duration
+	MaxLookups int
+
+	mu      sync.Mutex
+	pending []*load
+	timer   *time.Timer
+}
+
+type load struct {
+	ctx    context.Context
+	lookup Lookup
+	done   chan struct{}
+	data   map[string]interface{}
+	err    error
+}
+
+func NewLoader(batch *Batch) *Loader {
+	return &Loader{Batch: batch, Wait: 2 * time.Millisecond, MaxLookups: 200}
+}
+
+// Load returns the data of lookup, nil if the entity does not exist.
+func (l *Loader) Load(ctx context.Context, lookup Lookup) (map[string]interface{}, error) {
+	if err := lookup.validate(); err != nil {
+		return nil, err
+	}
+	request := &load{ctx: ctx, lookup: lookup, done: make(chan struct{})}
+	l.mu.Lock()
+	l.pending = append(l.pending, request)
+	if l.MaxLookups > 0 && len(l.pending) >= l.MaxLookups {
+		l.dispatchLocked()
+	} else if l.timer == nil {
+		l.timer = time.AfterFunc(l.Wait, l.dispatch)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-request.done:
+		return request.data, request.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// LoadPairOverview is QueryPairOverview through the loader.
+func (l *Loader) LoadPairOverview(ctx context.Context, pairID string) (*PairData, error) {
+	data, err := l.Load(ctx, Lookup{Entity: "pair", ID: pairID, Fields: &PairData{}})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var pair *PairData
+	return pair, decodeLookup(data, &pair)
+}
+
+// LoadTokenOverview is QueryTokenOverview through the loader.
+func (l *Loader) LoadTokenOverview(ctx context.Context, tokenID string) (*TokenOverview, error) {
+	data, err := l.Load(ctx, Lookup{Entity: "token", ID: tokenID, Fields: &TokenOverview{}})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var token *TokenOverview
+	return token, decodeLookup(data, &token)
+}
+
+func (l *Loader) dispatch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dispatchLocked()
+}
+
+// dispatchLocked sends the pending lookups; l.mu must be held. The batch
+// shares the lookups of several callers, so its query is only canceled once
+// the contexts of all of them are done.
+func (l *Loader) dispatchLocked() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	requests := l.pending
+	l.pending = nil
+	if len(requests) == 0 {
+		return
+	}
+	go func() {
+		lookups := make([]Lookup, len(requests))
+		for i, request := range requests {
+			lookups[i] = request.lookup
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			for _, request := range requests {
+				select {
+				case <-request.ctx.Done():
+				case <-ctx.Done():
+					return
+				}
+			}
+			cancel()
+		}()
+		results, err := l.Batch.Run(ctx, lookups)
+		cancel()
+		for i, request := range requests {
+			if err != nil {
+				request.err = err
+			} else {
+				request.data = results[i]
+			}
+			close(request.done)
+		}
+	}()
+}
@@ -0,0 +1,195 @@
+package uniswap
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var aliasedLookup = regexp.MustCompile(`(\w+): (\w+)\(id: "([^"]+)"\)`)
+
+// aliasEndpoint answers every aliased lookup with the entity's id, except for
+// ids starting with "missing".
+type aliasEndpoint struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (e *aliasEndpoint) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	e.mu.Lock()
+	e.queries = append(e.queries, query)
+	e.mu.Unlock()
+	data := make(map[string]interface{})
+	for _, match := range aliasedLookup.FindAllStringSubmatch(query, -1) {
+		if match[3][:1] == "m" {
+			data[match[1]] = nil
+			continue
+		}
+		data[match[1]] = map[string]interface{}{"id": match[3], "name": match[2] + " " + match[3]}
+	}
+	return data, nil
+}
+
+func TestBatch(t *testing.T) {
+	endpoint := &aliasEndpoint{}
+	batch := NewBatch()
+	batch.Runner = endpoint
+	batch.MaxComplexity = 3 * (1 + Complexity(&PairData{}))
+
+	var lookups []Lookup
+	for _, id := range []string{"0x1", "0x2", "0x1", "missing", "0x3", "0x4"} {
+		lookups = append(lookups, Lookup{Entity: "pair", ID: id, Fields: &PairData{}})
+	}
+	results, err := batch.Run(context.Background(), lookups)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(endpoint.queries) != 2 {
+		t.Errorf("Expected 5 unique lookups in 2 queries, got %d", len(endpoint.queries))
+	}
+	for i, lookup := range lookups {
+		if lookup.ID == "missing" {
+			if results[i] != nil {
+				t.Errorf("Expected nil for a missing pair, got %v", results[i])
+			}
+			continue
+		}
+		if results[i]["id"] != lookup.ID {
+			t.Errorf("Unexpected result %v for %s", results[i], lookup.ID)
+		}
+	}
+}
+
+func TestBatchRejectsInvalidLookups(t *testing.T) {
+	endpoint := &aliasEndpoint{}
+	batch := NewBatch()
+	batch.Runner = endpoint
+	for _, lookup := range []Lookup{
+		{ID: "0x1", Fields: &PairData{}},
+		{Entity: "pair", Fields: &PairData{}},
+		{Entity: "pair", ID: `0x1") { id } evil: pair(id: "0x2`, Fields: &PairData{}},
+		{Entity: "pair", ID: "0x1"},
+	} {
+		if _, err := batch.Run(context.Background(), []Lookup{lookup}); err == nil {
+			t.Errorf("Expected an error for %+v", lookup)
+		}
+	}
+	if _, err := NewLoader(batch).Load(context.Background(), Lookup{ID: "0x1", Fields: &PairData{}}); err == nil {
+		t.Error("Expected the loader to reject the lookup")
+	}
+	if len(endpoint.queries) != 0 {
+		t.Errorf("Expected no queries, got %v", endpoint.queries)
+	}
+}
+
+func TestComplexity(t *testing.T) {
+	// id, token0 { 4 fields }, token1 { 4 fields }, 5 scalars.
+	if complexity := Complexity(&PairData{}); complexity != 16 {
+		t.Errorf("Unexpected PairData complexity %d", complexity)
+	}
+	if complexity := Complexity(&TokenTransactions{}); complexity < 3*defaultListSize {
+		t.Errorf("Expected list fields to dominate, got %d", complexity)
+	}
+}
+
+func TestQueryTokenOverviews(t *testing.T) {
+	endpoint := &aliasEndpoint{}
+	previous := DefaultRunner()
+	SetRunner(endpoint)
+	defer SetRunner(previous)
+
+	tokens, err := QueryTokenOverviews([]string{"0xa", "missing", "0xb"})
+	if err != nil {
+		t.Fatalf("QueryTokenOverviews failed: %v", err)
+	}
+	if len(tokens) != 2 || tokens["0xb"].Name != "token 0xb" || len(endpoint.queries) != 1 {
+		t.Errorf("Unexpected tokens %+v after %d queries", tokens, len(endpoint.queries))
+	}
+}
+
+func TestLoader(t *testing.T) {
+	endpoint := &aliasEndpoint{}
+	batch := NewBatch()
+	batch.Runner = endpoint
+	loader := NewLoader(batch)
+	loader.MaxLookups = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			pair, err := loader.LoadPairOverview(context.Background(), id)
+			if err == nil && pair.ID != id {
+				err = fmt.Errorf("expected %s, got %+v", id, pair)
+			}
+			errs <- err
+		}(fmt.Sprintf("0x%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("LoadPairOverview failed: %v", err)
+		}
+	}
+	if len(endpoint.queries) > 3 {
+		t.Errorf("Expected the loads to be coalesced, got %d queries", len(endpoint.queries))
+	}
+
+	if pair, err := loader.LoadPairOverview(context.Background(), "missing"); pair != nil || err != nil {
+		t.Errorf("Expected no pair, got %+v, %v", pair, err)
+	}
+}
+
+// blockingEndpoint blocks every query until its context is canceled.
+type blockingEndpoint struct {
+	started, canceled chan struct{}
+}
+
+func (e *blockingEndpoint) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	close(e.started)
+	<-ctx.Done()
+	close(e.canceled)
+	return nil, ctx.Err()
+}
+
+func TestLoaderCancelsOnceAllCallersAreDone(t *testing.T) {
+	endpoint := &blockingEndpoint{started: make(chan struct{}), canceled: make(chan struct{})}
+	loader := NewLoader(&Batch{Runner: endpoint})
+	loader.Wait = time.Hour
+	loader.MaxLookups = 2
+
+	var cancels []context.CancelFunc
+	errs := make(chan error, 2)
+	for _, id := range []string{"0x1", "0x2"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		go func(id string) {
+			_, err := loader.LoadPairOverview(ctx, id)
+			errs <- err
+		}(id)
+	}
+	<-endpoint.started
+
+	cancels[0]()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected the first caller canceled, got %v", err)
+	}
+	select {
+	case <-endpoint.canceled:
+		t.Fatal("Expected the query to go on for the second caller")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancels[1]()
+	<-errs
+	select {
+	case <-endpoint.canceled:
+	case <-time.After(time.Second):
+		t.Error("Expected the query canceled once both callers are done")
+	}
+}
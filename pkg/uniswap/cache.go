@@ -0,0 +1,260 @@
+package uniswap
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/querytext"
+)
+
+// CacheEntry is a cached response. Data is the JSON of the response data so
+// every hit decodes a fresh copy. A zero Expires never expires.
+type CacheEntry struct {
+	Data    []byte    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+func (e CacheEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// Cache stores responses by key for a CachingRunner.
+type Cache interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry) error
+}
+
+// CachingRunner answers repeated queries from a Cache. Queries pinned to a
+// block hash (block: {hash: "0x..."}) or to a block number at least
+// Confirmations below the head can no longer change and are cached forever.
+// Other queries, pinned near the head or reading the latest block, are cached
+// for TTL; a TTL of 0 leaves them uncached. _meta queries, which report the
+// head and the hashes reorgs replace, and errors are never cached.
+type CachingRunner struct {
+	Runner Runner
+	Cache  Cache
+	TTL    time.Duration
+	// Confirmations is the depth below the head past which a block is
+	// final. The head is read from _meta at most once per HeadInterval.
+	Confirmations int64
+	HeadInterval  time.Duration
+
+	mu         sync.Mutex
+	head       int64
+	headLoaded time.Time
+}
+
+func NewCachingRunner(runner Runner, cache Cache, ttl time.Duration) *CachingRunner {
+	return &CachingRunner{Runner: runner, Cache: cache, TTL: ttl, Confirmations: 64, HeadInterval: 30 * time.Second}
+}
+
+var (
+	blockPinned = regexp.MustCompile(`\bblock:\{(number|hash):`)
+	blockNumber = regexp.MustCompile(`\bblock:\{number:(\d+)`)
+	metaQuery   = regexp.MustCompile(`\b_meta\b`)
+)
+
+// NormalizeQuery is querytext.Normalize: queries differing only in layout
+// outside string literals share a cache key.
+func NormalizeQuery(query string) string {
+	return querytext.Normalize(query)
+}
+
+// CacheKey is the key a query is cached under: the SHA-256 of its normalized
+// text, arguments included.
+func CacheKey(query string) string {
+	return cacheKey(NormalizeQuery(query))
+}
+
+func cacheKey(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *CachingRunner) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	normalized := NormalizeQuery(query)
+	if metaQuery.MatchString(normalized) {
+		return c.Runner.Run(ctx, query)
+	}
+	final := c.final(ctx, normalized)
+	if !final && c.TTL <= 0 {
+		return c.Runner.Run(ctx, query)
+	}
+	key := cacheKey(normalized)
+	if entry, ok := c.Cache.Get(key); ok && !entry.expired(time.Now()) {
+		var data map[string]interface{}
+		if err := json.Unmarshal(entry.Data, &data); err == nil {
+			return data, nil
+		}
+	}
+
+	data, err := c.Runner.Run(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	entry := CacheEntry{}
+	if entry.Data, err = json.Marshal(data); err != nil {
+		return data, nil
+	}
+	if !final {
+		entry.Expires = time.Now().Add(c.TTL)
+	}
+	// A cache that cannot be written only costs a query next time.
+	c.Cache.Set(key, entry)
+	return data, nil
+}
+
+// final reports whether the normalized query reads a block that can no
+// longer be reorganized: one given by hash, or Confirmations below the head.
+func (c *CachingRunner) final(ctx context.Context, normalized string) bool {
+	if !blockPinned.MatchString(normalized) {
+		return false
+	}
+	match := blockNumber.FindStringSubmatch(normalized)
+	if match == nil {
+		return true
+	}
+	number, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	head, ok := c.loadHead(ctx)
+	return ok && number <= head-c.Confirmations
+}
+
+// loadHead returns the latest block of the subgraph, read from _meta at most
+// once per HeadInterval. A head that cannot be read counts as unknown.
+func (c *CachingRunner) loadHead(ctx context.Context) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.head > 0 && time.Since(c.headLoaded) < c.HeadInterval {
+		return c.head, true
+	}
+	response, err := c.Runner.Run(ctx, generateQueryFromStruct(&Meta{}, "_meta", "", nil))
+	if err != nil {
+		return 0, false
+	}
+	meta, err := decodeMeta(response)
+	if err != nil || meta.Block.Number == 0 {
+		return 0, false
+	}
+	c.head, c.headLoaded = meta.Block.Number, time.Now()
+	return c.head, true
+}
+
+// MemoryCache is a Cache holding the Size most recently used entries.
+type MemoryCache struct {
+	Size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	entry CacheEntry
+}
+
+func NewMemoryCache(size int) *MemoryCache {
+	return &MemoryCache{Size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *MemoryCache) Get(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).entry, true
+}
+
+func (c *MemoryCache) Set(key string, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*memoryEntry).entry = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, entry: entry})
+	for c.Size > 0 && c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// DiskCache is a Cache keeping one JSON file per entry in Dir, so block-pinned
+// responses survive restarts. Expired entries are removed when read.
+type DiskCache struct {
+	Dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{Dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c *DiskCache) Get(key string) (CacheEntry, bool) {
+	raw, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return CacheEntry{}, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return CacheEntry{}, false
+	}
+	if entry.expired(time.Now()) {
+		os.Remove(c.path(key))
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *DiskCache) Set(key string, entry CacheEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Write then rename, so concurrent readers never see a partial file.
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
@@ -0,0 +1,135 @@
+package uniswap
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCachingRunner(t *testing.T) {
+	endpoint := &fakeEndpoint{block: 17000100, data: "a"}
+	runner := NewCachingRunner(endpoint, NewMemoryCache(10), 20*time.Millisecond)
+	ctx := context.Background()
+
+	latest := generateQueryFromStruct(&PairData{}, "pair", "0xpair", nil)
+	pinned := generateQueryFromStruct(&PairData{}, "pair", "0xpair", map[string]interface{}{"block": map[string]interface{}{"number": 17000000}})
+	for i := 0; i < 3; i++ {
+		runner.Run(ctx, latest)
+		runner.Run(ctx, pinned)
+	}
+	// The same query laid out differently shares the cache entry.
+	runner.Run(ctx, "{\n  pair( id: \"0xpair\" ) {\n"+BuildFields(&PairData{})+"\n}\n}")
+	if endpoint.queries != 2 {
+		t.Errorf("Expected 2 queries, got %d", endpoint.queries)
+	}
+
+	endpoint.data = "b"
+	time.Sleep(30 * time.Millisecond)
+	if result, _ := runner.Run(ctx, latest); result["pairs"] != "b" {
+		t.Errorf("Expected the latest query to expire, got %v", result["pairs"])
+	}
+	if result, _ := runner.Run(ctx, pinned); result["pairs"] != "a" {
+		t.Errorf("Expected the pinned query to be cached forever, got %v", result["pairs"])
+	}
+}
+
+func TestCacheKeyKeepsStringLiterals(t *testing.T) {
+	if CacheKey(`{ tokens(where: {symbol: "A B"}) { id } }`) == CacheKey(`{ tokens(where: {symbol: "A  B"}) { id } }`) {
+		t.Error("Expected queries for different symbols to have different keys")
+	}
+	if CacheKey(`{ tokens(where: {symbol: "A B"}) { id } }`) != CacheKey("{\n tokens( where:{ symbol:\"A B\" } ) {\n id\n }\n}") {
+		t.Error("Expected layout outside strings to be ignored")
+	}
+}
+
+func TestCachingRunnerNearHead(t *testing.T) {
+	endpoint := &fakeEndpoint{block: 17000010, data: "a"}
+	runner := NewCachingRunner(endpoint, NewMemoryCache(10), 20*time.Millisecond)
+	runner.Confirmations = 10
+	ctx := context.Background()
+
+	recent := `{ pair(id: "0xpair", block: {number: 17000005}){ id } }`
+	confirmed := `{ pair(id: "0xpair", block: {number: 17000000}){ id } }`
+	runner.Run(ctx, recent)
+	runner.Run(ctx, confirmed)
+	endpoint.data = "b"
+	time.Sleep(30 * time.Millisecond)
+	if result, _ := runner.Run(ctx, recent); result["pairs"] != "b" {
+		t.Errorf("Expected the query near the head to expire, got %v", result["pairs"])
+	}
+	if result, _ := runner.Run(ctx, confirmed); result["pairs"] != "a" {
+		t.Errorf("Expected the confirmed query to be cached forever, got %v", result["pairs"])
+	}
+}
+
+var metaAtBlock = regexp.MustCompile(`block:\s*\{\s*number:\s*(\d+)`)
+
+// reorgEndpoint answers _meta with the hash it has for the requested block.
+type reorgEndpoint struct {
+	head   int64
+	hashes map[int64]string
+}
+
+func (e *reorgEndpoint) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	number := e.head
+	if match := metaAtBlock.FindStringSubmatch(query); match != nil {
+		number, _ = strconv.ParseInt(match[1], 10, 64)
+	}
+	block := map[string]interface{}{"number": number, "hash": e.hashes[number]}
+	return map[string]interface{}{"_meta": map[string]interface{}{"block": block}}, nil
+}
+
+func TestCachingRunnerSeesReorgs(t *testing.T) {
+	endpoint := &reorgEndpoint{head: 1000, hashes: map[int64]string{995: "0xold"}}
+	previous := DefaultRunner()
+	SetRunner(NewCachingRunner(endpoint, NewMemoryCache(10), time.Minute))
+	defer SetRunner(previous)
+
+	if meta, err := QueryMetaAt(995); err != nil || meta.Block.Hash != "0xold" {
+		t.Fatalf("Unexpected meta %+v, %v", meta, err)
+	}
+	endpoint.hashes[995] = "0xnew"
+	if meta, err := QueryMetaAt(995); err != nil || meta.Block.Hash != "0xnew" {
+		t.Errorf("Expected the hash after the reorg, got %+v, %v", meta, err)
+	}
+}
+
+func TestMemoryCacheEvicts(t *testing.T) {
+	cache := NewMemoryCache(2)
+	cache.Set("a", CacheEntry{Data: []byte(`{}`)})
+	cache.Set("b", CacheEntry{Data: []byte(`{}`)})
+	cache.Get("a")
+	cache.Set("c", CacheEntry{Data: []byte(`{}`)})
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get("a"); !ok || cache.Len() != 2 {
+		t.Errorf("Unexpected cache of %d entries", cache.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	endpoint := &fakeEndpoint{data: "a"}
+	query := `{ pair(id: "0xpair", block: {hash: "0xabc"}){ id } }`
+	if _, err := NewCachingRunner(endpoint, cache, 0).Run(context.Background(), query); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	reopened, _ := NewDiskCache(dir)
+	result, err := NewCachingRunner(endpoint, reopened, 0).Run(context.Background(), query)
+	if err != nil || result["pairs"] != "a" || endpoint.queries != 1 {
+		t.Errorf("Expected the response from disk, got %v after %d queries", result, endpoint.queries)
+	}
+
+	cache.Set("expired", CacheEntry{Data: []byte(`{}`), Expires: time.Now().Add(-time.Second)})
+	if _, ok := cache.Get("expired"); ok {
+		t.Errorf("Expected the expired entry to be dropped")
+	}
+}
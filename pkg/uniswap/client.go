@@ -0,0 +1,127 @@
+package uniswap
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/machinebox/graphql"
+)
+
+// DefaultEndpoint is the Uniswap v2 subgraph the Query functions use unless
+// SetRunner is called.
+const DefaultEndpoint = "https://api.thegraph.com/subgraphs/name/uniswap/uniswap-v2"
+
+// Runner executes a GraphQL query and returns its data.
+type Runner interface {
+	Run(ctx context.Context, query string) (map[string]interface{}, error)
+}
+
+var (
+	runnerMu      sync.RWMutex
+	defaultRunner Runner = NewClient(DefaultEndpoint, nil)
+)
+
+// SetRunner replaces the runner RunGraphQLQuery, and so every Query function,
+// sends queries through, e.g. a Client for another endpoint or with a Limiter.
+func SetRunner(r Runner) {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	defaultRunner = r
+}
+
+// DefaultRunner returns the runner set with SetRunner.
+func DefaultRunner() Runner {
+	runnerMu.RLock()
+	defer runnerMu.RUnlock()
+	return defaultRunner
+}
+
+// Client runs queries against one endpoint. When Limiter is set every query
+// waits for it first, so goroutines sharing a Client share its rate.
+type Client struct {
+	Endpoint string
+	Limiter  *Limiter
+	graphql  *graphql.Client
+}
+
+func NewClient(endpoint string, limiter *Limiter) *Client {
+	return NewClientWithHTTP(endpoint, limiter, nil)
+}
+
+// NewClientWithHTTP is NewClient with a custom http.Client, e.g. for timeouts.
+func NewClientWithHTTP(endpoint string, limiter *Limiter, httpClient *http.Client) *Client {
+	var options []graphql.ClientOption
+	if httpClient != nil {
+		options = append(options, graphql.WithHTTPClient(httpClient))
+	}
+	return &Client{Endpoint: endpoint, Limiter: limiter, graphql: graphql.NewClient(endpoint, options...)}
+}
+
+func (c *Client) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var responseData map[string]interface{}
+	if err := c.graphql.Run(ctx, graphql.NewRequest(query), &responseData); err != nil {
+		return nil, err
+	}
+	return responseData, nil
+}
+
+// Limiter is a token bucket: it allows Burst queries at once and refills at
+// Rate queries per second. A Rate of zero or less does not limit.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a query may be sent or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long until one is available.
+func (l *Limiter) reserve() time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
@@ -0,0 +1,101 @@
+package uniswap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/subgraphtest"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(50, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	// Two queries pass at once, the next two wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected the limiter to wait, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewLimiter(0.001, 1).Wait(ctx); err != nil {
+		t.Errorf("Expected the first token without waiting, got %v", err)
+	}
+	slow := NewLimiter(0.001, 1)
+	slow.Wait(context.Background())
+	if err := slow.Wait(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// serveData points the default runner at a server answering every query with
+// data, until the returned function is called.
+func serveData(data string) func() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":` + data + `}`))
+	}))
+	previous := DefaultRunner()
+	SetRunner(NewClient(server.URL, NewLimiter(100, 1)))
+	return func() {
+		SetRunner(previous)
+		server.Close()
+	}
+}
+
+// useFixtures points the default runner at a server replaying
+// testdata/queries.json for the rest of the test.
+func useFixtures(t *testing.T) *subgraphtest.Server {
+	server := subgraphtest.NewServer(t, "testdata/queries.json")
+	previous := DefaultRunner()
+	SetRunner(NewClient(server.URL, nil))
+	t.Cleanup(func() { SetRunner(previous) })
+	return server
+}
+
+// useMock points the default runner at a mock subgraph holding
+// testdata/entities.json for the rest of the test.
+func useMock(t *testing.T) *subgraphtest.Mock {
+	mock := subgraphtest.NewMock(t, "testdata/entities.json")
+	previous := DefaultRunner()
+	SetRunner(NewClient(mock.URL, nil))
+	t.Cleanup(func() { SetRunner(previous) })
+	return mock
+}
+
+func TestSetRunner(t *testing.T) {
+	defer serveData(`{"pairs":[{"id":"0xpair"}]}`)()
+	pairs, err := QueryPairs(map[string]interface{}{"first": 1})
+	if err != nil {
+		t.Fatalf("QueryPairs failed: %v", err)
+	}
+	if len(*pairs) != 1 || (*pairs)[0].ID != "0xpair" {
+		t.Errorf("Unexpected pairs %+v", *pairs)
+	}
+}
+
+func TestQueryMeta(t *testing.T) {
+	defer serveData(`{"_meta":{"block":{"number":17000000,"hash":"0xabc","timestamp":1680000000},"hasIndexingErrors":true,"deployment":"Qm123"}}`)()
+	meta, err := QueryMeta()
+	if err != nil {
+		t.Fatalf("QueryMeta failed: %v", err)
+	}
+	if meta.Block.Number != 17000000 || meta.Block.Hash != "0xabc" || !meta.HasIndexingErrors || meta.Deployment != "Qm123" {
+		t.Errorf("Unexpected meta %+v", meta)
+	}
+	if meta.Block.Time().Unix() != 1680000000 {
+		t.Errorf("Unexpected block time %v", meta.Block.Time())
+	}
+	expected := "{ _meta{ block { number hash timestamp } hasIndexingErrors deployment } }"
+	if query := strings.ReplaceAll(generateQueryFromStruct(&Meta{}, "_meta", "", nil), "\n", " "); query != expected {
+		t.Errorf("Unexpected query %s", query)
+	}
+}
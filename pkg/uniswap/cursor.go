@@ -0,0 +1,53 @@
+package uniswap
+
+// Cursor pages through a collection in ascending order of an integer field,
+// such as the timestamp of swaps or the date of day data, without missing or
+// repeating records that share a value across a page boundary.
+//
+// The subgraph breaks ties in orderBy by id, so the records with Field equal
+// to Value come back in the same order on every query; Skip counts how many
+// of them were already read.
+type Cursor struct {
+	Field string
+	Value int64
+	Skip  int
+}
+
+// NewCursor starts a cursor at records with field >= start.
+func NewCursor(field string, start int64) *Cursor {
+	return &Cursor{Field: field, Value: start}
+}
+
+// Args returns the query arguments for the next page of up to first records
+// matching where. where is not modified.
+func (c *Cursor) Args(where map[string]interface{}, first int) map[string]interface{} {
+	filter := make(map[string]interface{}, len(where)+1)
+	for k, v := range where {
+		filter[k] = v
+	}
+	filter[c.Field+"_gte"] = c.Value
+	args := map[string]interface{}{
+		"first":          first,
+		"orderBy":        c.Field,
+		"orderDirection": "asc",
+		"where":          filter,
+	}
+	if c.Skip > 0 {
+		args["skip"] = c.Skip
+	}
+	return args
+}
+
+// Advance moves the cursor past a page, given the Field value of each of its
+// records in the order they were returned.
+func (c *Cursor) Advance(values []int64) {
+	for _, value := range values {
+		switch {
+		case value == c.Value:
+			c.Skip++
+		case value > c.Value:
+			c.Value = value
+			c.Skip = 1
+		}
+	}
+}
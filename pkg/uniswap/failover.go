@@ -0,0 +1,304 @@
+package uniswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailoverRunner sends queries to the first usable of several endpoints,
+// e.g. a paid gateway then a secondary indexer.
+//
+// Endpoints are ranked by the latest block their _meta reports, refreshed
+// every RefreshInterval: the first endpoint in list order that is at most
+// MaxBlockLag blocks behind the freshest one is tried first, then the others
+// from freshest to stalest. An endpoint that fails FailureThreshold queries
+// in a row has its circuit opened and is skipped for Cooldown, after which a
+// single query is let through to probe it.
+type FailoverRunner struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+	RefreshInterval  time.Duration
+	MaxBlockLag      int64
+	// CrossCheck runs every query on the two best endpoints and compares
+	// the results. Queries not pinned to a block are only compared when
+	// both endpoints report the same block, since they cannot be expected
+	// to match otherwise.
+	CrossCheck bool
+	// OnDivergence is called when cross-checked results differ. Without it
+	// Run returns a *DivergenceError.
+	OnDivergence func(*DivergenceError)
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	refreshed time.Time
+}
+
+type endpoint struct {
+	name      string
+	runner    Runner
+	block     int64
+	failures  int
+	openUntil time.Time
+	probing   bool
+	lastError error
+}
+
+// EndpointStatus is the health of one endpoint of a FailoverRunner.
+type EndpointStatus struct {
+	Name      string
+	Block     int64
+	Failures  int
+	Open      bool
+	LastError error
+}
+
+// DivergenceError reports two endpoints returning different results.
+type DivergenceError struct {
+	Query              string
+	Primary, Secondary string
+	PrimaryBlock       int64
+	SecondaryBlock     int64
+	PrimaryResult      map[string]interface{}
+	SecondaryResult    map[string]interface{}
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("endpoints diverge: %s (block %d) and %s (block %d) returned different results",
+		e.Primary, e.PrimaryBlock, e.Secondary, e.SecondaryBlock)
+}
+
+// NewFailoverRunner returns a runner over runners in order of preference,
+// typically Clients sharing a Limiter.
+func NewFailoverRunner(runners ...Runner) *FailoverRunner {
+	f := &FailoverRunner{
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+		RefreshInterval:  30 * time.Second,
+		MaxBlockLag:      10,
+	}
+	for i, runner := range runners {
+		name := fmt.Sprintf("endpoint %d", i)
+		if client, ok := runner.(*Client); ok {
+			name = client.Endpoint
+		}
+		f.endpoints = append(f.endpoints, &endpoint{name: name, runner: runner})
+	}
+	return f
+}
+
+// NewFailoverClient is NewFailoverRunner over a Client per endpoint URL,
+// sharing limiter.
+func NewFailoverClient(limiter *Limiter, urls ...string) *FailoverRunner {
+	runners := make([]Runner, len(urls))
+	for i, url := range urls {
+		runners[i] = NewClient(url, limiter)
+	}
+	return NewFailoverRunner(runners...)
+}
+
+func (f *FailoverRunner) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	f.refresh(ctx)
+	candidates := f.candidates()
+	if len(candidates) == 0 {
+		return nil, errors.New("no endpoint available: all circuits are open")
+	}
+
+	var errs []string
+	for i, e := range candidates {
+		if !f.probe(e) {
+			continue
+		}
+		result, err := e.runner.Run(ctx, query)
+		if ctx.Err() != nil {
+			f.mu.Lock()
+			e.probing = false
+			f.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		f.record(e, err)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", e.name, err))
+			continue
+		}
+		if f.CrossCheck {
+			if err := f.crossCheck(ctx, query, e, result, candidates[i+1:]); err != nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("all endpoints failed: %s", strings.Join(errs, "; "))
+}
+
+// Status returns the health of every endpoint in list order.
+func (f *FailoverRunner) Status() []EndpointStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	statuses := make([]EndpointStatus, len(f.endpoints))
+	for i, e := range f.endpoints {
+		statuses[i] = EndpointStatus{Name: e.name, Block: e.block, Failures: e.failures, Open: now.Before(e.openUntil), LastError: e.lastError}
+	}
+	return statuses
+}
+
+// crossCheck runs query on the next endpoint that answers and can be
+// compared: any endpoint for a block-pinned query, otherwise only one at the
+// block of primary.
+func (f *FailoverRunner) crossCheck(ctx context.Context, query string, primary *endpoint, result map[string]interface{}, others []*endpoint) error {
+	pinned := blockPinned.MatchString(NormalizeQuery(query))
+	for _, e := range others {
+		f.mu.Lock()
+		comparable := pinned || e.block == primary.block
+		f.mu.Unlock()
+		if !comparable || !f.probe(e) {
+			continue
+		}
+		other, err := e.runner.Run(ctx, query)
+		f.record(e, err)
+		if err != nil {
+			continue
+		}
+		if reflect.DeepEqual(result, other) {
+			return nil
+		}
+		f.mu.Lock()
+		divergence := &DivergenceError{
+			Query:           query,
+			Primary:         primary.name,
+			Secondary:       e.name,
+			PrimaryBlock:    primary.block,
+			SecondaryBlock:  e.block,
+			PrimaryResult:   result,
+			SecondaryResult: other,
+		}
+		f.mu.Unlock()
+		if f.OnDivergence != nil {
+			f.OnDivergence(divergence)
+			return nil
+		}
+		return divergence
+	}
+	return nil
+}
+
+// refresh re-reads the _meta block of every endpoint whose circuit is closed,
+// at most once per RefreshInterval.
+func (f *FailoverRunner) refresh(ctx context.Context) {
+	f.mu.Lock()
+	if time.Since(f.refreshed) < f.RefreshInterval || len(f.endpoints) < 2 {
+		f.mu.Unlock()
+		return
+	}
+	f.refreshed = time.Now()
+	var endpoints []*endpoint
+	for _, e := range f.endpoints {
+		if !time.Now().Before(e.openUntil) {
+			endpoints = append(endpoints, e)
+		}
+	}
+	f.mu.Unlock()
+
+	query := generateQueryFromStruct(&Meta{}, "_meta", "", nil)
+	var wg sync.WaitGroup
+	for _, e := range endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			response, err := e.runner.Run(ctx, query)
+			var meta *Meta
+			if err == nil {
+				meta, err = decodeMeta(response)
+			}
+			f.record(e, err)
+			if err == nil {
+				f.mu.Lock()
+				e.block = meta.Block.Number
+				f.mu.Unlock()
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// candidates returns the endpoints to try, in order.
+func (f *FailoverRunner) candidates() []*endpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	var freshest int64
+	var usable []*endpoint
+	for _, e := range f.endpoints {
+		if now.Before(e.openUntil) {
+			continue
+		}
+		if e.probing {
+			continue
+		}
+		usable = append(usable, e)
+		if e.block > freshest {
+			freshest = e.block
+		}
+	}
+
+	var preferred *endpoint
+	for _, e := range usable {
+		if freshest-e.block <= f.MaxBlockLag {
+			preferred = e
+			break
+		}
+	}
+	candidates := make([]*endpoint, 0, len(usable))
+	if preferred != nil {
+		candidates = append(candidates, preferred)
+	}
+	var rest []*endpoint
+	for _, e := range usable {
+		if e != preferred {
+			rest = append(rest, e)
+		}
+	}
+	// Stable insertion sort by block, freshest first, keeping list order on ties.
+	for i := 1; i < len(rest); i++ {
+		for j := i; j > 0 && rest[j].block > rest[j-1].block; j-- {
+			rest[j], rest[j-1] = rest[j-1], rest[j]
+		}
+	}
+	return append(candidates, rest...)
+}
+
+// probe reports whether a query may be sent to e. Once its cooldown is over
+// an endpoint takes a single query, as a probe, until that query is recorded.
+func (f *FailoverRunner) probe(e *endpoint) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e.openUntil.IsZero() {
+		return true
+	}
+	if e.probing {
+		return false
+	}
+	e.probing = true
+	return true
+}
+
+// record updates the circuit of e after a query.
+func (f *FailoverRunner) record(e *endpoint, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.probing = false
+	if err == nil {
+		e.failures, e.openUntil = 0, time.Time{}
+		return
+	}
+	e.failures++
+	e.lastError = err
+	if e.failures >= f.FailureThreshold {
+		e.openUntil = time.Now().Add(f.Cooldown)
+	}
+}
@@ -0,0 +1,156 @@
+package uniswap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEndpoint answers _meta with its block and every other query with data,
+// or with err when set.
+type fakeEndpoint struct {
+	block   int64
+	data    string
+	err     error
+	queries int
+}
+
+func (e *fakeEndpoint) Run(ctx context.Context, query string) (map[string]interface{}, error) {
+	if strings.Contains(query, "_meta") {
+		return map[string]interface{}{"_meta": map[string]interface{}{"block": map[string]interface{}{"number": e.block}}}, nil
+	}
+	e.queries++
+	if e.err != nil {
+		return nil, e.err
+	}
+	return map[string]interface{}{"pairs": e.data}, nil
+}
+
+func TestFailoverRunnerPrefersFreshEndpoint(t *testing.T) {
+	primary := &fakeEndpoint{block: 1000, data: "primary"}
+	secondary := &fakeEndpoint{block: 1005, data: "secondary"}
+	failover := NewFailoverRunner(primary, secondary)
+
+	result, err := failover.Run(context.Background(), "{ pairs { id } }")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result["pairs"] != "primary" {
+		t.Errorf("Expected the primary within MaxBlockLag, got %v", result["pairs"])
+	}
+
+	primary.block = 900
+	failover.RefreshInterval = 0
+	if result, _ = failover.Run(context.Background(), "{ pairs { id } }"); result["pairs"] != "secondary" {
+		t.Errorf("Expected the fresher secondary, got %v", result["pairs"])
+	}
+	if status := failover.Status(); status[0].Block != 900 || status[1].Block != 1005 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestFailoverRunnerCircuitBreaker(t *testing.T) {
+	primary := &fakeEndpoint{block: 1000, data: "primary", err: errors.New("502 Bad Gateway")}
+	secondary := &fakeEndpoint{block: 1000, data: "secondary"}
+	failover := NewFailoverRunner(primary, secondary)
+	failover.FailureThreshold = 2
+	failover.Cooldown = 20 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		result, err := failover.Run(context.Background(), "{ pairs { id } }")
+		if err != nil || result["pairs"] != "secondary" {
+			t.Fatalf("Expected the secondary, got %v, %v", result, err)
+		}
+	}
+	// Two failed queries open the circuit; the third skips the primary.
+	if primary.queries != 2 || !failover.Status()[0].Open {
+		t.Errorf("Expected the primary circuit open after 2 queries, got %d queries, %+v", primary.queries, failover.Status()[0])
+	}
+
+	primary.err = nil
+	time.Sleep(30 * time.Millisecond)
+	if result, _ := failover.Run(context.Background(), "{ pairs { id } }"); result["pairs"] != "primary" {
+		t.Errorf("Expected the primary after the cooldown, got %v", result["pairs"])
+	}
+	if status := failover.Status()[0]; status.Open || status.Failures != 0 {
+		t.Errorf("Expected the primary circuit closed, got %+v", status)
+	}
+
+	secondary.err = errors.New("timeout")
+	primary.err = errors.New("502 Bad Gateway")
+	if _, err := failover.Run(context.Background(), "{ pairs { id } }"); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected both errors, got %v", err)
+	}
+}
+
+func TestFailoverRunnerProbesOnlyTriedEndpoints(t *testing.T) {
+	primary := &fakeEndpoint{block: 1000, data: "primary", err: errors.New("502 Bad Gateway")}
+	secondary := &fakeEndpoint{block: 1000, data: "secondary", err: errors.New("timeout")}
+	failover := NewFailoverRunner(primary, secondary)
+	failover.FailureThreshold = 1
+	failover.Cooldown = 20 * time.Millisecond
+	failover.Run(context.Background(), "{ pairs { id } }")
+	if status := failover.Status(); !status[0].Open || !status[1].Open {
+		t.Fatalf("Expected both circuits open, got %+v", status)
+	}
+
+	// Both cool down, but only the primary is probed by the next query.
+	primary.err, secondary.err = nil, nil
+	time.Sleep(30 * time.Millisecond)
+	if result, err := failover.Run(context.Background(), "{ pairs { id } }"); err != nil || result["pairs"] != "primary" {
+		t.Fatalf("Expected the primary, got %v, %v", result, err)
+	}
+	primary.err = errors.New("502 Bad Gateway")
+	if result, err := failover.Run(context.Background(), "{ pairs { id } }"); err != nil || result["pairs"] != "secondary" {
+		t.Errorf("Expected the untried secondary to be probed, got %v, %v", result, err)
+	}
+}
+
+func TestFailoverRunnerCrossCheck(t *testing.T) {
+	primary := &fakeEndpoint{block: 1000, data: "a"}
+	secondary := &fakeEndpoint{block: 1000, data: "a"}
+	failover := NewFailoverRunner(primary, secondary)
+	failover.CrossCheck = true
+
+	if _, err := failover.Run(context.Background(), "{ pairs { id } }"); err != nil {
+		t.Errorf("Expected matching results, got %v", err)
+	}
+	if secondary.queries != 1 {
+		t.Errorf("Expected the secondary to be queried, got %d queries", secondary.queries)
+	}
+
+	secondary.data = "b"
+	_, err := failover.Run(context.Background(), "{ pairs { id } }")
+	var divergence *DivergenceError
+	if !errors.As(err, &divergence) || divergence.SecondaryResult["pairs"] != "b" {
+		t.Errorf("Expected a DivergenceError, got %v", err)
+	}
+
+	var reported *DivergenceError
+	failover.OnDivergence = func(d *DivergenceError) { reported = d }
+	if result, err := failover.Run(context.Background(), "{ pairs { id } }"); err != nil || result["pairs"] != "a" || reported == nil {
+		t.Errorf("Expected the divergence to be reported, got %v, %v", result, err)
+	}
+}
+
+func TestFailoverRunnerCrossCheckAtDifferentBlocks(t *testing.T) {
+	primary := &fakeEndpoint{block: 1005, data: "a"}
+	secondary := &fakeEndpoint{block: 1000, data: "b"}
+	failover := NewFailoverRunner(primary, secondary)
+	failover.CrossCheck = true
+
+	if result, err := failover.Run(context.Background(), "{ pairs { id } }"); err != nil || result["pairs"] != "a" {
+		t.Errorf("Expected the unpinned query not to be compared, got %v, %v", result, err)
+	}
+	if secondary.queries != 0 {
+		t.Errorf("Expected the secondary to be skipped, got %d queries", secondary.queries)
+	}
+
+	_, err := failover.Run(context.Background(), "{ pairs(block: {number: 1000}) { id } }")
+	var divergence *DivergenceError
+	if !errors.As(err, &divergence) || divergence.PrimaryBlock != 1005 || divergence.SecondaryBlock != 1000 {
+		t.Errorf("Expected the pinned query to be compared, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package uniswap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Meta is the indexing status graph-node reports for a subgraph: the latest
+// block it has processed, which every query is answered at, and whether it
+// hit an indexing error.
+type Meta struct {
+	Block             MetaBlock `graphql:"block"`
+	HasIndexingErrors bool      `graphql:"hasIndexingErrors"`
+	Deployment        string    `graphql:"deployment"`
+}
+
+type MetaBlock struct {
+	Number int64  `graphql:"number"`
+	Hash   string `graphql:"hash"`
+	// Timestamp is in unix seconds. Older graph-node versions leave it null,
+	// which decodes as 0.
+	Timestamp int64 `graphql:"timestamp"`
+}
+
+// Time returns the block timestamp, or the zero time when it is unknown.
+func (b MetaBlock) Time() time.Time {
+	if b.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(b.Timestamp, 0).UTC()
+}
+
+// QueryMeta fetches _meta { block { number hash timestamp } hasIndexingErrors deployment }.
+func QueryMeta() (*Meta, error) {
+	return QueryMetaAt(0)
+}
+
+// QueryMetaAt fetches _meta as of block, which gives the hash the subgraph
+// now has for that block. A block of 0 means the latest.
+func QueryMetaAt(block int64) (*Meta, error) {
+	return QueryMetaAtContext(context.Background(), block)
+}
+
+// QueryMetaAtContext is QueryMetaAt with a context the query is cancelled with.
+func QueryMetaAtContext(ctx context.Context, block int64) (*Meta, error) {
+	var args map[string]interface{}
+	if block > 0 {
+		args = map[string]interface{}{"block": map[string]interface{}{"number": block}}
+	}
+	query := generateQueryFromStruct(&Meta{}, "_meta", "", args)
+	metaResponse, err := RunGraphQLQueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMeta(metaResponse)
+}
+
+func decodeMeta(response map[string]interface{}) (*Meta, error) {
+	if response["_meta"] == nil {
+		return nil, fmt.Errorf("no _meta in response")
+	}
+	var meta *Meta
+	metaJSON, err := json.Marshal(response["_meta"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(metaJSON, &meta)
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
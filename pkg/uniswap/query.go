@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/machinebox/graphql"
@@ -18,16 +18,33 @@ import (
 // ██   ██ ██      ██      ██      ██      ██   ██     ██      ██    ██ ██  ██ ██ ██         ██    ██ ██    ██ ██  ██ ██      ██
 // ██   ██ ███████ ███████ ██      ███████ ██   ██     ██       ██████  ██   ████  ██████    ██    ██  ██████  ██   ████ ███████
 
+// generateQueryFromStruct builds a single-entity query when id is set and a
+// collection query (pairs, swaps, ...) when id is empty.
 func generateQueryFromStruct(obj interface{}, queryName string, id string, args map[string]interface{}) string {
+	if id == "" {
+		if len(args) == 0 {
+			return fmt.Sprintf(`{ %s{ %s } }`, queryName, BuildFields(obj))
+		}
+		return fmt.Sprintf(`{ %s(%s){ %s } }`, queryName, BuildArgs(args), BuildFields(obj))
+	}
 	if args == nil {
 		return fmt.Sprintf(`{ %s(id: "%s"){ %s } }`, queryName, id, BuildFields(obj))
 	}
 	return fmt.Sprintf(`{ %s(id: "%s", %s){ %s } }`, queryName, id, BuildArgs(args), BuildFields(obj))
 }
 
+// BuildArgs renders query arguments in key order so the same args always
+// produce the same query text.
 func BuildArgs(args map[string]interface{}) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	var argStrings []string
-	for k, v := range args {
+	for _, k := range keys {
+		v := args[k]
 		argValue := ""
 		switch v := v.(type) {
 		case string:
@@ -36,6 +53,12 @@ func BuildArgs(args map[string]interface{}) string {
 			argValue = fmt.Sprintf("%d", v)
 		case float64:
 			argValue = fmt.Sprintf("%f", v)
+		case []string:
+			quoted := make([]string, len(v))
+			for i, item := range v {
+				quoted[i] = fmt.Sprintf(`"%s"`, item)
+			}
+			argValue = fmt.Sprintf("[%s]", strings.Join(quoted, ", "))
 		case map[string]interface{}:
 			argValue = fmt.Sprintf("{%s}", BuildArgs(v))
 		default:
@@ -45,40 +68,64 @@ func BuildArgs(args map[string]interface{}) string {
 	}
 	return strings.Join(argStrings, ", ")
 }
-func BuildFields(obj interface{}) string {
-	var value reflect.Value
-	if reflect.TypeOf(obj).Kind() == reflect.Ptr {
-		value = reflect.ValueOf(obj).Elem()
-	} else {
-		value = reflect.ValueOf(obj)
+
+// AtBlock sets the block argument of args, creating them when nil, so the
+// query reads entities as they were at block. A block of 0 leaves args
+// unchanged, for the latest state.
+func AtBlock(args map[string]interface{}, block int) map[string]interface{} {
+	if block <= 0 {
+		return args
+	}
+	if args == nil {
+		args = make(map[string]interface{})
 	}
+	args["block"] = map[string]interface{}{
+		"number": block,
+	}
+	return args
+}
 
+// BuildFields returns the selection set for obj from its graphql struct tags.
+// Struct, pointer-to-struct and slice-of-struct fields are expanded into a
+// nested selection, e.g. token0 { id symbol }.
+func BuildFields(obj interface{}) string {
+	return buildFieldsForType(reflect.TypeOf(obj))
+}
+
+func buildFieldsForType(t reflect.Type) string {
+	t = entityType(t)
 	var fields []string
-	for i := 0; i < value.NumField(); i++ {
-		field := value.Type().Field(i)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
 		tag := field.Tag.Get("graphql")
-		if tag != "" {
-			fields = append(fields, tag)
+		if tag == "" {
+			continue
 		}
+		if entityType(field.Type).Kind() == reflect.Struct {
+			fields = append(fields, fmt.Sprintf("%s { %s }", tag, buildFieldsForType(field.Type)))
+			continue
+		}
+		fields = append(fields, tag)
 	}
 	return strings.Join(fields, "\n")
 }
 
-func RunGraphQLQuery(query string) (map[string]interface{}, error) {
-	// Set up a new GraphQL client
-	client := graphql.NewClient("https://api.thegraph.com/subgraphs/name/uniswap/uniswap-v2")
-
-	// Create a new request with the GraphQL query
-	req := graphql.NewRequest(query)
-
-	// Execute the request
-	var responseData map[string]interface{}
-	err := client.Run(context.Background(), req, &responseData)
-	if err != nil {
-		return nil, err
+// entityType strips pointers and slices down to the underlying element type.
+func entityType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
 	}
+	return t
+}
+
+// RunGraphQLQuery runs query through the runner set with SetRunner.
+func RunGraphQLQuery(query string) (map[string]interface{}, error) {
+	return RunGraphQLQueryContext(context.Background(), query)
+}
 
-	return responseData, nil
+// RunGraphQLQueryContext is RunGraphQLQuery with a context the runner stops on.
+func RunGraphQLQueryContext(ctx context.Context, query string) (map[string]interface{}, error) {
+	return DefaultRunner().Run(ctx, query)
 }
 
 // ██████   ██       ██████  ██████   █████  ██          ██████   █████  ████████  █████
@@ -130,6 +177,7 @@ type Token struct {
 }
 
 type PairData struct {
+	ID         string `graphql:"id"`
 	Token0     *Token `graphql:"token0"`
 	Token1     *Token `graphql:"token1"`
 	Reserve0   string `graphql:"reserve0"`
@@ -142,7 +190,10 @@ type Pairs struct {
 	ID string `graphql:"id"`
 }
 type RecentSwapsFromPairQuery struct {
-	Pair struct {
+	ID          string       `graphql:"id"`
+	Transaction *Transaction `graphql:"transaction"`
+	Pair        struct {
+		ID     string `graphql:"id"`
 		Token0 struct {
 			Symbol string `graphql:"symbol"`
 		} `graphql:"token0"`
@@ -158,19 +209,45 @@ type RecentSwapsFromPairQuery struct {
 	To         string `graphql:"to"`
 }
 type PairDailyAggregated struct {
-	Date              string `graphql:"date"`
+	Date              int    `graphql:"date"`
+	PairAddress       string `graphql:"pairAddress"`
 	DailyVolumeToken0 string `graphql:"dailyVolumeToken0"`
 	DailyVolumeToken1 string `graphql:"dailyVolumeToken1"`
 	DailyVolumeUSD    string `graphql:"dailyVolumeUSD"`
+	Reserve0          string `graphql:"reserve0"`
+	Reserve1          string `graphql:"reserve1"`
 	ReserveUSD        string `graphql:"reserveUSD"`
 }
 
+// LiquidityPosition is the LP token balance a user holds in a pair.
+type LiquidityPosition struct {
+	ID                    string `graphql:"id"`
+	User                  *User  `graphql:"user"`
+	Pair                  *Pairs `graphql:"pair"`
+	LiquidityTokenBalance string `graphql:"liquidityTokenBalance"`
+}
+type User struct {
+	ID string `graphql:"id"`
+}
+
+// PairHourData holds the reserves of a pair at the end of an hour, as
+// recorded by the last event in that hour, along with the hourly volume.
+type PairHourData struct {
+	HourStartUnix      int    `graphql:"hourStartUnix"`
+	Reserve0           string `graphql:"reserve0"`
+	Reserve1           string `graphql:"reserve1"`
+	ReserveUSD         string `graphql:"reserveUSD"`
+	HourlyVolumeToken0 string `graphql:"hourlyVolumeToken0"`
+	HourlyVolumeToken1 string `graphql:"hourlyVolumeToken1"`
+	HourlyVolumeUSD    string `graphql:"hourlyVolumeUSD"`
+}
+
 func QueryPairOverview(pairID string) (*PairData, error) {
 	pairQuery := PairData{}
 	query := generateQueryFromStruct(&pairQuery, "pair", pairID, nil)
 	pairDataResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 	pairData, ok := pairDataResponse["pair"].(map[string]interface{})
 	if !ok {
@@ -200,14 +277,9 @@ func QueryAllUniswapPairs(skip int) (*[]Pairs, error) {
 	query := generateQueryFromStruct(&pairQuery, "pairs", "", args)
 	pairsResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 
-	// pairsData, ok := pairsResponse["pairs"].(map[string]interface{})
-	// if !ok {
-	// 	return nil, errors.New("unexpected response format")
-	// }
-	// fmt.Printf("pairsResponse: %v", pairsResponse["pairs"])
 	var pairs *[]Pairs
 	pairsJSON, err := json.Marshal(pairsResponse["pairs"])
 	if err != nil {
@@ -236,14 +308,9 @@ func QueryMostLiquidPairs(args map[string]interface{}) (*[]Pairs, error) {
 	query := generateQueryFromStruct(&pairQuery, "pairs", "", args)
 	pairsResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 
-	// pairsData, ok := pairsResponse["pairs"].(map[string]interface{})
-	// if !ok {
-	// 	return nil, errors.New("unexpected response format")
-	// }
-	// fmt.Printf("pairsResponse: %v", pairsResponse["pairs"])
 	var pairs *[]Pairs
 	pairsJSON, err := json.Marshal(pairsResponse["pairs"])
 	if err != nil {
@@ -257,6 +324,43 @@ func QueryMostLiquidPairs(args map[string]interface{}) (*[]Pairs, error) {
 	return pairs, nil
 }
 
+// QueryPairs fetches pairs together with their tokens and reserves, which is what
+// routing and pricing code needs to simulate swaps. The args are passed through
+// unchanged, for example:
+//
+//	args := map[string]interface{}{
+//		"first":          1000,                 // Fetch the first 1000 pairs
+//		"orderBy":        "reserveUSD",         // Order the pairs by their reserveUSD
+//		"orderDirection": "desc",               // Sort the pairs in descending order (highest liquidity first)
+//		"where": map[string]interface{}{
+//			"id_in": pairIDs,                    // Optionally restrict to known pair IDs
+//		},
+//	}
+func QueryPairs(args map[string]interface{}) (*[]PairData, error) {
+	return QueryPairsContext(context.Background(), args)
+}
+
+// QueryPairsContext is QueryPairs with a context the query is cancelled with.
+func QueryPairsContext(ctx context.Context, args map[string]interface{}) (*[]PairData, error) {
+	pairQuery := PairData{}
+	query := generateQueryFromStruct(&pairQuery, "pairs", "", args)
+	pairsResponse, err := RunGraphQLQueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var pairs *[]PairData
+	pairsJSON, err := json.Marshal(pairsResponse["pairs"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(pairsJSON, &pairs)
+	if err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
 // Get the last 100 swaps on a pair by fetching Swap events and passing in the pair address.
 // You'll often want token information as well.
 
@@ -275,7 +379,7 @@ func QueryRecentSwapsFromPair(args map[string]interface{}) (*[]RecentSwapsFromPa
 	query := generateQueryFromStruct(&queryStruct, "swaps", "", args)
 	recentSwapsFromPairQueryResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 	var recentSwapsFromPairQuery *[]RecentSwapsFromPairQuery
 	pairsJSON, err := json.Marshal(recentSwapsFromPairQueryResponse["swaps"])
@@ -307,10 +411,10 @@ func QueryPairDailyAggregated(args map[string]interface{}) (*[]PairDailyAggregat
 	query := generateQueryFromStruct(&queryStruct, "pairDayDatas", "", args)
 	pairDailyAggregatedResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 	var pairDailyAggregated *[]PairDailyAggregated
-	pairsJSON, err := json.Marshal(pairDailyAggregatedResponse["swaps"])
+	pairsJSON, err := json.Marshal(pairDailyAggregatedResponse["pairDayDatas"])
 	if err != nil {
 		return nil, err
 	}
@@ -322,6 +426,70 @@ func QueryPairDailyAggregated(args map[string]interface{}) (*[]PairDailyAggregat
 	return pairDailyAggregated, nil
 }
 
+// QueryPairHourData fetches hourly snapshots of a pair's reserves and volume.
+// The function takes a map as an argument, for example:
+//
+//	args := map[string]interface{}{
+//		"first":          168,                  // One week of hours
+//		"orderBy":        "hourStartUnix",      // Order the snapshots by hour
+//		"orderDirection": "asc",                // Oldest first
+//		"where": map[string]interface{}{
+//			"pair":              pairAddress,    // The pair address to filter by
+//			"hourStartUnix_gte": timestamp,      // Fetch hours starting at or after the provided timestamp
+//		},
+//	}
+func QueryPairHourData(args map[string]interface{}) (*[]PairHourData, error) {
+	queryStruct := PairHourData{}
+	query := generateQueryFromStruct(&queryStruct, "pairHourDatas", "", args)
+	pairHourDataResponse, err := RunGraphQLQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var pairHourData *[]PairHourData
+	pairHourDataJSON, err := json.Marshal(pairHourDataResponse["pairHourDatas"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(pairHourDataJSON, &pairHourData)
+	if err != nil {
+		return nil, err
+	}
+	return pairHourData, nil
+}
+
+// QueryLiquidityPositions fetches LP token balances, typically the largest
+// holders of a pair:
+//
+//	args := map[string]interface{}{
+//		"first":          100,                      // Fetch the 100 largest positions
+//		"orderBy":        "liquidityTokenBalance",  // Order by LP token balance
+//		"orderDirection": "desc",                   // Largest first
+//		"where": map[string]interface{}{
+//			"pair":                     pairID,    // The pair to inspect
+//			"liquidityTokenBalance_gt": 0,         // Skip closed positions
+//		},
+//	}
+func QueryLiquidityPositions(args map[string]interface{}) (*[]LiquidityPosition, error) {
+	queryStruct := LiquidityPosition{}
+	query := generateQueryFromStruct(&queryStruct, "liquidityPositions", "", args)
+	positionsResponse, err := RunGraphQLQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var positions *[]LiquidityPosition
+	positionsJSON, err := json.Marshal(positionsResponse["liquidityPositions"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(positionsJSON, &positions)
+	if err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
 // ████████  ██████  ██   ██ ███████ ███    ██     ██████   █████  ████████  █████
 //    ██    ██    ██ ██  ██  ██      ████   ██     ██   ██ ██   ██    ██    ██   ██
 //    ██    ██    ██ █████   █████   ██ ██  ██     ██   ██ ███████    ██    ███████
@@ -357,36 +525,50 @@ type TokenDayData struct {
 	DailyVolumeUSD    string `graphql:"dailyVolumeUSD"`
 }
 type Transaction struct {
-	ID        string `graphql:"id"`
-	Timestamp string `graphql:"timestamp"`
+	ID          string `graphql:"id"`
+	BlockNumber string `graphql:"blockNumber"`
+	Timestamp   string `graphql:"timestamp"`
 }
 
 type Mint struct {
+	ID          string       `graphql:"id"`
 	Transaction *Transaction `graphql:"transaction"`
+	Pair        *Pairs       `graphql:"pair"`
 	To          string       `graphql:"to"`
 	Liquidity   string       `graphql:"liquidity"`
 	Amount0     string       `graphql:"amount0"`
 	Amount1     string       `graphql:"amount1"`
 	AmountUSD   string       `graphql:"amountUSD"`
+	LogIndex    string       `graphql:"logIndex"`
 }
 
 type Burn struct {
+	ID          string       `graphql:"id"`
 	Transaction *Transaction `graphql:"transaction"`
+	Pair        *Pairs       `graphql:"pair"`
 	To          string       `graphql:"to"`
 	Liquidity   string       `graphql:"liquidity"`
 	Amount0     string       `graphql:"amount0"`
 	Amount1     string       `graphql:"amount1"`
 	AmountUSD   string       `graphql:"amountUSD"`
+	LogIndex    string       `graphql:"logIndex"`
 }
 
+// Sender is the address that called the pair (usually a router) and From the
+// account that signed the transaction.
 type Swap struct {
+	ID          string       `graphql:"id"`
 	Transaction *Transaction `graphql:"transaction"`
+	Pair        *Pairs       `graphql:"pair"`
 	Amount0In   string       `graphql:"amount0In"`
 	Amount0Out  string       `graphql:"amount0Out"`
 	Amount1In   string       `graphql:"amount1In"`
 	Amount1Out  string       `graphql:"amount1Out"`
 	AmountUSD   string       `graphql:"amountUSD"`
 	To          string       `graphql:"to"`
+	Sender      string       `graphql:"sender"`
+	From        string       `graphql:"from"`
+	LogIndex    string       `graphql:"logIndex"`
 }
 
 type TokenTransactions struct {
@@ -404,7 +586,7 @@ func QueryTokenOverview(tokenID string) (*TokenOverview, error) {
 	query := generateQueryFromStruct(queryStruct, "token", tokenID, nil)
 	tokenOverviewResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing GraphQL request: %v", err)
+		return nil, err
 	}
 	tokenOverview, ok := tokenOverviewResponse["token"].(map[string]interface{})
 	if !ok {
@@ -433,7 +615,7 @@ func QueryTokenData(tokenID string) (*TokenData, error) {
 
 	tokenDataResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 	tokenData, ok := tokenDataResponse["token"].(map[string]interface{})
 	if !ok {
@@ -467,7 +649,7 @@ func QueryAllUniswapTokens(skip int) (*[]TokenData, error) {
 	query := generateQueryFromStruct(queryStruct, "tokens", "", args)
 	allUniswapTokensResponse, err := RunGraphQLQuery(query)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 	var allUniswapTokens *[]TokenData
 	allUniswapTokensJSON, err := json.Marshal(allUniswapTokensResponse["tokens"])
@@ -482,6 +664,97 @@ func QueryAllUniswapTokens(skip int) (*[]TokenData, error) {
 	return allUniswapTokens, nil
 }
 
+// QuerySwaps fetches swaps matching args, with their transaction, pair and
+// the fields needed to order them within a block. For example:
+//
+//	args := map[string]interface{}{
+//		"first":          1000,                 // Fetch up to 1000 swaps
+//		"orderBy":        "timestamp",          // Order the swaps by their timestamp
+//		"orderDirection": "asc",                // Oldest first
+//		"where": map[string]interface{}{
+//			"pair":          pairID,             // Filter the swaps based on the pairID
+//			"timestamp_gte": timestamp,          // Fetch swaps at or after the provided timestamp
+//		},
+//	}
+func QuerySwaps(args map[string]interface{}) (*[]Swap, error) {
+	return QuerySwapsContext(context.Background(), args)
+}
+
+// QuerySwapsContext is QuerySwaps with a context the query is cancelled with.
+func QuerySwapsContext(ctx context.Context, args map[string]interface{}) (*[]Swap, error) {
+	queryStruct := Swap{}
+	query := generateQueryFromStruct(&queryStruct, "swaps", "", args)
+	swapsResponse, err := RunGraphQLQueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var swaps *[]Swap
+	swapsJSON, err := json.Marshal(swapsResponse["swaps"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(swapsJSON, &swaps)
+	if err != nil {
+		return nil, err
+	}
+	return swaps, nil
+}
+
+// QueryMints fetches mints matching args, with their transaction and pair.
+// It takes the same arguments as QuerySwaps.
+func QueryMints(args map[string]interface{}) (*[]Mint, error) {
+	return QueryMintsContext(context.Background(), args)
+}
+
+// QueryMintsContext is QueryMints with a context the query is cancelled with.
+func QueryMintsContext(ctx context.Context, args map[string]interface{}) (*[]Mint, error) {
+	queryStruct := Mint{}
+	query := generateQueryFromStruct(&queryStruct, "mints", "", args)
+	mintsResponse, err := RunGraphQLQueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var mints *[]Mint
+	mintsJSON, err := json.Marshal(mintsResponse["mints"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(mintsJSON, &mints)
+	if err != nil {
+		return nil, err
+	}
+	return mints, nil
+}
+
+// QueryBurns fetches burns matching args, with their transaction and pair.
+// It takes the same arguments as QuerySwaps.
+func QueryBurns(args map[string]interface{}) (*[]Burn, error) {
+	return QueryBurnsContext(context.Background(), args)
+}
+
+// QueryBurnsContext is QueryBurns with a context the query is cancelled with.
+func QueryBurnsContext(ctx context.Context, args map[string]interface{}) (*[]Burn, error) {
+	queryStruct := Burn{}
+	query := generateQueryFromStruct(&queryStruct, "burns", "", args)
+	burnsResponse, err := RunGraphQLQueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var burns *[]Burn
+	burnsJSON, err := json.Marshal(burnsResponse["burns"])
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(burnsJSON, &burns)
+	if err != nil {
+		return nil, err
+	}
+	return burns, nil
+}
+
 // QueryTokenTransactions queries the Uniswap GraphQL API for mints, burns, and swaps transactions
 // for a list of given pairs, up to a specified number of transactions per pair. It returns the
 // transactions separated by type (mints, burns, and swaps) in three slices of their respective types.
@@ -489,40 +762,60 @@ func QueryAllUniswapTokens(skip int) (*[]TokenData, error) {
 // will be nil
 func QueryTokenTransactions(client *graphql.Client, allPairs []string, first int) ([]*Mint, []*Burn, []*Swap, error) {
 	query := `
-	query($allPairs: [String!]) {
+	query($allPairs: [String!], $first: Int!) {
 	  mints(first: $first, where: { pair_in: $allPairs }, orderBy: timestamp, orderDirection: desc) {
+		id
 		transaction {
 		  id
+		  blockNumber
 		  timestamp
 		}
+		pair {
+		  id
+		}
 		to
 		liquidity
 		amount0
 		amount1
 		amountUSD
+		logIndex
 	  }
 	  burns(first: $first, where: { pair_in: $allPairs }, orderBy: timestamp, orderDirection: desc) {
+		id
 		transaction {
 		  id
+		  blockNumber
 		  timestamp
 		}
+		pair {
+		  id
+		}
 		to
 		liquidity
 		amount0
 		amount1
 		amountUSD
+		logIndex
 	  }
 	  swaps(first: $first, where: { pair_in: $allPairs }, orderBy: timestamp, orderDirection: desc) {
+		id
 		transaction {
 		  id
+		  blockNumber
 		  timestamp
 		}
+		pair {
+		  id
+		}
 		amount0In
 		amount0Out
 		amount1In
 		amount1Out
 		amountUSD
 		to
+		sender
+		from
+		logIndex
 	  }
 	}
 	`
@@ -530,7 +823,6 @@ func QueryTokenTransactions(client *graphql.Client, allPairs []string, first int
 	req := graphql.NewRequest(query)
 	req.Var("allPairs", allPairs)
 	req.Var("first", first)
-	fmt.Printf("req: %v", req)
 	var responseData struct {
 		Mints []*Mint `graphql:"mints"`
 		Burns []*Burn `graphql:"burns"`
@@ -567,7 +859,7 @@ func QueryTokenDailyData(args map[string]interface{}) (*[]TokenDayData, error) {
 	tokenDailyData := generateQueryFromStruct(query, "tokenDayDatas", "", args)
 	tokenDailyDataResponse, err := RunGraphQLQuery(tokenDailyData)
 	if err != nil {
-		log.Fatalf("Error executing  GraphQL request: %v", err)
+		return nil, err
 	}
 	var tokenDailyDataSlice *[]TokenDayData
 	tokenDailyDataJSON, err := json.Marshal(tokenDailyDataResponse["tokenDayDatas"])
@@ -1,7 +1,12 @@
 package uniswap
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/machinebox/graphql"
 )
 
 func TestBuildArgs(t *testing.T) {
@@ -21,6 +26,16 @@ func TestBuildArgs(t *testing.T) {
 	}
 }
 
+func TestAtBlock(t *testing.T) {
+	args := AtBlock(map[string]interface{}{"first": 10}, 17000000)
+	if argsString := BuildArgs(args); argsString != "block: {number: 17000000}, first: 10" {
+		t.Errorf("Unexpected args string: %s", argsString)
+	}
+	if args := AtBlock(nil, 0); args != nil {
+		t.Errorf("Expected no args for the latest block, got %v", args)
+	}
+}
+
 func TestBuildFields(t *testing.T) {
 	type Token struct {
 		ID     string `graphql:"id"`
@@ -34,7 +49,130 @@ func TestBuildFields(t *testing.T) {
 		t.Errorf("Unexpected fields string: %s", fieldsString)
 	}
 }
+
+func TestBuildFieldsNested(t *testing.T) {
+	fieldsString := BuildFields(&PairData{})
+	expectedFieldsString := "id\ntoken0 { id\nsymbol\nname\nderivedETH }\ntoken1 { id\nsymbol\nname\nderivedETH }\nreserve0\nreserve1\nreserveUSD\nvolumeUSD\ntxCount"
+	if fieldsString != expectedFieldsString {
+		t.Errorf("Unexpected fields string:\nGot:      %s\nExpected: %s", fieldsString, expectedFieldsString)
+	}
+}
+
+func TestGenerateCollectionQuery(t *testing.T) {
+	query := generateQueryFromStruct(&Pairs{}, "pairs", "", map[string]interface{}{"first": 10})
+	expectedQuery := `{ pairs(first: 10){ id } }`
+	if query != expectedQuery {
+		t.Errorf("Unexpected query:\nGot:      %s\nExpected: %s", query, expectedQuery)
+	}
+}
+
+func TestGetAmountOut(t *testing.T) {
+	amountOut, err := GetAmountOut(1, 100, 200)
+	if err != nil {
+		t.Fatalf("GetAmountOut failed: %v", err)
+	}
+	amountIn, err := GetAmountIn(amountOut, 100, 200)
+	if err != nil {
+		t.Fatalf("GetAmountIn failed: %v", err)
+	}
+	if amountIn < 0.999999 || amountIn > 1.000001 {
+		t.Errorf("Expected GetAmountIn to invert GetAmountOut, got %f", amountIn)
+	}
+	if _, err := GetAmountOut(1, 0, 200); err != ErrInsufficientLiquidity {
+		t.Errorf("Expected ErrInsufficientLiquidity, got %v", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	cursor := NewCursor("timestamp", 100)
+	where := map[string]interface{}{"pair": "0xa"}
+	args := cursor.Args(where, 3)
+	if BuildArgs(args) != `first: 3, orderBy: "timestamp", orderDirection: "asc", where: {pair: "0xa", timestamp_gte: 100}` {
+		t.Errorf("Unexpected first page args: %s", BuildArgs(args))
+	}
+	if _, ok := where["timestamp_gte"]; ok {
+		t.Errorf("Args modified where")
+	}
+
+	// A page ending with two records at 105: the next page starts at 105 and
+	// skips them.
+	cursor.Advance([]int64{100, 105, 105})
+	if cursor.Value != 105 || cursor.Skip != 2 {
+		t.Errorf("Unexpected cursor %+v", cursor)
+	}
+	cursor.Advance([]int64{105})
+	if cursor.Value != 105 || cursor.Skip != 3 {
+		t.Errorf("Unexpected cursor %+v", cursor)
+	}
+	if args := cursor.Args(nil, 3); args["skip"] != 3 {
+		t.Errorf("Expected skip 3, got %v", args["skip"])
+	}
+	cursor.Advance([]int64{106})
+	if cursor.Value != 106 || cursor.Skip != 1 {
+		t.Errorf("Unexpected cursor %+v", cursor)
+	}
+}
+
+func TestCursorAgainstMock(t *testing.T) {
+	useMock(t)
+	// Three swaps share the first second and two the fourth, so pages of 2
+	// end inside runs of equal timestamps.
+	cursor := NewCursor("timestamp", 1680000000)
+	var ids []string
+	for page := 0; page < 10; page++ {
+		swaps, err := QuerySwaps(cursor.Args(map[string]interface{}{"pair": daiWETH}, 2))
+		if err != nil {
+			t.Fatalf("QuerySwaps failed: %v", err)
+		}
+		if len(*swaps) == 0 {
+			break
+		}
+		values := make([]int64, len(*swaps))
+		for i, swap := range *swaps {
+			ids = append(ids, swap.ID)
+			values[i], _ = strconv.ParseInt(swap.Transaction.Timestamp, 10, 64)
+		}
+		cursor.Advance(values)
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Errorf("Swap %s read twice", id)
+		}
+		seen[id] = true
+	}
+	if len(ids) != 7 {
+		t.Errorf("Expected the 7 DAI/WETH swaps, got %d: %v", len(ids), ids)
+	}
+}
+
+func TestQueryPairsAgainstMock(t *testing.T) {
+	mock := useMock(t)
+	liquid, err := QueryMostLiquidPairs(map[string]interface{}{"first": 1, "orderBy": "reserveUSD", "orderDirection": "desc"})
+	if err != nil || len(*liquid) != 1 || (*liquid)[0].ID != "0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc" {
+		t.Errorf("Expected USDC/WETH, the most liquid pair, got %v, %v", liquid, err)
+	}
+	pairs, err := QueryPairs(map[string]interface{}{"where": map[string]interface{}{"id_in": []string{daiWETH, "0xmissing"}}})
+	if err != nil || len(*pairs) != 1 || (*pairs)[0].Token0.Symbol != "DAI" {
+		t.Errorf("Expected DAI/WETH with its tokens, got %+v, %v", pairs, err)
+	}
+	days, err := QueryPairDailyAggregated(map[string]interface{}{
+		"orderBy": "date", "orderDirection": "desc",
+		"where": map[string]interface{}{"pairAddress": daiWETH, "date_gt": 1679961600},
+	})
+	if err != nil || len(*days) != 2 || (*days)[0].Date != 1680134400 {
+		t.Errorf("Unexpected days %+v, %v", days, err)
+	}
+	if _, err := QueryPairs(map[string]interface{}{"first": 1001}); err == nil {
+		t.Errorf("Expected first over 1000 to be rejected")
+	}
+	if len(mock.Queries()) != 4 {
+		t.Errorf("Expected 4 queries, got %d", len(mock.Queries()))
+	}
+}
+
 func TestRunGraphQLQuery(t *testing.T) {
+	useFixtures(t)
 	query := `
 		query {
 		  token(id: "0x6b175474e89094c44da98b954eedeac495271d0f") {
@@ -66,3 +204,198 @@ func TestRunGraphQLQuery(t *testing.T) {
 		t.Errorf("Expected name %s but got %v", expectedName, tokenData["name"])
 	}
 }
+
+const (
+	daiWETH = "0xa478c2975ab1ea89e8196811f51a7b7ade33eb11"
+	dai     = "0x6b175474e89094c44da98b954eedeac495271d0f"
+	weth    = "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+)
+
+func TestQueryGlobalStats(t *testing.T) {
+	factory := "0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"
+	if query := QueryGlobalStats(factory); !strings.Contains(query, `uniswapFactory(id: "`+factory+`")`) {
+		t.Errorf("Unexpected query %s", query)
+	}
+	if query := QueryGlobalHistoricalLookup(factory, 17000000); !strings.Contains(query, `block: {number: 17000000}`) {
+		t.Errorf("Unexpected query %s", query)
+	}
+}
+
+func TestQueryPairOverview(t *testing.T) {
+	useFixtures(t)
+	pair, err := QueryPairOverview(daiWETH)
+	if err != nil {
+		t.Fatalf("QueryPairOverview failed: %v", err)
+	}
+	if pair.ID != daiWETH || pair.Token0.Symbol != "DAI" || pair.Token1.Symbol != "WETH" || pair.Reserve0 == "" {
+		t.Errorf("Unexpected pair %+v", pair)
+	}
+}
+
+func TestQueryPairs(t *testing.T) {
+	useFixtures(t)
+	all, err := QueryAllUniswapPairs(0)
+	if err != nil || len(*all) != 2 {
+		t.Fatalf("Unexpected pairs %v, %v", all, err)
+	}
+	liquid, err := QueryMostLiquidPairs(map[string]interface{}{"first": 2, "orderBy": "reserveUSD", "orderDirection": "desc"})
+	if err != nil || len(*liquid) != 2 || (*liquid)[0].ID == "" {
+		t.Fatalf("Unexpected most liquid pairs %v, %v", liquid, err)
+	}
+	pairs, err := QueryPairs(map[string]interface{}{"where": map[string]interface{}{"id_in": []string{daiWETH}}})
+	if err != nil {
+		t.Fatalf("QueryPairs failed: %v", err)
+	}
+	if len(*pairs) != 1 || (*pairs)[0].Token1.ID != weth {
+		t.Errorf("Unexpected pairs %+v", *pairs)
+	}
+}
+
+func TestQueryRecentSwapsFromPair(t *testing.T) {
+	useFixtures(t)
+	swaps, err := QueryRecentSwapsFromPair(map[string]interface{}{
+		"first": 2, "orderBy": "timestamp", "orderDirection": "desc",
+		"where": map[string]interface{}{"pair": daiWETH},
+	})
+	if err != nil {
+		t.Fatalf("QueryRecentSwapsFromPair failed: %v", err)
+	}
+	if len(*swaps) != 2 || (*swaps)[0].Pair.Token0.Symbol != "DAI" || (*swaps)[0].Transaction.Timestamp == "" {
+		t.Errorf("Unexpected swaps %+v", *swaps)
+	}
+}
+
+func TestQuerySwapsMintsBurns(t *testing.T) {
+	useFixtures(t)
+	args := map[string]interface{}{
+		"first": 2, "orderBy": "timestamp", "orderDirection": "asc",
+		"where": map[string]interface{}{"pair": daiWETH, "timestamp_gte": 1680000000},
+	}
+	swaps, err := QuerySwaps(args)
+	if err != nil {
+		t.Fatalf("QuerySwaps failed: %v", err)
+	}
+	if len(*swaps) != 2 || (*swaps)[0].Pair.ID != daiWETH || (*swaps)[0].LogIndex == "" || (*swaps)[0].Sender == "" {
+		t.Errorf("Unexpected swaps %+v", *swaps)
+	}
+	mints, err := QueryMints(args)
+	if err != nil {
+		t.Fatalf("QueryMints failed: %v", err)
+	}
+	if len(*mints) != 2 || (*mints)[0].Liquidity == "" || (*mints)[0].Transaction.BlockNumber == "" {
+		t.Errorf("Unexpected mints %+v", *mints)
+	}
+	burns, err := QueryBurns(args)
+	if err != nil {
+		t.Fatalf("QueryBurns failed: %v", err)
+	}
+	if len(*burns) != 2 || (*burns)[1].AmountUSD == "" {
+		t.Errorf("Unexpected burns %+v", *burns)
+	}
+}
+
+func TestQueryPairDailyAndHourData(t *testing.T) {
+	useFixtures(t)
+	days, err := QueryPairDailyAggregated(map[string]interface{}{
+		"first": 2, "orderBy": "date", "orderDirection": "asc",
+		"where": map[string]interface{}{"pairAddress": daiWETH, "date_gt": 1679875200},
+	})
+	if err != nil {
+		t.Fatalf("QueryPairDailyAggregated failed: %v", err)
+	}
+	if len(*days) != 2 || (*days)[1].Date <= (*days)[0].Date || (*days)[0].PairAddress != daiWETH {
+		t.Errorf("Unexpected days %+v", *days)
+	}
+	hours, err := QueryPairHourData(map[string]interface{}{
+		"first": 2, "orderBy": "hourStartUnix", "orderDirection": "asc",
+		"where": map[string]interface{}{"pair": daiWETH, "hourStartUnix_gte": 1680000000},
+	})
+	if err != nil {
+		t.Fatalf("QueryPairHourData failed: %v", err)
+	}
+	if len(*hours) != 2 || (*hours)[0].HourStartUnix != 1680001200 || (*hours)[0].ReserveUSD == "" {
+		t.Errorf("Unexpected hours %+v", *hours)
+	}
+}
+
+func TestQueryLiquidityPositions(t *testing.T) {
+	useFixtures(t)
+	positions, err := QueryLiquidityPositions(map[string]interface{}{
+		"first": 2, "orderBy": "liquidityTokenBalance", "orderDirection": "desc",
+		"where": map[string]interface{}{"pair": daiWETH, "liquidityTokenBalance_gt": 0},
+	})
+	if err != nil {
+		t.Fatalf("QueryLiquidityPositions failed: %v", err)
+	}
+	if len(*positions) != 2 || (*positions)[0].User.ID == "" || (*positions)[0].Pair.ID != daiWETH {
+		t.Errorf("Unexpected positions %+v", *positions)
+	}
+}
+
+func TestQueryTokens(t *testing.T) {
+	useFixtures(t)
+	overview, err := QueryTokenOverview(dai)
+	if err != nil {
+		t.Fatalf("QueryTokenOverview failed: %v", err)
+	}
+	if overview.Symbol != "DAI" || overview.Decimals != "18" || overview.TradeVolumeUSD == "" {
+		t.Errorf("Unexpected overview %+v", overview)
+	}
+	token, err := QueryTokenData(dai)
+	if err != nil {
+		t.Fatalf("QueryTokenData failed: %v", err)
+	}
+	if token.ID != dai || token.Name != "Dai Stablecoin" {
+		t.Errorf("Unexpected token %+v", token)
+	}
+	tokens, err := QueryAllUniswapTokens(0)
+	if err != nil || len(*tokens) != 2 || (*tokens)[1].Symbol != "WETH" {
+		t.Errorf("Unexpected tokens %v, %v", tokens, err)
+	}
+	days, err := QueryTokenDailyData(map[string]interface{}{
+		"first": 2, "orderBy": "date", "orderDirection": "asc",
+		"where": map[string]interface{}{"token": dai},
+	})
+	if err != nil {
+		t.Fatalf("QueryTokenDailyData failed: %v", err)
+	}
+	if len(*days) != 2 || (*days)[0].PriceUSD == "" || (*days)[0].DailyVolumeUSD == "" {
+		t.Errorf("Unexpected token days %+v", *days)
+	}
+}
+
+func TestQueryTokenTransactions(t *testing.T) {
+	server := useFixtures(t)
+	mints, burns, swaps, err := QueryTokenTransactions(graphql.NewClient(server.URL), []string{daiWETH}, 2)
+	if err != nil {
+		t.Fatalf("QueryTokenTransactions failed: %v", err)
+	}
+	if len(mints) != 2 || len(burns) != 2 || len(swaps) != 2 {
+		t.Fatalf("Expected 2 of each, got %d mints, %d burns and %d swaps", len(mints), len(burns), len(swaps))
+	}
+	if swaps[0].Pair.ID != daiWETH || mints[0].Transaction.Timestamp == "" {
+		t.Errorf("Unexpected transactions %+v, %+v", swaps[0], mints[0])
+	}
+}
+
+func TestQueriesReturnErrors(t *testing.T) {
+	previous := DefaultRunner()
+	SetRunner(&fakeEndpoint{err: errors.New("subgraph unavailable")})
+	defer SetRunner(previous)
+	args := map[string]interface{}{"first": 1}
+	for name, query := range map[string]func() error{
+		"QueryPairOverview":        func() error { _, err := QueryPairOverview(daiWETH); return err },
+		"QueryAllUniswapPairs":     func() error { _, err := QueryAllUniswapPairs(0); return err },
+		"QueryMostLiquidPairs":     func() error { _, err := QueryMostLiquidPairs(args); return err },
+		"QueryRecentSwapsFromPair": func() error { _, err := QueryRecentSwapsFromPair(args); return err },
+		"QueryPairDailyAggregated": func() error { _, err := QueryPairDailyAggregated(args); return err },
+		"QueryTokenOverview":       func() error { _, err := QueryTokenOverview(dai); return err },
+		"QueryTokenData":           func() error { _, err := QueryTokenData(dai); return err },
+		"QueryAllUniswapTokens":    func() error { _, err := QueryAllUniswapTokens(0); return err },
+		"QueryTokenDailyData":      func() error { _, err := QueryTokenDailyData(args); return err },
+	} {
+		if err := query(); err == nil || err.Error() != "subgraph unavailable" {
+			t.Errorf("Expected %s to return the query error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// Package uniswaptest builds uniswap entities for tests of the packages
+// working on pair snapshots, such as router, arbitrage and oracle.
+package uniswaptest
+
+import "github.com/gelhteag/onchainaggregator/pkg/uniswap"
+
+// Pair returns a pair snapshot between token0 and token1 with the given
+// reserves, in token units.
+func Pair(id, token0, token1, reserve0, reserve1 string) uniswap.PairData {
+	return uniswap.PairData{
+		ID:       id,
+		Token0:   &uniswap.Token{ID: token0},
+		Token1:   &uniswap.Token{ID: token1},
+		Reserve0: reserve0,
+		Reserve1: reserve1,
+	}
+}
@@ -0,0 +1,83 @@
+package whale
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+// FromSwaps converts swaps returned by QueryTokenTransactions into events.
+func FromSwaps(swaps []*uniswap.Swap) ([]Event, error) {
+	events := make([]Event, 0, len(swaps))
+	for _, swap := range swaps {
+		event, err := newEvent(KindSwap, swap.ID, swap.Transaction, swap.Pair, swap.To, swap.AmountUSD)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// FromMints converts mints returned by QueryTokenTransactions into events.
+func FromMints(mints []*uniswap.Mint) ([]Event, error) {
+	events := make([]Event, 0, len(mints))
+	for _, mint := range mints {
+		event, err := newEvent(KindMint, mint.ID, mint.Transaction, mint.Pair, mint.To, mint.AmountUSD)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// FromBurns converts burns returned by QueryTokenTransactions into events.
+func FromBurns(burns []*uniswap.Burn) ([]Event, error) {
+	events := make([]Event, 0, len(burns))
+	for _, burn := range burns {
+		event, err := newEvent(KindBurn, burn.ID, burn.Transaction, burn.Pair, burn.To, burn.AmountUSD)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// FromRecentSwaps converts the output of QueryRecentSwapsFromPair into events.
+func FromRecentSwaps(swaps []uniswap.RecentSwapsFromPairQuery) ([]Event, error) {
+	events := make([]Event, 0, len(swaps))
+	for _, swap := range swaps {
+		event, err := newEvent(KindSwap, swap.ID, swap.Transaction, &uniswap.Pairs{ID: swap.Pair.ID}, swap.To, swap.AmountUSD)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func newEvent(kind Kind, id string, transaction *uniswap.Transaction, pair *uniswap.Pairs, to, amountUSD string) (Event, error) {
+	event := Event{Kind: kind, ID: id, To: to}
+	amount, err := strconv.ParseFloat(amountUSD, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("%s %s: invalid amountUSD: %v", kind, id, err)
+	}
+	event.AmountUSD = amount
+	if pair != nil {
+		event.Pair = pair.ID
+	}
+	if transaction != nil {
+		event.TxHash = transaction.ID
+		if transaction.Timestamp != "" {
+			timestamp, err := strconv.ParseInt(transaction.Timestamp, 10, 64)
+			if err != nil {
+				return Event{}, fmt.Errorf("%s %s: invalid timestamp: %v", kind, id, err)
+			}
+			event.Timestamp = timestamp
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,187 @@
+package whale
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+type Kind string
+
+const (
+	KindSwap Kind = "swap"
+	KindMint Kind = "mint"
+	KindBurn Kind = "burn"
+)
+
+// Reasons an event is flagged.
+const (
+	ReasonAmountUSD    = "amount_usd"
+	ReasonReserveShare = "reserve_share"
+)
+
+// Event is a swap, mint or burn reduced to the fields the detector needs.
+type Event struct {
+	Kind      Kind
+	ID        string
+	TxHash    string
+	Pair      string
+	To        string
+	AmountUSD float64
+	Timestamp int64
+}
+
+// Alert is emitted for every event that crosses a threshold.
+type Alert struct {
+	Event   Event
+	Reasons []string
+	// ReserveShare is AmountUSD divided by the pair's reserveUSD, 0 when the
+	// pair's reserves are unknown.
+	ReserveShare float64
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s of %.2f USD on pair %s to %s (%s)", a.Event.Kind, a.Event.AmountUSD, a.Event.Pair, a.Event.To, strings.Join(a.Reasons, ", "))
+}
+
+type Config struct {
+	// MinAmountUSD flags events whose amountUSD is at least this value. 0 disables the check.
+	MinAmountUSD float64
+	// MinReserveShare flags events worth at least this fraction of the pair's
+	// reserveUSD, e.g. 0.02 for 2%. 0 disables the check.
+	MinReserveShare float64
+}
+
+// Handler receives alerts as they are raised, e.g. to forward them to a notifier.
+type Handler func(Alert)
+
+// ChannelHandler returns a Handler that sends alerts on ch.
+func ChannelHandler(ch chan<- Alert) Handler {
+	return func(alert Alert) {
+		ch <- alert
+	}
+}
+
+// Detector flags large trades and liquidity moves. Events already seen are
+// ignored, so overlapping polls of the same swaps do not raise duplicate alerts.
+type Detector struct {
+	Config  Config
+	Handler Handler
+	// Window is how long event ids are remembered, measured back from the
+	// newest event checked. It must cover the overlap between polls: older
+	// events could no longer be told apart from ones already alerted on, so
+	// they are skipped.
+	Window time.Duration
+
+	mu       sync.Mutex
+	reserves map[string]float64
+	// seen holds the timestamp of each event checked within the window.
+	seen   map[string]int64
+	newest int64
+}
+
+func NewDetector(config Config, handler Handler) *Detector {
+	return &Detector{
+		Config:   config,
+		Handler:  handler,
+		Window:   time.Hour,
+		reserves: make(map[string]float64),
+		seen:     make(map[string]int64),
+	}
+}
+
+// SetReserves updates the reserveUSD of the given pairs used for the reserve share check.
+func (d *Detector) SetReserves(pairs []uniswap.PairData) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, pair := range pairs {
+		reserveUSD, err := strconv.ParseFloat(pair.ReserveUSD, 64)
+		if err != nil {
+			return fmt.Errorf("pair %s: invalid reserveUSD: %v", pair.ID, err)
+		}
+		d.reserves[strings.ToLower(pair.ID)] = reserveUSD
+	}
+	return nil
+}
+
+// Check flags the events above the configured thresholds, passes each alert
+// to the handler and returns them.
+func (d *Detector) Check(events []Event) []Alert {
+	d.mu.Lock()
+	for _, event := range events {
+		if event.ID != "" && event.Timestamp > d.newest {
+			d.newest = event.Timestamp
+		}
+	}
+	oldest := d.newest - int64(d.Window/time.Second)
+	var alerts []Alert
+	for _, event := range events {
+		if event.ID != "" {
+			if _, ok := d.seen[event.ID]; ok || event.Timestamp < oldest {
+				continue
+			}
+			d.seen[event.ID] = event.Timestamp
+		}
+		alert := Alert{Event: event}
+		if reserveUSD := d.reserves[strings.ToLower(event.Pair)]; reserveUSD > 0 {
+			alert.ReserveShare = event.AmountUSD / reserveUSD
+		}
+		if d.Config.MinAmountUSD > 0 && event.AmountUSD >= d.Config.MinAmountUSD {
+			alert.Reasons = append(alert.Reasons, ReasonAmountUSD)
+		}
+		if d.Config.MinReserveShare > 0 && alert.ReserveShare >= d.Config.MinReserveShare {
+			alert.Reasons = append(alert.Reasons, ReasonReserveShare)
+		}
+		if len(alert.Reasons) > 0 {
+			alerts = append(alerts, alert)
+		}
+	}
+	for id, timestamp := range d.seen {
+		if timestamp < oldest {
+			delete(d.seen, id)
+		}
+	}
+	d.mu.Unlock()
+
+	if d.Handler != nil {
+		for _, alert := range alerts {
+			d.Handler(alert)
+		}
+	}
+	return alerts
+}
+
+// AddressActivity summarises the alerts raised for one recipient address.
+type AddressActivity struct {
+	Address  string
+	Count    int
+	TotalUSD float64
+	Alerts   []Alert
+}
+
+// GroupByAddress groups alerts by the event's `to` address, largest total first.
+func GroupByAddress(alerts []Alert) []AddressActivity {
+	byAddress := make(map[string]*AddressActivity)
+	for _, alert := range alerts {
+		address := strings.ToLower(alert.Event.To)
+		activity, ok := byAddress[address]
+		if !ok {
+			activity = &AddressActivity{Address: address}
+			byAddress[address] = activity
+		}
+		activity.Count++
+		activity.TotalUSD += alert.Event.AmountUSD
+		activity.Alerts = append(activity.Alerts, alert)
+	}
+	grouped := make([]AddressActivity, 0, len(byAddress))
+	for _, activity := range byAddress {
+		grouped = append(grouped, *activity)
+	}
+	sort.Slice(grouped, func(i, j int) bool { return grouped[i].TotalUSD > grouped[j].TotalUSD })
+	return grouped
+}
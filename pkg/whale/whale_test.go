@@ -0,0 +1,110 @@
+package whale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gelhteag/onchainaggregator/pkg/uniswap"
+)
+
+func testSwap(id, pair, to, amountUSD string) *uniswap.Swap {
+	return &uniswap.Swap{
+		ID:          id,
+		Transaction: &uniswap.Transaction{ID: id[:4], Timestamp: "1680000000"},
+		Pair:        &uniswap.Pairs{ID: pair},
+		To:          to,
+		AmountUSD:   amountUSD,
+	}
+}
+
+func TestCheckFlagsThresholds(t *testing.T) {
+	var received []Alert
+	detector := NewDetector(Config{MinAmountUSD: 1000000, MinReserveShare: 0.05}, func(alert Alert) {
+		received = append(received, alert)
+	})
+	err := detector.SetReserves([]uniswap.PairData{
+		{ID: "0xdeep", ReserveUSD: "100000000"},
+		{ID: "0xthin", ReserveUSD: "100000"},
+	})
+	if err != nil {
+		t.Fatalf("SetReserves failed: %v", err)
+	}
+
+	events, err := FromSwaps([]*uniswap.Swap{
+		testSwap("0xaaa-0", "0xdeep", "0xwhale", "2500000"),
+		testSwap("0xbbb-0", "0xdeep", "0xminnow", "500"),
+		testSwap("0xccc-0", "0xthin", "0xminnow", "9000"),
+	})
+	if err != nil {
+		t.Fatalf("FromSwaps failed: %v", err)
+	}
+
+	alerts := detector.Check(events)
+	if len(alerts) != 2 || len(received) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d (handler saw %d)", len(alerts), len(received))
+	}
+	if alerts[0].Reasons[0] != ReasonAmountUSD {
+		t.Errorf("Expected amount alert, got %v", alerts[0].Reasons)
+	}
+	if alerts[1].Reasons[0] != ReasonReserveShare || alerts[1].ReserveShare < 0.09 {
+		t.Errorf("Expected reserve share alert, got %+v", alerts[1])
+	}
+
+	// A second poll returning the same swaps must not alert again.
+	if again := detector.Check(events); len(again) != 0 {
+		t.Errorf("Expected no duplicate alerts, got %d", len(again))
+	}
+}
+
+func TestCheckForgetsEventsOutsideWindow(t *testing.T) {
+	detector := NewDetector(Config{MinAmountUSD: 1}, nil)
+	detector.Window = time.Minute
+	old := Event{Kind: KindSwap, ID: "0xold-0", AmountUSD: 5, Timestamp: 1680000000}
+	detector.Check([]Event{old})
+	detector.Check([]Event{{Kind: KindSwap, ID: "0xnew-0", AmountUSD: 5, Timestamp: 1680000030}})
+	if len(detector.seen) != 2 {
+		t.Errorf("Expected both events remembered within the window, got %d", len(detector.seen))
+	}
+	detector.Check([]Event{{Kind: KindSwap, ID: "0xnewer-0", AmountUSD: 5, Timestamp: 1680000090}})
+	if _, ok := detector.seen[old.ID]; ok || len(detector.seen) != 2 {
+		t.Errorf("Expected the oldest event forgotten, got %v", detector.seen)
+	}
+
+	// The forgotten event is older than the window, so a late poll
+	// returning it again must not alert on it a second time.
+	if alerts := detector.Check([]Event{old}); len(alerts) != 0 {
+		t.Errorf("Expected no alert for an event outside the window, got %v", alerts)
+	}
+	if _, ok := detector.seen[old.ID]; ok {
+		t.Errorf("Expected the old event not remembered again, got %v", detector.seen)
+	}
+}
+
+func TestGroupByAddress(t *testing.T) {
+	alerts := []Alert{
+		{Event: Event{To: "0xA", AmountUSD: 10}},
+		{Event: Event{To: "0xb", AmountUSD: 50}},
+		{Event: Event{To: "0xa", AmountUSD: 30}},
+	}
+	grouped := GroupByAddress(alerts)
+	if len(grouped) != 2 {
+		t.Fatalf("Expected 2 addresses, got %d", len(grouped))
+	}
+	if grouped[0].Address != "0xb" || grouped[1].Address != "0xa" || grouped[1].Count != 2 || grouped[1].TotalUSD != 40 {
+		t.Errorf("Unexpected grouping %+v", grouped)
+	}
+}
+
+func TestChannelHandler(t *testing.T) {
+	ch := make(chan Alert, 1)
+	detector := NewDetector(Config{MinAmountUSD: 1}, ChannelHandler(ch))
+	detector.Check([]Event{{Kind: KindBurn, ID: "0xburn", AmountUSD: 5}})
+	select {
+	case alert := <-ch:
+		if alert.Event.Kind != KindBurn {
+			t.Errorf("Unexpected alert %v", alert)
+		}
+	default:
+		t.Error("Expected an alert on the channel")
+	}
+}